@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/system32-ai/sandboxed/pkg/eval"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+)
+
+var (
+	evalNamespace   string
+	evalParallelism int
+	evalReuse       bool
+	evalTimeout     time.Duration
+	evalK           []int
+	evalResults     string
+	evalReport      string
+)
+
+// evalCmd runs a benchmark of cases across a pool of sandboxes
+var evalCmd = &cobra.Command{
+	Use:   "eval CASES.jsonl",
+	Short: "Evaluate code samples against their tests and report pass@k",
+	Long: `Evaluate code samples, such as model-generated solutions, against their tests.
+
+Each line of CASES.jsonl is a case:
+  {"id": "...", "problem": "...", "language": "python", "code": "...",
+   "tests": "...", "expected_output": "...", "timeout": 10}
+
+The tests are appended to the code and the program is run. A case passes when
+it exits 0 and, if expected_output is set, prints it. Samples that share a
+problem are scored together with pass@k; cases that could not be run are
+left out of it. Cases run in parallel, each on a new sandbox. With
+--reuse-sandboxes, sandboxes are reused with processes, the workspace, /tmp
+and the home directory cleared between cases; other changes, such as
+installed packages, carry over. Use "-" to read cases from stdin.
+
+Examples:
+  sandboxed eval samples.jsonl
+  sandboxed eval samples.jsonl --parallel 16 --timeout 10s --k 1,10,100
+  sandboxed eval samples.jsonl --results results.jsonl --report report.csv`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cases, err := readEvalCases(args[0])
+		if err != nil {
+			log.Fatalf("Failed to read cases: %v", err)
+		}
+
+		client, err := newKubeClient(evalNamespace)
+		if err != nil {
+			log.Fatalf("Failed to create Kubernetes client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		finished := 0
+		results, err := eval.Run(ctx, cases, eval.Options{
+			Parallelism: evalParallelism,
+			Timeout:     evalTimeout,
+			Reuse:       evalReuse,
+			Factory:     eval.SandboxFactory(sdk.WithClient(client), sdk.WithNamespace(evalNamespace)),
+			OnResult: func(r eval.CaseResult) {
+				finished++
+				log.Printf("[%d/%d] %s: %s (%.2fs)", finished, len(cases), r.ID, r.Status, r.Duration)
+			},
+		})
+		if err != nil {
+			log.Printf("Evaluation stopped: %v", err)
+		}
+
+		summary := eval.Summarize(results, evalK)
+		if evalResults != "" {
+			if err := writeEvalFile(evalResults, func(w io.Writer) error {
+				return eval.WriteResults(w, eval.FormatForPath(evalResults), results)
+			}); err != nil {
+				log.Fatalf("Failed to write results: %v", err)
+			}
+		}
+		if evalReport != "" {
+			if err := writeEvalFile(evalReport, func(w io.Writer) error {
+				return eval.WriteReport(w, eval.FormatForPath(evalReport), summary)
+			}); err != nil {
+				log.Fatalf("Failed to write report: %v", err)
+			}
+		}
+
+		fmt.Printf("%d cases: %d passed, %d failed, %d timed out, %d errors\n",
+			summary.Cases, summary.Passed, summary.Failed, summary.TimedOut, summary.Errors)
+		for _, k := range summary.K {
+			if score, ok := summary.PassAtK[k]; ok {
+				fmt.Printf("pass@%d: %.4f\n", k, score)
+			} else {
+				fmt.Printf("pass@%d: no problem has %d samples\n", k, k)
+			}
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+func readEvalCases(path string) ([]eval.Case, error) {
+	if path == "-" {
+		return eval.ReadCases(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return eval.ReadCases(f)
+}
+
+func writeEvalFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(evalCmd)
+
+	evalCmd.Flags().StringVarP(&evalNamespace, "namespace", "n", "default", "Namespace to create the sandboxes in")
+	evalCmd.Flags().IntVarP(&evalParallelism, "parallel", "p", 4, "Number of cases run at once, and of sandboxes in the pool")
+	evalCmd.Flags().BoolVar(&evalReuse, "reuse-sandboxes", false, "Reuse sandboxes between cases instead of creating one per case; only for trusted cases")
+	evalCmd.Flags().DurationVar(&evalTimeout, "timeout", eval.DefaultTimeout, "Time limit for a case that sets no timeout")
+	evalCmd.Flags().IntSliceVar(&evalK, "k", []int{1}, "Values of k to compute pass@k for")
+	evalCmd.Flags().StringVar(&evalResults, "results", "", "File to write each case's result to, as JSONL or CSV by extension")
+	evalCmd.Flags().StringVar(&evalReport, "report", "", "File to write each problem's pass@k to, as JSONL or CSV by extension")
+}
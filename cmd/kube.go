@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// Cluster selection flags shared by every command
+var (
+	kubeconfigPath string
+	kubeContext    string
+	inCluster      bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&kubeconfigPath, "kubeconfig", "", "Path to the kubeconfig file (default $KUBECONFIG or ~/.kube/config)")
+	rootCmd.PersistentFlags().StringVar(&kubeContext, "context", "", "Kubeconfig context to use instead of the current one")
+	rootCmd.PersistentFlags().BoolVar(&inCluster, "in-cluster", false, "Use the pod's service account instead of a kubeconfig")
+}
+
+// clusterFlagsSet reports whether the cluster was chosen explicitly
+func clusterFlagsSet() bool {
+	return kubeconfigPath != "" || kubeContext != "" || inCluster
+}
+
+// newKubeClient connects to the cluster selected by the global flags
+func newKubeClient(namespace string) (*k8sclient.Client, error) {
+	return k8sclient.NewClientWithOptions(k8sclient.ClientOptions{
+		Namespace:  namespace,
+		Kubeconfig: kubeconfigPath,
+		Context:    kubeContext,
+		InCluster:  inCluster,
+	})
+}
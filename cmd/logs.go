@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+var (
+	logsNamespace  string
+	logsFollow     bool
+	logsTail       int64
+	logsSince      time.Duration
+	logsTimestamps bool
+	logsContainer  string
+)
+
+// logsCmd prints a sandbox's logs
+var logsCmd = &cobra.Command{
+	Use:   "logs SANDBOX_ID",
+	Short: "Print the logs of a sandbox",
+	Long: `Print the logs of a sandbox pod, optionally following new output.
+
+Examples:
+  sandboxed logs sandboxed-analysis
+  sandboxed logs -f sandboxed-analysis
+  sandboxed logs --tail 100 --since 10m --timestamps sandboxed-analysis`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := newKubeClient(logsNamespace)
+		if err != nil {
+			log.Fatalf("Failed to create Kubernetes client: %v", err)
+		}
+
+		if logsSince < 0 {
+			log.Fatalf("--since must not be negative, got %s", logsSince)
+		}
+
+		// The API counts whole seconds and treats 0 as all logs, so a part
+		// of a second is rounded up
+		opts := k8sclient.LogOptions{
+			Container:    logsContainer,
+			Follow:       logsFollow,
+			SinceSeconds: int64(math.Ceil(logsSince.Seconds())),
+			Timestamps:   logsTimestamps,
+		}
+		if logsTail >= 0 {
+			opts.TailLines = &logsTail
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		logs, err := client.StreamPodLogs(ctx, args[0], "", opts)
+		if err != nil {
+			log.Fatalf("Failed to get logs: %v", err)
+		}
+		defer logs.Close()
+
+		if _, err := io.Copy(os.Stdout, logs); err != nil && ctx.Err() == nil {
+			log.Fatalf("Failed to read logs: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringVarP(&logsNamespace, "namespace", "n", "default", "Namespace of the sandbox")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Stream new output until the sandbox exits")
+	logsCmd.Flags().Int64Var(&logsTail, "tail", -1, "Number of recent lines to show; all when negative")
+	logsCmd.Flags().DurationVar(&logsSince, "since", 0, "Only show output newer than this, such as 10m")
+	logsCmd.Flags().BoolVar(&logsTimestamps, "timestamps", false, "Prefix each line with its timestamp")
+	logsCmd.Flags().StringVarP(&logsContainer, "container", "c", "", "Container to read; the sandbox's only container when empty")
+}
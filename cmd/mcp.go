@@ -1,15 +1,31 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
 	"github.com/system32-ai/sandboxed/pkg/mcp"
+	"github.com/system32-ai/sandboxed/pkg/registry"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+	"k8s.io/client-go/util/homedir"
 )
 
 var (
-	sseMode bool
-	ssePort int
+	sseMode     bool
+	ssePort     int
+	mcpOperator bool
+
+	registryBackend   string
+	registryPath      string
+	registryNamespace string
+	registryOwner     string
+
+	configPath string
 )
 
 // mcpCmd represents the mcp command
@@ -19,6 +35,14 @@ var mcpCmd = &cobra.Command{
 	Long: `Start an MCP server that provides sandbox management tools including:
 - create_sandbox: Create a new sandbox environment for code execution
 - run_code: Execute code in an existing sandbox environment  
+- run_project: Run a multi-file project in an existing sandbox
+- install_packages: Install packages in an existing sandbox
+- snapshot_sandbox: Capture a sandbox's workspace as a snapshot
+- fork_sandbox: Create a new sandbox with a copy of an existing sandbox's workspace
+- clone_repo: Clone a git repository into a sandbox workspace
+- apply_patch: Apply a unified diff to a cloned repository
+- git_diff: Show the changes to a cloned repository since checkout
+- run_tests: Run a project's tests and report each result
 - destroy_sandbox: Destroy a sandbox and clean up resources
 - list_sandboxes: List all active sandbox environments
 
@@ -34,10 +58,70 @@ Examples:
   sandboxed mcp --sse
 
   # Start in SSE mode on custom port
-  sandboxed mcp --sse --port 9000`,
+  sandboxed mcp --sse --port 9000
+
+  # Keep track of sandboxes across restarts in a local database
+  sandboxed mcp --registry file --registry-path ~/.sandboxed/registry.db
+
+  # Discover sandboxes from pod labels in the cluster
+  sandboxed mcp --registry kubernetes --registry-namespace sandboxes
+
+  # Mount shared package caches and offer environment templates from a file
+  sandboxed mcp --config /etc/sandboxed/config.yaml
+
+  # Create sandboxes on a specific cluster
+  sandboxed mcp --kubeconfig ~/.kube/staging --context sandboxes`,
 	Run: func(cmd *cobra.Command, args []string) {
+		// Without cluster flags the client is created on first use, so the
+		// server starts even when no cluster is reachable yet
+		var client *k8sclient.Client
+		if clusterFlagsSet() {
+			var err error
+			client, err = newKubeClient("")
+			if err != nil {
+				log.Fatalf("Failed to create Kubernetes client: %v", err)
+			}
+			sdk.SetDefaultClient(client)
+		}
+
+		reg, regClient, err := openRegistry(registryBackend)
+		if err != nil {
+			log.Fatalf("Failed to open sandbox registry: %v", err)
+		}
+		if regClient != nil {
+			client = regClient
+		}
+
+		sandboxManager, err := mcp.NewSandboxManagerWithRegistry(reg, registryOwner, client)
+		if err != nil {
+			log.Fatalf("Failed to restore sandboxes: %v", err)
+		}
+		defer sandboxManager.Close()
+
+		cfg, err := config.Load(configPath)
+		if err == nil {
+			err = cfg.RegisterTemplates()
+		}
+		if err == nil {
+			err = cfg.ApplyOutputLimits()
+		}
+		if err == nil {
+			err = cfg.ApplySnapshotLimits()
+		}
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		sandboxManager.SetConfig(cfg)
+		sandboxManager.SetOperator(mcpOperator)
+
+		snapshots, err := cfg.SnapshotStore()
+		if err != nil {
+			log.Fatalf("Failed to open snapshot store: %v", err)
+		}
+		sandboxManager.SetSnapshotStore(snapshots)
+
 		// Create MCP server
-		server := mcp.NewServer()
+		server := mcp.NewServerWithManager(sandboxManager)
 
 		if sseMode {
 			// Start SSE server
@@ -61,4 +145,41 @@ func init() {
 	// Add flags for SSE mode
 	mcpCmd.Flags().BoolVar(&sseMode, "sse", false, "Start server in SSE (Server-Sent Events) mode for web clients")
 	mcpCmd.Flags().IntVar(&ssePort, "port", 8080, "Port to listen on when in SSE mode")
+
+	// Add flags for the sandbox registry
+	mcpCmd.Flags().StringVar(&registryBackend, "registry", "memory", "Sandbox registry backend: memory, file or kubernetes")
+	mcpCmd.Flags().StringVar(&registryPath, "registry-path", defaultRegistryPath(), "Database file used by the file registry")
+	mcpCmd.Flags().StringVar(&registryNamespace, "registry-namespace", "default", "Namespace recorded for sandboxes created without one by the kubernetes registry")
+	mcpCmd.Flags().StringVar(&configPath, "config", "", "Operator configuration file (YAML or JSON) with package cache volumes and environment templates")
+	mcpCmd.Flags().BoolVar(&mcpOperator, "operator", false, "Create sandboxes as Sandbox resources reconciled by 'sandboxed operator'")
+	mcpCmd.Flags().StringVar(&registryOwner, "owner", os.Getenv("USER"), "Owner recorded on sandboxes; only this owner's sandboxes are restored")
+}
+
+// openRegistry opens the registry backend and returns the client it uses,
+// if any, for the sandboxes it rehydrates
+func openRegistry(backend string) (registry.Registry, *k8sclient.Client, error) {
+	switch backend {
+	case "memory":
+		return registry.NewMemory(), nil, nil
+	case "file":
+		reg, err := registry.NewBolt(registryPath)
+		return reg, nil, err
+	case "kubernetes":
+		client, err := newKubeClient(registryNamespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Sandboxes share the registry's client and its connections
+		sdk.SetDefaultClient(client)
+		return registry.NewKubernetes(client, registryNamespace), client, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown registry backend %q (expected memory, file or kubernetes)", backend)
+	}
+}
+
+func defaultRegistryPath() string {
+	if home := homedir.HomeDir(); home != "" {
+		return filepath.Join(home, ".sandboxed", "registry.db")
+	}
+	return "sandboxed-registry.db"
 }
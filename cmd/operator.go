@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"github.com/system32-ai/sandboxed/pkg/operator"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+)
+
+var (
+	operatorNamespace  string
+	operatorWorkers    int
+	operatorResync     time.Duration
+	operatorConfigPath string
+)
+
+// operatorCmd runs the Sandbox controller
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Run the Sandbox custom resource controller",
+	Long: `Run a controller that turns Sandbox custom resources into sandbox pods.
+
+The controller owns each sandbox's pod and NetworkPolicy, provisions
+environment templates, reports status and deletes sandboxes whose TTL has
+run out. Install the CRD first:
+
+  sandboxed operator crd | kubectl apply -f -
+
+Examples:
+  # Reconcile sandboxes in every namespace
+  sandboxed operator
+
+  # Reconcile one namespace, with templates and caches from a config file
+  sandboxed operator --namespace sandboxes --config /etc/sandboxed/config.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(operatorConfigPath)
+		if err == nil {
+			err = cfg.RegisterTemplates()
+		}
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		client, err := newKubeClient(operatorNamespace)
+		if err != nil {
+			log.Fatalf("Failed to create Kubernetes client: %v", err)
+		}
+		dyn, err := client.Dynamic()
+		if err != nil {
+			log.Fatalf("Failed to create Kubernetes client: %v", err)
+		}
+
+		controller := &operator.Controller{
+			Reconciler: &operator.Reconciler{
+				Client:    dyn,
+				Config:    cfg,
+				Provision: provisionSandbox(client),
+			},
+			Namespace: operatorNamespace,
+			Workers:   operatorWorkers,
+			Resync:    operatorResync,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		scope := operatorNamespace
+		if scope == "" {
+			scope = "all namespaces"
+		}
+		log.Printf("Reconciling sandboxes in %s with %d worker(s)", scope, operatorWorkers)
+		if err := controller.Run(ctx); err != nil {
+			log.Fatalf("Operator failed: %v", err)
+		}
+	},
+}
+
+var operatorCRDCmd = &cobra.Command{
+	Use:   "crd",
+	Short: "Print the Sandbox CustomResourceDefinition",
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Stdout.Write(operator.CRD())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(operatorCmd)
+	operatorCmd.AddCommand(operatorCRDCmd)
+
+	operatorCmd.Flags().StringVar(&operatorNamespace, "namespace", "", "Namespace to watch (default all namespaces)")
+	operatorCmd.Flags().IntVar(&operatorWorkers, "workers", 4, "Number of sandboxes reconciled concurrently")
+	operatorCmd.Flags().DurationVar(&operatorResync, "resync", 10*time.Minute, "Interval at which every sandbox is reconciled again")
+	operatorCmd.Flags().StringVar(&operatorConfigPath, "config", "", "Operator configuration file (YAML or JSON) with package cache volumes and environment templates")
+}
+
+// provisionSandbox applies a template to a sandbox pod through the SDK
+func provisionSandbox(client *k8sclient.Client) func(context.Context, *operator.Sandbox, templates.Template) error {
+	return func(ctx context.Context, sandbox *operator.Sandbox, tpl templates.Template) error {
+		handle, err := sdk.Reattach(sdk.SandboxInfo{
+			ID:        operator.PodName(sandbox.Name),
+			Name:      sandbox.Name,
+			Language:  sdk.Language(tpl.Language),
+			Namespace: sandbox.Namespace,
+		}, sdk.WithClient(client))
+		if err != nil {
+			return err
+		}
+		return sdk.ApplyTemplate(handle, tpl)
+	}
+}
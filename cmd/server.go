@@ -1,34 +1,62 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/jobs"
 	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"github.com/system32-ai/sandboxed/pkg/operator"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+	"github.com/system32-ai/sandboxed/pkg/snapshot"
+	"github.com/system32-ai/sandboxed/pkg/webhook"
 )
 
 // ExecuteRequest represents a code execution request
 type ExecuteRequest struct {
-	Language  string            `json:"language" binding:"required"`
-	Code      string            `json:"code" binding:"required"`
-	Namespace string            `json:"namespace,omitempty"`
-	Labels    map[string]string `json:"labels,omitempty"`
+	Language    string            `json:"language" binding:"required"`
+	Code        string            `json:"code" binding:"required"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	// Placement picks the cluster for one-shot executions, or names the
+	// cluster running the sandbox when executing in one
+	PlacementRequest
 }
 
 // SandboxRequest represents a sandbox creation request
 type SandboxRequest struct {
-	Language  string            `json:"language" binding:"required"`
+	Language string `json:"language,omitempty"`
+	// Template names an environment template from the server config; it
+	// supplies the language when Language is empty
+	Template  string            `json:"template,omitempty"`
 	Namespace string            `json:"namespace,omitempty"`
 	Labels    map[string]string `json:"labels,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	// Secrets are resolved in the cluster; their values are never returned
+	Secrets []k8sclient.SecretRef `json:"secrets,omitempty"`
+	// Snapshot seeds the workspace from a stored snapshot, whose language
+	// is used when neither Language nor Template is set
+	Snapshot string `json:"snapshot,omitempty"`
+	PlacementRequest
 }
 
 // SandboxResponse represents a sandbox creation response
 type SandboxResponse struct {
 	Success   bool   `json:"success"`
 	SandboxID string `json:"sandbox_id,omitempty"`
+	// Cluster is where the sandbox was placed
+	Cluster   string `json:"cluster,omitempty"`
 	Error     string `json:"error,omitempty"`
 	Timestamp string `json:"timestamp"`
 }
@@ -38,15 +66,23 @@ type PodListResponse struct {
 	Pods []PodInfo `json:"pods"`
 }
 
-func setupRoutes(r *gin.Engine, k8sClient *k8sclient.Client) {
+func setupRoutes(r *gin.Engine, clusters *cluster.Pool, cfg *config.Config, snapshots snapshot.Store, operatorMode bool, jobManager *jobs.Manager, notifier *webhook.Notifier) {
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
+		health := gin.H{
 			"status":        "healthy",
 			"timestamp":     time.Now().Format(time.RFC3339),
 			"version":       "1.0.0",
-			"k8s_available": k8sClient != nil,
-		})
+			"k8s_available": clusters != nil,
+		}
+		if clusters != nil {
+			names := make([]string, 0, len(clusters.Clusters()))
+			for _, cl := range clusters.Clusters() {
+				names = append(names, cl.Name)
+			}
+			health["clusters"] = names
+		}
+		c.JSON(http.StatusOK, health)
 	})
 
 	// API documentation endpoint
@@ -61,30 +97,94 @@ func setupRoutes(r *gin.Engine, k8sClient *k8sclient.Client) {
 				"sandbox_create":  "POST /api/v1/sandbox/create - Create sandbox",
 				"sandbox_execute": "POST /api/v1/execute/:sandboxID - Execute in sandbox",
 				"sandbox_destroy": "POST /api/v1/sandbox/destroy - Destroy sandbox",
+				"project_run":     "POST /api/v1/sandboxes/:id/project - Run a multi-file project in sandbox",
+				"packages":        "POST /api/v1/sandboxes/:id/packages - Install packages in sandbox",
+				"tests":           "POST /api/v1/sandboxes/:id/tests - Run tests in sandbox with per-test results",
+				"fork":            "POST /api/v1/sandboxes/:id/fork - Fork sandbox with its workspace and packages",
+				"logs":            "GET /api/v1/sandboxes/:id/logs - Get sandbox logs; follow=true streams them as SSE",
+				"files":           "GET /api/v1/sandboxes/:id/files?path=... - Download a file from sandbox, such as a run's full output",
+				"ports":           "ANY /api/v1/sandboxes/:id/ports/:port/*path - Proxy HTTP and WebSockets to a port in sandbox",
+				"snapshot":        "GET /api/v1/sandboxes/:id/snapshot - Download sandbox workspace as tar.gz",
+				"snapshot_create": "POST /api/v1/sandboxes/:id/snapshots - Store sandbox workspace snapshot",
+				"snapshot_get":    "GET /api/v1/snapshots/:id - Download stored snapshot",
+				"snapshot_delete": "DELETE /api/v1/snapshots/:id - Delete stored snapshot",
+				"job_create":      "POST /api/v1/jobs - Execute code asynchronously",
+				"job_status":      "GET /api/v1/jobs/:id - Get job status and output",
+				"job_cancel":      "DELETE /api/v1/jobs/:id - Cancel job",
 			},
 		})
 	})
 
 	// Direct code execution endpoint
 	r.POST("/execute", func(c *gin.Context) {
-		executeCodeHandler(c, k8sClient)
+		executeCodeHandler(c, clusters, notifier)
 	})
 
 	// API v1 group
-	if k8sClient != nil {
+	if clusters != nil {
 		v1 := r.Group("/api/v1")
 		{
 			// Sandbox endpoints
 			v1.POST("/sandbox/create", func(c *gin.Context) {
-				createSandboxHandler(c, k8sClient)
+				createSandboxHandler(c, clusters, cfg, snapshots, operatorMode)
 			})
 			v1.POST("/execute/:sandboxID", func(c *gin.Context) {
-				executeInSandboxHandler(c, k8sClient)
+				executeInSandboxHandler(c, clusters)
 			})
 			v1.POST("/sandbox/destroy", func(c *gin.Context) {
-				destroySandboxHandler(c, k8sClient)
+				destroySandboxHandler(c, clusters)
+			})
+
+			// Multi-file project endpoint
+			v1.POST("/sandboxes/:id/project", func(c *gin.Context) {
+				runProjectHandler(c, clusters)
+			})
+			v1.POST("/sandboxes/:id/packages", func(c *gin.Context) {
+				installPackagesHandler(c, clusters)
+			})
+			v1.POST("/sandboxes/:id/tests", func(c *gin.Context) {
+				runTestsHandler(c, clusters)
+			})
+			v1.POST("/sandboxes/:id/fork", func(c *gin.Context) {
+				forkSandboxHandler(c, clusters, cfg, operatorMode)
+			})
+			v1.GET("/sandboxes/:id/logs", func(c *gin.Context) {
+				sandboxLogsHandler(c, clusters)
+			})
+			v1.GET("/sandboxes/:id/files", func(c *gin.Context) {
+				downloadFileHandler(c, clusters)
+			})
+
+			// Workspace snapshots
+			v1.GET("/sandboxes/:id/snapshot", func(c *gin.Context) {
+				downloadSandboxSnapshotHandler(c, clusters)
+			})
+			v1.POST("/sandboxes/:id/snapshots", func(c *gin.Context) {
+				createSnapshotHandler(c, clusters, snapshots)
+			})
+			v1.GET("/snapshots/:id", func(c *gin.Context) {
+				getSnapshotHandler(c, snapshots)
+			})
+			v1.DELETE("/snapshots/:id", func(c *gin.Context) {
+				deleteSnapshotHandler(c, snapshots)
+			})
+
+			// Preview servers running inside sandboxes
+			forwards := newPortForwards(portForwardIdleTimeout)
+			v1.Any("/sandboxes/:id/ports/:port/*path", func(c *gin.Context) {
+				proxyPortHandler(c, clusters, forwards)
 			})
 
+			// Asynchronous execution endpoints
+			v1.POST("/jobs", func(c *gin.Context) {
+				createJobHandler(c, clusters, jobManager)
+			})
+			v1.GET("/jobs/:id", func(c *gin.Context) {
+				getJobHandler(c, jobManager)
+			})
+			v1.DELETE("/jobs/:id", func(c *gin.Context) {
+				cancelJobHandler(c, jobManager)
+			})
 		}
 	}
 }
@@ -104,7 +204,7 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-func createSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
+func createSandboxHandler(c *gin.Context, clusters *cluster.Pool, cfg *config.Config, snapshots snapshot.Store, operatorMode bool) {
 	var req SandboxRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, SandboxResponse{
@@ -115,6 +215,45 @@ func createSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
+	// A template supplies the language, image and environment
+	var tpl templates.Template
+	if req.Template != "" {
+		var err error
+		tpl, err = templates.TemplateLookup(req.Template)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, SandboxResponse{
+				Success:   false,
+				Error:     err.Error(),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+
+		if req.Language == "" {
+			req.Language = tpl.Language
+		} else if canonicalLanguage(req.Language) != tpl.Language {
+			c.JSON(http.StatusBadRequest, SandboxResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Template %s is for %s, not %s", tpl.Name, tpl.Language, req.Language),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+	}
+
+	var archive []byte
+	if req.Snapshot != "" {
+		var info snapshot.Info
+		var ok bool
+		info, archive, ok = loadSnapshot(c, snapshots, req.Snapshot)
+		if !ok {
+			return
+		}
+		if req.Language == "" {
+			req.Language = info.Language
+		}
+	}
+
 	// Create sandbox pod
 	sandboxID := fmt.Sprintf("sandbox-%d", time.Now().Unix())
 	image := getImageForLanguage(req.Language)
@@ -127,6 +266,16 @@ func createSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
+	target, ok := placeRequest(c, clusters, req.PlacementRequest)
+	if !ok {
+		return
+	}
+	if operatorMode {
+		createSandboxResource(c, target, req, sandboxID, archive)
+		return
+	}
+	k8sClient := target.Client
+
 	labels := map[string]string{
 		"app":        "sandbox",
 		"language":   req.Language,
@@ -139,15 +288,40 @@ func createSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		labels[k] = v
 	}
 
+	// Label the pod so the SDK and registries can discover and reattach to it
+	labels[k8sclient.LabelManaged] = "true"
+	labels[k8sclient.LabelName] = sandboxID
+	labels[k8sclient.LabelCluster] = target.Name
+	if lang, err := sdk.ToLanguage(canonicalLanguage(req.Language)); err == nil {
+		labels[k8sclient.LabelLanguage] = string(lang)
+	}
+
+	// Mount the shared package caches configured for the language
+	volumes, err := cfg.CacheVolumes(canonicalLanguage(req.Language))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid cache configuration: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
 	spec := k8sclient.PodSpec{
 		Name:      sandboxID,
 		Namespace: req.Namespace,
 		Image:     image,
 		Command:   []string{"sleep", "3600"}, // Keep container running
 		Labels:    labels,
+		Volumes:   volumes,
+		Env:       req.Env,
+		Secrets:   req.Secrets,
+	}
+	if req.Template != "" {
+		tpl.Apply(&spec)
 	}
 
-	_, err := k8sClient.CreatePod(spec)
+	_, err = k8sClient.CreatePod(spec)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, SandboxResponse{
 			Success:   false,
@@ -168,14 +342,36 @@ func createSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
+	// Install the template's packages and run its setup commands, then seed
+	// the workspace
+	if req.Template != "" || archive != nil {
+		sandbox, err := attachSandbox(k8sClient, sandboxID, req.Namespace)
+		if err == nil && req.Template != "" {
+			err = sdk.ApplyTemplate(sandbox, tpl)
+		}
+		if err == nil && archive != nil {
+			err = sandbox.Restore(archive)
+		}
+		if err != nil {
+			_ = k8sClient.ForceDeletePod(sandboxID, req.Namespace)
+			c.JSON(http.StatusInternalServerError, SandboxResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to set up sandbox: %v", err),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusCreated, SandboxResponse{
 		Success:   true,
 		SandboxID: sandboxID,
+		Cluster:   target.Name,
 		Timestamp: time.Now().Format(time.RFC3339),
 	})
 }
 
-func executeInSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
+func executeInSandboxHandler(c *gin.Context, clusters *cluster.Pool) {
 	sandboxID := c.Param("sandboxID")
 
 	var req ExecuteRequest
@@ -189,7 +385,7 @@ func executeInSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 	}
 
 	// Execute code in existing sandbox
-	command := getCommandForLanguage(req.Language, req.Code)
+	filename, command := getProgramForLanguage(req.Language)
 	if len(command) == 0 {
 		c.JSON(http.StatusBadRequest, ExecuteResponse{
 			Success:   false,
@@ -199,8 +395,49 @@ func executeInSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
-	output, err := k8sClient.ExecCommand(sandboxID, req.Namespace, command)
+	if err := k8sclient.ValidateEnv(req.Env); err != nil {
+		c.JSON(http.StatusBadRequest, ExecuteResponse{
+			Success:   false,
+			Error:     err.Error(),
+			PodName:   sandboxID,
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	k8sClient, ok := sandboxClient(c, clusters, req.Cluster, sandboxID, req.Namespace)
+	if !ok {
+		return
+	}
+
+	// Each execution gets its own directory so concurrent requests don't
+	// clobber each other. It is removed afterwards, even when the request is
+	// cancelled.
+	dir := fmt.Sprintf("/tmp/exec-%d", time.Now().UnixNano())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := k8sClient.RemoveFromPod(ctx, sandboxID, req.Namespace, dir); err != nil {
+			log.Printf("sandbox %s: %v", sandboxID, err)
+		}
+	}()
+	err := k8sClient.CopyFilesToPodContext(c.Request.Context(), sandboxID, req.Namespace, dir, []k8sclient.File{
+		{Path: filename, Content: []byte(req.Code)},
+	})
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, ExecuteResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to deliver code: %v", err),
+			PodName:   sandboxID,
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	// Secret values referenced by the sandbox are redacted from the output
+	command = k8sclient.WithEnv(req.Env, append(command, dir+"/"+filename))
+	output, err := k8sClient.ExecCommandOutputRedactedContext(c.Request.Context(), sandboxID, req.Namespace, command)
+	if output == nil {
 		c.JSON(http.StatusInternalServerError, ExecuteResponse{
 			Success:   false,
 			Error:     fmt.Sprintf("Execution failed: %v", err),
@@ -210,19 +447,32 @@ func executeInSandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
-	c.JSON(http.StatusOK, ExecuteResponse{
-		Success:   true,
-		Output:    []string{output},
-		PodName:   sandboxID,
-		Timestamp: time.Now().Format(time.RFC3339),
-	})
+	// A non-zero exit is the code's result, not a server failure
+	status := http.StatusOK
+	resp := ExecuteResponse{
+		Success:    err == nil,
+		Output:     []string{output.Text},
+		Truncated:  output.Truncated,
+		OutputFile: output.SpillFile,
+		PodName:    sandboxID,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	}
+	if exitCode, ok := k8sclient.ExitCode(err); ok {
+		resp.ExitCode = exitCode
+		resp.Error = fmt.Sprintf("command terminated with exit code %d", exitCode)
+	} else if err != nil {
+		status = http.StatusInternalServerError
+		resp.Error = fmt.Sprintf("Execution failed: %v", err)
+	}
+	c.JSON(status, resp)
 }
 
-func destroySandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
+func destroySandboxHandler(c *gin.Context, clusters *cluster.Pool) {
 	type DestroyRequest struct {
 		SandboxID string `json:"sandbox_id" binding:"required"`
 		Namespace string `json:"namespace,omitempty"`
 		Force     bool   `json:"force,omitempty"`
+		Cluster   string `json:"cluster,omitempty"`
 	}
 
 	var req DestroyRequest
@@ -234,13 +484,13 @@ func destroySandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
-	var err error
-	if req.Force {
-		err = k8sClient.ForceDeletePod(req.SandboxID, req.Namespace)
-	} else {
-		err = k8sClient.DeletePod(req.SandboxID, req.Namespace)
+	k8sClient, ok := sandboxClient(c, clusters, req.Cluster, req.SandboxID, req.Namespace)
+	if !ok {
+		return
 	}
 
+	// Sandboxes created by the operator are destroyed through their resource
+	err := operator.DestroyPod(c.Request.Context(), k8sClient, req.SandboxID, req.Namespace, req.Force)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -255,12 +505,12 @@ func destroySandboxHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 	})
 }
 
-func executeCode(k8sClient *k8sclient.Client, req ExecuteRequest) ExecuteResponse {
+func executeCode(ctx context.Context, k8sClient *k8sclient.Client, req ExecuteRequest) ExecuteResponse {
 	// Determine image and command based on language
 	image := getImageForLanguage(req.Language)
-	commands := getCommandsForLanguage(req.Language, req.Code)
+	filename, command := getProgramForLanguage(req.Language)
 
-	if image == "" || len(commands) == 0 {
+	if image == "" || len(command) == 0 {
 		return ExecuteResponse{
 			Success:   false,
 			Error:     fmt.Sprintf("Unsupported language: %s. Supported: python, node, go, bash, ruby", req.Language),
@@ -268,8 +518,8 @@ func executeCode(k8sClient *k8sclient.Client, req ExecuteRequest) ExecuteRespons
 		}
 	}
 
-	// Create pod spec
-	podName := fmt.Sprintf("api-exec-%d", time.Now().Unix())
+	// Run the program as a one-shot job
+	jobName := fmt.Sprintf("api-exec-%d", time.Now().UnixNano())
 	labels := map[string]string{
 		"app":        "api-execution",
 		"language":   req.Language,
@@ -281,32 +531,64 @@ func executeCode(k8sClient *k8sclient.Client, req ExecuteRequest) ExecuteRespons
 		labels[k] = v
 	}
 
-	spec := k8sclient.PodSpec{
-		Name:      podName,
-		Namespace: req.Namespace,
-		Image:     image,
-		Labels:    labels,
+	// The program is the job's command, so the pod exits when it does
+	spec := k8sclient.JobSpec{
+		PodSpec: k8sclient.PodSpec{
+			Name:      jobName,
+			Namespace: req.Namespace,
+			Image:     image,
+			Command:   append(command, programDir+"/"+filename),
+			Labels:    labels,
+			Env:       req.Env,
+		},
+		Dir:   programDir,
+		Files: []k8sclient.File{{Path: filename, Content: []byte(req.Code)}},
 	}
 
-	// Execute code in pod
-	results, err := k8sClient.CreateAndRunPod(spec, commands, true) // cleanup = true
+	result, err := k8sClient.RunJob(ctx, spec)
 	if err != nil {
-		return ExecuteResponse{
+		resp := ExecuteResponse{
 			Success:   false,
 			Error:     fmt.Sprintf("Execution failed: %v", err),
-			PodName:   podName,
+			PodName:   jobName,
 			Timestamp: time.Now().Format(time.RFC3339),
 		}
+		if result != nil {
+			resp.Output = []string{result.Output}
+			resp.Truncated = result.Truncated
+			resp.ExitCode = result.ExitCode
+			resp.PodName = result.PodName
+		}
+		return resp
 	}
 
 	return ExecuteResponse{
 		Success:   true,
-		Output:    results,
-		PodName:   podName,
+		Output:    []string{result.Output},
+		Truncated: result.Truncated,
+		PodName:   result.PodName,
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 }
 
+// canonicalLanguage maps the language aliases accepted by the API to SDK language keys
+func canonicalLanguage(language string) string {
+	switch language {
+	case "py":
+		return "python"
+	case "nodejs", "js":
+		return "node"
+	case "golang":
+		return "go"
+	case "rb":
+		return "ruby"
+	case "sh":
+		return "bash"
+	default:
+		return language
+	}
+}
+
 func getImageForLanguage(language string) string {
 	switch language {
 	case "python", "py":
@@ -324,37 +606,26 @@ func getImageForLanguage(language string) string {
 	}
 }
 
-func getCommandsForLanguage(language, code string) [][]string {
-	switch language {
-	case "python", "py":
-		return [][]string{{"python", "-c", code}}
-	case "node", "nodejs", "js":
-		return [][]string{{"node", "-e", code}}
-	case "go", "golang":
-		return [][]string{{"sh", "-c", fmt.Sprintf("echo '%s' > /tmp/main.go && cd /tmp && go run main.go", code)}}
-	case "bash", "sh":
-		return [][]string{{"sh", "-c", code}}
-	case "ruby", "rb":
-		return [][]string{{"ruby", "-e", code}}
-	default:
-		return nil
-	}
-}
+// programDir is where one-shot executions deliver their code
+const programDir = "/tmp/program"
 
-func getCommandForLanguage(language, code string) []string {
+// getProgramForLanguage returns the file name code is delivered as and the
+// command that runs it; the file's path is appended as the last argument.
+// Code is never interpolated into a command line.
+func getProgramForLanguage(language string) (string, []string) {
 	switch language {
 	case "python", "py":
-		return []string{"python", "-c", code}
+		return "main.py", []string{"python"}
 	case "node", "nodejs", "js":
-		return []string{"node", "-e", code}
+		return "main.js", []string{"node"}
 	case "go", "golang":
-		return []string{"sh", "-c", fmt.Sprintf("echo '%s' > /tmp/main.go && cd /tmp && go run main.go", code)}
+		return "main.go", []string{"go", "run"}
 	case "bash", "sh":
-		return []string{"sh", "-c", code}
+		return "main.sh", []string{"sh"}
 	case "ruby", "rb":
-		return []string{"ruby", "-e", code}
+		return "main.rb", []string{"ruby"}
 	default:
-		return nil
+		return "", nil
 	}
 }
 
@@ -372,15 +643,29 @@ func init() {
 	serverCmd.Flags().IntP("port", "p", 8080, "Port to run the server on")
 	serverCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
 	serverCmd.Flags().StringP("namespace", "n", "", "Default Kubernetes namespace")
+	serverCmd.Flags().Int("job-workers", 4, "Number of asynchronous jobs executed concurrently")
+	serverCmd.Flags().Int("job-queue-size", 100, "Maximum number of asynchronous jobs waiting for a worker")
+	serverCmd.Flags().String("webhook-secret", os.Getenv("SANDBOXED_WEBHOOK_SECRET"), "Secret used to HMAC-sign callback payloads (env SANDBOXED_WEBHOOK_SECRET)")
+	serverCmd.Flags().Int("webhook-max-attempts", 5, "Maximum delivery attempts per callback")
+	serverCmd.Flags().Bool("webhook-allow-private", false, "Allow callbacks to loopback, link-local and private addresses")
+	serverCmd.Flags().String("config", "", "Operator configuration file (YAML or JSON) with package cache volumes, environment templates and clusters")
+	serverCmd.Flags().Bool("operator", false, "Create sandboxes as Sandbox resources reconciled by 'sandboxed operator'")
 }
 
 // ExecuteResponse represents a code execution response
 type ExecuteResponse struct {
-	Success   bool     `json:"success"`
-	Output    []string `json:"output,omitempty"`
-	Error     string   `json:"error,omitempty"`
-	PodName   string   `json:"pod_name,omitempty"`
-	Timestamp string   `json:"timestamp"`
+	Success bool     `json:"success"`
+	Output  []string `json:"output,omitempty"`
+	// Truncated is set when the middle of the output was dropped to fit the
+	// output limit
+	Truncated bool `json:"truncated,omitempty"`
+	// OutputFile is the file in the sandbox holding the full output of a
+	// truncated run, when the server is configured to keep it
+	OutputFile string `json:"output_file,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	Error      string `json:"error,omitempty"`
+	PodName    string `json:"pod_name,omitempty"`
+	Timestamp  string `json:"timestamp"`
 }
 
 // PodInfo represents basic pod information
@@ -400,17 +685,44 @@ var serverCmd = &cobra.Command{
 	
 The server provides endpoints for:
 - Code execution in Kubernetes pods
+- Asynchronous execution jobs with polling and cancellation
 - Pod management (list, create, delete)
 - Health checks
 
 Examples:
   sandboxed server                    # Start on default port 8080
   sandboxed server --port 3000       # Start on custom port
-  sandboxed server --debug           # Start in debug mode`,
+  sandboxed server --debug           # Start in debug mode
+  sandboxed server --context staging # Use a kubeconfig context
+  sandboxed server --config multi-cluster.yaml # Place sandboxes across clusters`,
 	Run: func(cmd *cobra.Command, args []string) {
 		port, _ := cmd.Flags().GetInt("port")
 		debug, _ := cmd.Flags().GetBool("debug")
 		namespace, _ := cmd.Flags().GetString("namespace")
+		jobWorkers, _ := cmd.Flags().GetInt("job-workers")
+		jobQueueSize, _ := cmd.Flags().GetInt("job-queue-size")
+		webhookSecret, _ := cmd.Flags().GetString("webhook-secret")
+		webhookMaxAttempts, _ := cmd.Flags().GetInt("webhook-max-attempts")
+		webhookAllowPrivate, _ := cmd.Flags().GetBool("webhook-allow-private")
+		configPath, _ := cmd.Flags().GetString("config")
+		operatorMode, _ := cmd.Flags().GetBool("operator")
+
+		// Templates are validated here so a bad config fails at start rather
+		// than on the first sandbox created from it
+		cfg, err := config.Load(configPath)
+		if err == nil {
+			err = cfg.RegisterTemplates()
+		}
+		if err == nil {
+			err = cfg.ApplyOutputLimits()
+		}
+		if err == nil {
+			err = cfg.ApplySnapshotLimits()
+		}
+		if err != nil {
+			fmt.Printf("Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Set gin mode
 		if !debug {
@@ -425,56 +737,44 @@ Examples:
 		r.Use(gin.Recovery())
 		r.Use(corsMiddleware())
 
-		// Initialize Kubernetes client
-		k8sClient, err := k8sclient.NewClient(namespace)
+		// Connect to the configured clusters, or to the one selected by the
+		// global flags
+		clusters, err := cfg.ClusterPool()
 		if err != nil {
-			fmt.Printf("Warning: Kubernetes client initialization failed: %v\n", err)
-			fmt.Println("Kubernetes endpoints will not be available")
-			k8sClient = nil
+			fmt.Printf("Failed to connect to clusters: %v\n", err)
+			os.Exit(1)
+		}
+		if clusters == nil {
+			k8sClient, err := newKubeClient(namespace)
+			if err != nil {
+				fmt.Printf("Warning: Kubernetes client initialization failed: %v\n", err)
+				fmt.Println("Kubernetes endpoints will not be available")
+			} else {
+				clusters = cluster.Single("default", k8sClient)
+			}
 		}
 
-		// Health check endpoint
-		r.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"status":    "healthy",
-				"timestamp": time.Now().Format(time.RFC3339),
-				"version":   "1.0.0",
-			})
-		})
+		// Callback delivery for finished executions
+		notifier := webhook.NewNotifier(webhookSecret)
+		notifier.MaxAttempts = webhookMaxAttempts
+		notifier.AllowPrivate = webhookAllowPrivate
+		if webhookSecret == "" {
+			fmt.Println("Warning: no webhook secret configured, requests with a callback_url will be rejected")
+		}
 
-		// Kubernetes pod endpoints
-		if k8sClient != nil {
-			k8sGroup := r.Group("/api/v1")
-			{
-				k8sGroup.GET("/sandbox/create", func(c *gin.Context) {
-					listPodsHandler(c, k8sClient)
-				})
-				k8sGroup.POST("/execute/:sandboxID", func(c *gin.Context) {
-					createPodHandler(c, k8sClient)
-				})
-				k8sGroup.POST("/sandbox/destroy", func(c *gin.Context) {
-					deletePodHandler(c, k8sClient)
-				})
-			}
+		// Worker pool for asynchronous jobs
+		jobManager := jobs.NewManager(jobWorkers, jobQueueSize)
+		jobManager.Notifier = notifier
+		defer jobManager.Stop()
+
+		// Snapshots can still be downloaded without a store
+		snapshots, err := cfg.SnapshotStore()
+		if err != nil {
+			fmt.Printf("Failed to open snapshot store: %v\n", err)
+			os.Exit(1)
 		}
 
-		// API documentation endpoint
-		r.GET("/", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"name":        "Sandboxed API",
-				"version":     "1.0.0",
-				"description": "Code execution and Kubernetes management API",
-				"endpoints": gin.H{
-					"health":     "GET /health - Health check",
-					"execute":    "POST /execute - Execute code",
-					"pods":       "GET /k8s/pods - List pods",
-					"create_pod": "POST /k8s/pods - Create pod",
-					"delete_pod": "DELETE /k8s/pods/:name - Delete pod",
-					"get_pod":    "GET /k8s/pods/:name - Get pod details",
-					"pod_logs":   "GET /k8s/pods/:name/logs - Get pod logs",
-				},
-			})
-		})
+		setupRoutes(r, clusters, cfg, snapshots, operatorMode, jobManager, notifier)
 
 		// Start server
 		addr := fmt.Sprintf(":%d", port)
@@ -482,7 +782,9 @@ Examples:
 		if debug {
 			fmt.Println("Debug mode enabled")
 		}
-		if k8sClient != nil {
+		if clusters != nil && len(clusters.Clusters()) > 1 {
+			fmt.Printf("Kubernetes integration enabled across %d clusters (placement: %s)\n", len(clusters.Clusters()), clusters.Policy())
+		} else if clusters != nil {
 			fmt.Printf("Kubernetes integration enabled (namespace: %s)\n", namespace)
 		}
 
@@ -492,8 +794,8 @@ Examples:
 	},
 }
 
-func executeCodeHandler(c *gin.Context, k8sClient *k8sclient.Client) {
-	if k8sClient == nil {
+func executeCodeHandler(c *gin.Context, clusters *cluster.Pool, notifier *webhook.Notifier) {
+	if clusters == nil {
 		c.JSON(http.StatusServiceUnavailable, ExecuteResponse{
 			Success:   false,
 			Error:     "Kubernetes client not available",
@@ -512,27 +814,7 @@ func executeCodeHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
-	// Determine image based on language
-	var image string
-	var commands [][]string
-
-	switch req.Language {
-	case "python", "py":
-		image = "python:3.9-slim"
-		commands = [][]string{{"python", "-c", req.Code}}
-	case "node", "nodejs", "js":
-		image = "node:18-slim"
-		commands = [][]string{{"node", "-e", req.Code}}
-	case "go", "golang":
-		image = "golang:1.21-alpine"
-		commands = [][]string{{"sh", "-c", fmt.Sprintf("echo '%s' > /tmp/main.go && cd /tmp && go run main.go", req.Code)}}
-	case "bash", "sh":
-		image = "alpine:latest"
-		commands = [][]string{{"sh", "-c", req.Code}}
-	case "ruby", "rb":
-		image = "ruby:3.0-slim"
-		commands = [][]string{{"ruby", "-e", req.Code}}
-	default:
+	if getImageForLanguage(req.Language) == "" {
 		c.JSON(http.StatusBadRequest, ExecuteResponse{
 			Success:   false,
 			Error:     fmt.Sprintf("Unsupported language: %s. Supported: python, node, go, bash, ruby", req.Language),
@@ -541,44 +823,33 @@ func executeCodeHandler(c *gin.Context, k8sClient *k8sclient.Client) {
 		return
 	}
 
-	// Create pod spec
-	podName := fmt.Sprintf("api-exec-%d", time.Now().Unix())
-	labels := map[string]string{
-		"app":        "api-execution",
-		"language":   req.Language,
-		"created-by": "sandboxed-api",
+	if req.CallbackURL != "" {
+		if err := notifier.Validate(req.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, ExecuteResponse{
+				Success:   false,
+				Error:     err.Error(),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
 	}
 
-	// Add custom labels
-	for k, v := range req.Labels {
-		labels[k] = v
+	target, ok := placeRequest(c, clusters, req.PlacementRequest)
+	if !ok {
+		return
 	}
 
-	spec := k8sclient.PodSpec{
-		Name:      podName,
-		Namespace: req.Namespace,
-		Image:     image,
-		Labels:    labels,
-	}
+	resp := executeCode(c.Request.Context(), target.Client, req)
 
-	// Execute code in pod
-	results, err := k8sClient.CreateAndRunPod(spec, commands, true) // cleanup = true
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ExecuteResponse{
-			Success:   false,
-			Error:     fmt.Sprintf("Execution failed: %v", err),
-			PodName:   podName,
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
+	if req.CallbackURL != "" {
+		go func() {
+			if err := notifier.Deliver(context.Background(), req.CallbackURL, resp, nil); err != nil {
+				log.Printf("execution %s: %v", resp.PodName, err)
+			}
+		}()
 	}
 
-	c.JSON(http.StatusOK, ExecuteResponse{
-		Success:   true,
-		Output:    results,
-		PodName:   podName,
-		Timestamp: time.Now().Format(time.RFC3339),
-	})
+	c.JSON(getStatusCode(resp.Success), resp)
 }
 
 func listPodsHandler(c *gin.Context, k8sClient *k8sclient.Client) {
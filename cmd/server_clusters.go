@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+)
+
+// PlacementRequest chooses the cluster for new pods in multi-cluster mode.
+// It is ignored when the server manages a single cluster.
+type PlacementRequest struct {
+	// Cluster names a configured cluster, bypassing the placement policy
+	Cluster string `json:"cluster,omitempty"`
+	// Tenant is required by the tenant placement policy
+	Tenant string `json:"tenant,omitempty"`
+	// ClusterSelector is matched against cluster labels by the label policy
+	ClusterSelector map[string]string `json:"cluster_selector,omitempty"`
+}
+
+func (p PlacementRequest) placement() cluster.Placement {
+	return cluster.Placement{Cluster: p.Cluster, Tenant: p.Tenant, Labels: p.ClusterSelector}
+}
+
+// placeRequest selects the cluster for a new pod, writing an error response
+// when none can take it
+func placeRequest(c *gin.Context, clusters *cluster.Pool, req PlacementRequest) (*cluster.Cluster, bool) {
+	target, err := clusters.Select(c.Request.Context(), req.placement())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, cluster.ErrNoCluster) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Failed to place sandbox: %v", err),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return nil, false
+	}
+	return target, true
+}
+
+// sandboxClient returns the client for the cluster running sandboxID, writing
+// a 404 when no cluster has it. Naming the cluster skips the search.
+func sandboxClient(c *gin.Context, clusters *cluster.Pool, clusterName, sandboxID, namespace string) (*k8sclient.Client, bool) {
+	target, err := findCluster(c.Request.Context(), clusters, clusterName, sandboxID, namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Sandbox not found: %v", err),
+			"pod_name":  sandboxID,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return nil, false
+	}
+	return target.Client, true
+}
+
+// findCluster returns the named cluster, or searches for the one running
+// sandboxID when no name is given
+func findCluster(ctx context.Context, clusters *cluster.Pool, clusterName, sandboxID, namespace string) (*cluster.Cluster, error) {
+	if clusterName != "" {
+		return clusters.Get(clusterName)
+	}
+	return clusters.Locate(ctx, sandboxID, namespace)
+}
+
+// locateSandbox reattaches to a sandbox on whichever cluster runs it
+func locateSandbox(ctx context.Context, clusters *cluster.Pool, clusterName, sandboxID, namespace string) (sdk.Sandboxed, error) {
+	target, err := findCluster(ctx, clusters, clusterName, sandboxID, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return attachSandbox(target.Client, sandboxID, namespace)
+}
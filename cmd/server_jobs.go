@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/jobs"
+)
+
+// JobResponse represents an asynchronous job response
+type JobResponse struct {
+	Success   bool      `json:"success"`
+	Job       *jobs.Job `json:"job,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp string    `json:"timestamp"`
+}
+
+func createJobHandler(c *gin.Context, clusters *cluster.Pool, jobManager *jobs.Manager) {
+	var req ExecuteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid request: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	if getImageForLanguage(req.Language) == "" {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Unsupported language: %s. Supported: python, node, go, bash, ruby", req.Language),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	target, ok := placeRequest(c, clusters, req.PlacementRequest)
+	if !ok {
+		return
+	}
+
+	var opts []jobs.SubmitOption
+	if req.CallbackURL != "" {
+		if err := jobManager.Notifier.Validate(req.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, JobResponse{
+				Success:   false,
+				Error:     err.Error(),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+		opts = append(opts, jobs.WithCallback(req.CallbackURL))
+	}
+
+	job, err := jobManager.Submit(func(ctx context.Context) (*jobs.Result, error) {
+		resp := executeCode(ctx, target.Client, req)
+		result := &jobs.Result{
+			Output:     resp.Output,
+			Truncated:  resp.Truncated,
+			OutputFile: resp.OutputFile,
+			ExitCode:   resp.ExitCode,
+		}
+		if !resp.Success {
+			return result, errors.New(resp.Error)
+		}
+		return result, nil
+	}, opts...)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrStopped) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, JobResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to submit job: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, JobResponse{
+		Success:   true,
+		Job:       &job,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+func getJobHandler(c *gin.Context, jobManager *jobs.Manager) {
+	job, err := jobManager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, JobResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, JobResponse{
+		Success:   true,
+		Job:       &job,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+func cancelJobHandler(c *gin.Context, jobManager *jobs.Manager) {
+	job, err := jobManager.Cancel(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, JobResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, JobResponse{
+		Success:   true,
+		Job:       &job,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// logOptionsFromQuery reads log options from the follow, tail_lines,
+// since_seconds, timestamps and container query parameters
+func logOptionsFromQuery(c *gin.Context) (k8sclient.LogOptions, error) {
+	opts := k8sclient.LogOptions{Container: c.Query("container")}
+
+	for name, dst := range map[string]*bool{"follow": &opts.Follow, "timestamps": &opts.Timestamps} {
+		if v := c.Query(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = b
+		}
+	}
+	if v := c.Query("tail_lines"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid tail_lines %q", v)
+		}
+		opts.TailLines = &n
+	}
+	if v := c.Query("since_seconds"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid since_seconds %q", v)
+		}
+		opts.SinceSeconds = n
+	}
+	return opts, nil
+}
+
+// sandboxLogsHandler returns a sandbox's logs. With follow=true the logs are
+// streamed as server-sent "log" events, one per line, until the sandbox
+// exits or the client disconnects; an "end" event closes the stream. Lines
+// longer than the output limit are sent in pieces.
+func sandboxLogsHandler(c *gin.Context, clusters *cluster.Pool) {
+	sandboxID := c.Param("id")
+	namespace := c.Query("namespace")
+
+	opts, err := logOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":   false,
+			"error":     err.Error(),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	k8sClient, ok := sandboxClient(c, clusters, c.Query("cluster"), sandboxID, namespace)
+	if !ok {
+		return
+	}
+
+	logs, err := k8sClient.StreamPodLogs(c.Request.Context(), sandboxID, namespace, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Failed to get logs: %v", err),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	defer logs.Close()
+
+	if !opts.Follow {
+		out := k8sclient.NewCappedBuffer(k8sclient.CurrentOutputLimits().Limit())
+		if _, err := io.Copy(out, logs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success":   false,
+				"error":     fmt.Sprintf("Failed to read logs: %v", err),
+				"timestamp": time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"sandbox_id": sandboxID,
+			"logs":       out.String(),
+			"truncated":  out.Truncated(),
+			"timestamp":  time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	// Lines are read on their own goroutine so the handler notices a
+	// disconnected client while the sandbox is quiet
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(logs)
+		limit := k8sclient.CurrentOutputLimits().Limit()
+		scanner.Buffer(make([]byte, 0, 4096), limit)
+		scanner.Split(splitLines(limit))
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		done <- err
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			c.SSEvent("log", line)
+			c.Writer.Flush()
+		case err := <-done:
+			end := gin.H{"sandbox_id": sandboxID}
+			if !errors.Is(err, io.EOF) {
+				end["error"] = err.Error()
+			}
+			c.SSEvent("end", end)
+			c.Writer.Flush()
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// splitLines splits like bufio.ScanLines, except that a line longer than max
+// bytes is sent in pieces rather than buffered whole
+func splitLines(max int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance > 0 || err != nil || len(data) < max {
+			return advance, token, err
+		}
+		// Cut before a character that would be split
+		cut := max
+		for i := max - 1; i >= 0 && i >= max-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:max]) && i > 0 {
+					cut = i
+				}
+				break
+			}
+		}
+		return cut, data[:cut], nil
+	}
+}
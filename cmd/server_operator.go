@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/operator"
+)
+
+// createSandboxResource hands sandbox creation to the operator: it submits a
+// Sandbox resource and waits for the operator to report it ready. The
+// operator builds the pod and provisions the template; a snapshot archive is
+// restored afterwards.
+func createSandboxResource(c *gin.Context, target *cluster.Cluster, req SandboxRequest, name string, archive []byte) {
+	dyn, err := target.Client.Dynamic()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create sandbox: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = target.Client.Namespace()
+	}
+
+	labels := map[string]string{
+		"created-by":           "sandboxed-api",
+		k8sclient.LabelCluster: target.Name,
+	}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+
+	sandbox := operator.New(name, namespace, operator.SandboxSpec{
+		Language: canonicalLanguage(req.Language),
+		Template: req.Template,
+		Env:      req.Env,
+		Secrets:  req.Secrets,
+	})
+	sandbox.Labels = labels
+
+	if err := operator.Create(c.Request.Context(), dyn, sandbox); err != nil {
+		c.JSON(http.StatusInternalServerError, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create sandbox: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	ready, err := operator.WaitReady(c.Request.Context(), dyn, namespace, name, 2*time.Minute)
+	if err != nil {
+		_ = operator.Delete(c.Request.Context(), dyn, namespace, name)
+		c.JSON(http.StatusInternalServerError, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not ready: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	// The workspace is seeded once the operator has provisioned the template
+	if archive != nil {
+		sandbox, err := attachSandbox(target.Client, ready.Status.PodName, namespace)
+		if err == nil {
+			err = sandbox.Restore(archive)
+		}
+		if err != nil {
+			_ = operator.Delete(c.Request.Context(), dyn, namespace, name)
+			c.JSON(http.StatusInternalServerError, SandboxResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to set up sandbox: %v", err),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+	}
+
+	// Executions address the pod, so its name is the sandbox ID
+	c.JSON(http.StatusCreated, SandboxResponse{
+		Success:   true,
+		SandboxID: ready.Status.PodName,
+		Cluster:   target.Name,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
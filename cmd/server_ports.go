@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// portForwardIdleTimeout is how long a forward with no request in flight is
+// kept open
+const portForwardIdleTimeout = 5 * time.Minute
+
+// errUnmanagedPod is returned for pods that were not created as sandboxes
+var errUnmanagedPod = errors.New("pod is not a sandbox")
+
+// portForwards shares port forwards between proxied requests. A forward is
+// replaced once its connection to the pod is lost, and closed once idle.
+type portForwards struct {
+	mu       sync.Mutex
+	forwards map[string]*sharedForward
+}
+
+// sharedForward counts the requests using a forward
+type sharedForward struct {
+	fw       *k8sclient.PortForward
+	active   int
+	lastUsed time.Time
+}
+
+// newPortForwards returns forwards that are closed after idle without
+// requests
+func newPortForwards(idle time.Duration) *portForwards {
+	f := &portForwards{forwards: make(map[string]*sharedForward)}
+	go func() {
+		for range time.Tick(idle / 2) {
+			f.closeIdle(idle)
+		}
+	}()
+	return f
+}
+
+// get returns a live forward to port in a sandbox, starting one if needed.
+// Only pods labelled as managed sandboxes are forwarded to. release must be
+// called once the request is done with the forward.
+func (f *portForwards) get(ctx context.Context, client *k8sclient.Client, key, sandboxID, namespace string, port int) (*k8sclient.PortForward, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shared, ok := f.forwards[key]
+	if ok {
+		select {
+		case <-shared.fw.Done():
+			ok = false
+		default:
+		}
+	}
+	if !ok {
+		pod, err := client.GetPodContext(ctx, sandboxID, namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pod.Labels[k8sclient.LabelManaged] != "true" {
+			return nil, nil, errUnmanagedPod
+		}
+
+		// The forward outlives the request that started it
+		fw, err := client.PortForward(context.WithoutCancel(ctx), sandboxID, namespace, port)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared = &sharedForward{fw: fw}
+		f.forwards[key] = shared
+	}
+
+	shared.active++
+	return shared.fw, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		shared.active--
+		shared.lastUsed = time.Now()
+	}, nil
+}
+
+// drop closes a forward that failed, unless it was already replaced
+func (f *portForwards) drop(key string, fw *k8sclient.PortForward) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if shared := f.forwards[key]; shared != nil && shared.fw == fw {
+		delete(f.forwards, key)
+	}
+	go fw.Close()
+}
+
+// closeIdle closes the forwards that no request has used for idle
+func (f *portForwards) closeIdle(idle time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, shared := range f.forwards {
+		if shared.active == 0 && time.Since(shared.lastUsed) > idle {
+			delete(f.forwards, key)
+			go shared.fw.Close()
+		}
+	}
+}
+
+// proxyPortHandler proxies a request, WebSocket upgrades included, to a port
+// inside a sandbox. The namespace and cluster query parameters locate the
+// sandbox and are not passed on, nor are the request's credentials.
+func proxyPortHandler(c *gin.Context, clusters *cluster.Pool, forwards *portForwards) {
+	sandboxID := c.Param("id")
+	namespace := c.Query("namespace")
+
+	port, err := strconv.Atoi(c.Param("port"))
+	if err != nil || port < 1 || port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Invalid port %q", c.Param("port")),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	target, err := findCluster(c.Request.Context(), clusters, c.Query("cluster"), sandboxID, namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Sandbox not found: %v", err),
+			"pod_name":  sandboxID,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	if namespace == "" {
+		namespace = target.Client.Namespace()
+	}
+
+	key := fmt.Sprintf("%s/%s/%s/%d", target.Name, namespace, sandboxID, port)
+	fw, release, err := forwards.get(c.Request.Context(), target.Client, key, sandboxID, namespace, port)
+	if errors.Is(err, errUnmanagedPod) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Sandbox not found: %v", err),
+			"pod_name":  sandboxID,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Failed to reach port %d: %v", port, err),
+			"pod_name":  sandboxID,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	defer release()
+
+	prefix := fmt.Sprintf("/api/v1/sandboxes/%s/ports/%d", sandboxID, port)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(&url.URL{Scheme: "http", Host: fw.Addr})
+			r.Out.URL.Path = c.Param("path")
+			r.Out.URL.RawPath = ""
+
+			query := r.Out.URL.Query()
+			query.Del("namespace")
+			query.Del("cluster")
+			r.Out.URL.RawQuery = query.Encode()
+
+			// Credentials for this server are not the sandbox's to see
+			r.Out.Header.Del("Authorization")
+			r.Out.Header.Del("Proxy-Authorization")
+			r.Out.Header.Del("Cookie")
+
+			r.SetXForwarded()
+			r.Out.Header.Set("X-Forwarded-Prefix", prefix)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			forwards.drop(key, fw)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"success":   false,
+				"error":     fmt.Sprintf("Failed to reach port %d: %v", port, err),
+				"pod_name":  sandboxID,
+				"timestamp": time.Now().Format(time.RFC3339),
+			})
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
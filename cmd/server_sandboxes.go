@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+	"github.com/system32-ai/sandboxed/pkg/testrun"
+)
+
+// ProjectRequest represents a multi-file project run request
+type ProjectRequest struct {
+	Files      map[string]string `json:"files,omitempty"`
+	Archive    []byte            `json:"archive,omitempty"` // base64 encoded tar, tar.gz or zip
+	Entrypoint string            `json:"entrypoint,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	// Cluster names the cluster running the sandbox in multi-cluster mode;
+	// every cluster is searched when empty
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// attachSandbox reattaches to a sandbox pod, defaulting to the server's namespace
+func attachSandbox(k8sClient *k8sclient.Client, sandboxID, namespace string) (sdk.Sandboxed, error) {
+	if namespace == "" {
+		namespace = k8sClient.Namespace()
+	}
+	return sdk.NewInstance(sandboxID, sdk.WithNamespace(namespace), sdk.WithClient(k8sClient))
+}
+
+func runProjectHandler(c *gin.Context, clusters *cluster.Pool) {
+	sandboxID := c.Param("id")
+
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ExecuteResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid request: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	sandbox, err := locateSandbox(c.Request.Context(), clusters, req.Cluster, sandboxID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ExecuteResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			PodName:   sandboxID,
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	files := make(map[string][]byte, len(req.Files))
+	for path, content := range req.Files {
+		files[path] = []byte(content)
+	}
+
+	output, err := sandbox.RunProject(sdk.Project{
+		Files:      files,
+		Archive:    req.Archive,
+		Entrypoint: req.Entrypoint,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ExecuteResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Project run failed: %v", err),
+			PodName:   sandboxID,
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ExecuteResponse{
+		Success:    output.ExitCode == 0,
+		Output:     []string{output.Result},
+		Truncated:  output.Truncated,
+		OutputFile: output.OutputFile,
+		ExitCode:   output.ExitCode,
+		Error:      output.Error,
+		PodName:    sandboxID,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	})
+}
+
+// InstallPackagesRequest represents a package installation request
+type InstallPackagesRequest struct {
+	Language  string   `json:"language,omitempty"` // defaults to the sandbox's language
+	Packages  []string `json:"packages" binding:"required"`
+	Namespace string   `json:"namespace,omitempty"`
+	Cluster   string   `json:"cluster,omitempty"`
+}
+
+// InstallPackagesResponse represents a package installation response
+type InstallPackagesResponse struct {
+	Success   bool          `json:"success"`
+	Language  string        `json:"language,omitempty"`
+	Packages  []string      `json:"packages,omitempty"`
+	Output    string        `json:"output,omitempty"`
+	ExitCode  int           `json:"exit_code"`
+	Installed []sdk.Package `json:"installed,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Timestamp string        `json:"timestamp"`
+}
+
+func installPackagesHandler(c *gin.Context, clusters *cluster.Pool) {
+	sandboxID := c.Param("id")
+
+	var req InstallPackagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, InstallPackagesResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid request: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	sandbox, err := locateSandbox(c.Request.Context(), clusters, req.Cluster, sandboxID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, InstallPackagesResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	lang := sdk.Language(canonicalLanguage(req.Language))
+	if lang == "" {
+		lang = sandbox.Info().Language
+	}
+	if err := validatePackageRequest(lang, req.Packages); err != nil {
+		c.JSON(http.StatusBadRequest, InstallPackagesResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	result, err := sandbox.InstallPackages(lang, req.Packages)
+	if err != nil && result == nil {
+		c.JSON(http.StatusInternalServerError, InstallPackagesResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Package installation failed: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	resp := InstallPackagesResponse{
+		Success:   result.Success,
+		Language:  string(result.Language),
+		Packages:  result.Packages,
+		Output:    result.Output,
+		ExitCode:  result.ExitCode,
+		Installed: sandbox.Info().Packages,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	} else if !result.Success {
+		resp.Error = fmt.Sprintf("package manager exited with code %d", result.ExitCode)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// validatePackageRequest rejects packages that cannot be installed for lang,
+// so that only failures inside the sandbox are reported as server errors
+func validatePackageRequest(lang sdk.Language, pkgs []string) error {
+	recipe, err := templates.RecipeLookup(string(lang))
+	if err != nil {
+		return err
+	}
+	if recipe.Install == "" {
+		return fmt.Errorf("no package manager configured for %s", lang)
+	}
+	return templates.ValidatePackages(pkgs)
+}
+
+// RunTestsRequest represents a request to run a project's tests
+type RunTestsRequest struct {
+	// Framework is detected from the project's files when empty
+	Framework string   `json:"framework,omitempty"`
+	Path      string   `json:"path,omitempty"` // relative to the workspace
+	Args      []string `json:"args,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	Cluster   string   `json:"cluster,omitempty"`
+}
+
+// RunTestsResponse represents the results of a test run
+type RunTestsResponse struct {
+	testrun.Result
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func runTestsHandler(c *gin.Context, clusters *cluster.Pool) {
+	sandboxID := c.Param("id")
+
+	var req RunTestsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength != 0 {
+		c.JSON(http.StatusBadRequest, RunTestsResponse{
+			Error:     fmt.Sprintf("Invalid request: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	opts := sdk.TestOptions{Path: req.Path, Args: req.Args}
+	if req.Framework != "" {
+		framework, err := testrun.ParseFramework(req.Framework)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, RunTestsResponse{
+				Error:     err.Error(),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+		opts.Framework = framework
+	}
+
+	sandbox, err := locateSandbox(c.Request.Context(), clusters, req.Cluster, sandboxID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, RunTestsResponse{
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	result, err := sandbox.RunTests(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, RunTestsResponse{
+			Error:     fmt.Sprintf("Test run failed: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, RunTestsResponse{
+		Result:    *result,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// ForkRequest represents a request to fork a sandbox
+type ForkRequest struct {
+	// Name names the fork; generated when empty
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+}
+
+// forkSandboxHandler creates a sandbox from the same template as another,
+// with its workspace and installed packages, on the source's cluster
+func forkSandboxHandler(c *gin.Context, clusters *cluster.Pool, cfg *config.Config, operatorMode bool) {
+	sandboxID := c.Param("id")
+
+	var req ForkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength != 0 {
+		c.JSON(http.StatusBadRequest, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid request: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	target, err := findCluster(c.Request.Context(), clusters, req.Cluster, sandboxID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	source, err := attachSandbox(target.Client, sandboxID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("fork-%d", time.Now().UnixNano())
+	}
+
+	var opts []sdk.SandboxOption
+	if operatorMode {
+		opts = append(opts, sdk.WithOperator())
+	} else {
+		volumes, err := cfg.CacheVolumes(string(source.Info().Language))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, SandboxResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Invalid cache configuration: %v", err),
+				Timestamp: time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+		if len(volumes) > 0 {
+			opts = append(opts, sdk.WithVolumes(volumes...))
+		}
+	}
+
+	fork, err := sdk.Fork(source, name, opts...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SandboxResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to fork sandbox: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, SandboxResponse{
+		Success:   true,
+		SandboxID: fork.Info().ID,
+		Cluster:   target.Name,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// downloadFileHandler streams a file from a sandbox, such as the full
+// output of a truncated run named by output_file
+func downloadFileHandler(c *gin.Context, clusters *cluster.Pool) {
+	sandboxID := c.Param("id")
+	namespace := c.Query("namespace")
+	file := c.Query("path")
+	if !path.IsAbs(file) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":   false,
+			"error":     "path must be an absolute file path",
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	k8sClient, ok := sandboxClient(c, clusters, c.Query("cluster"), sandboxID, namespace)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, path.Base(file)))
+	err := k8sClient.CopyFileFromPod(c.Request.Context(), sandboxID, namespace, file, c.Writer)
+	if err != nil && !c.Writer.Written() {
+		c.Header("Content-Type", "")
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success":   false,
+			"error":     fmt.Sprintf("Failed to download file: %v", err),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+	}
+}
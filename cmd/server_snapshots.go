@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+	"github.com/system32-ai/sandboxed/pkg/snapshot"
+)
+
+// SnapshotRequest represents a request to store a sandbox's workspace
+type SnapshotRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+}
+
+// SnapshotResponse describes a stored snapshot
+type SnapshotResponse struct {
+	Success   bool           `json:"success"`
+	Snapshot  *snapshot.Info `json:"snapshot,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Timestamp string         `json:"timestamp"`
+}
+
+// snapshotStatus maps snapshot store errors to HTTP statuses
+func snapshotStatus(err error) int {
+	if errors.Is(err, snapshot.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, snapshot.ErrTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// requireSnapshot writes an error when no snapshot store is configured or
+// id is not a valid snapshot ID
+func requireSnapshot(c *gin.Context, store snapshot.Store, id string) bool {
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, SnapshotResponse{
+			Success:   false,
+			Error:     "No snapshot store configured",
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return false
+	}
+	if err := snapshot.ValidateID(id); err != nil {
+		c.JSON(http.StatusBadRequest, SnapshotResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return false
+	}
+	return true
+}
+
+// writeArchive sends a snapshot archive as a download
+func writeArchive(c *gin.Context, name string, archive []byte) {
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tar.gz"`, name))
+	c.Data(http.StatusOK, "application/gzip", archive)
+}
+
+// downloadSandboxSnapshotHandler captures a sandbox's workspace and returns
+// it as a tar.gz download without storing it
+func downloadSandboxSnapshotHandler(c *gin.Context, clusters *cluster.Pool) {
+	sandboxID := c.Param("id")
+	namespace := c.Query("namespace")
+
+	sandbox, err := locateSandbox(c.Request.Context(), clusters, c.Query("cluster"), sandboxID, namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, SnapshotResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	archive, err := sandbox.Snapshot()
+	if err != nil {
+		c.JSON(snapshotStatus(err), SnapshotResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to snapshot sandbox: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	writeArchive(c, sandboxID, archive)
+}
+
+// createSnapshotHandler captures a sandbox's workspace into the snapshot store
+func createSnapshotHandler(c *gin.Context, clusters *cluster.Pool, store snapshot.Store) {
+	sandboxID := c.Param("id")
+
+	var req SnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength != 0 {
+		c.JSON(http.StatusBadRequest, SnapshotResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid request: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, SnapshotResponse{
+			Success:   false,
+			Error:     "No snapshot store configured",
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	sandbox, err := locateSandbox(c.Request.Context(), clusters, req.Cluster, sandboxID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, SnapshotResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Sandbox not found: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	info, err := sdk.SaveSnapshot(store, sandbox)
+	if err != nil {
+		c.JSON(snapshotStatus(err), SnapshotResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to snapshot sandbox: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, SnapshotResponse{
+		Success:   true,
+		Snapshot:  &info,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// getSnapshotHandler downloads a stored snapshot's archive
+func getSnapshotHandler(c *gin.Context, store snapshot.Store) {
+	if !requireSnapshot(c, store, c.Param("id")) {
+		return
+	}
+
+	info, archive, err := snapshot.Load(c.Request.Context(), store, c.Param("id"))
+	if err != nil {
+		c.JSON(snapshotStatus(err), SnapshotResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	writeArchive(c, info.ID, archive)
+}
+
+// deleteSnapshotHandler removes a stored snapshot
+func deleteSnapshotHandler(c *gin.Context, store snapshot.Store) {
+	if !requireSnapshot(c, store, c.Param("id")) {
+		return
+	}
+
+	if err := snapshot.Delete(c.Request.Context(), store, c.Param("id")); err != nil {
+		c.JSON(snapshotStatus(err), SnapshotResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, SnapshotResponse{
+		Success:   true,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// loadSnapshot reads the snapshot a sandbox is created from, writing an
+// error response when it cannot
+func loadSnapshot(c *gin.Context, store snapshot.Store, id string) (snapshot.Info, []byte, bool) {
+	if !requireSnapshot(c, store, id) {
+		return snapshot.Info{}, nil, false
+	}
+
+	info, archive, err := snapshot.Load(c.Request.Context(), store, id)
+	if err != nil {
+		c.JSON(snapshotStatus(err), SandboxResponse{
+			Success:   false,
+			Error:     err.Error(),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return snapshot.Info{}, nil, false
+	}
+	return info, archive, true
+}
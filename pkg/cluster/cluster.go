@@ -0,0 +1,226 @@
+// Package cluster places sandboxes on one of several Kubernetes clusters
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// Policy decides which clusters may take a sandbox
+type Policy string
+
+// Placement policies. Whichever clusters a policy allows, the one running the
+// fewest sandboxes is chosen, earlier clusters winning ties.
+const (
+	// LeastLoaded allows every cluster
+	LeastLoaded Policy = "least-loaded"
+	// ByLabel allows clusters carrying all the requested labels
+	ByLabel Policy = "label"
+	// ByTenant allows clusters dedicated to the tenant, or shared clusters
+	// with no tenants when none is
+	ByTenant Policy = "tenant"
+)
+
+// ErrNoCluster is returned when no cluster can take a sandbox
+var ErrNoCluster = errors.New("no cluster available for sandbox")
+
+// Cluster is a named cluster sandboxes can be placed on
+type Cluster struct {
+	Name   string
+	Client *k8sclient.Client
+	// Labels describe the cluster for the label policy, such as region or gpu
+	Labels map[string]string
+	// Tenants the cluster is dedicated to under the tenant policy; a cluster
+	// without tenants is shared
+	Tenants []string
+}
+
+// Placement describes where a sandbox should go
+type Placement struct {
+	// Cluster names a cluster explicitly, bypassing the policy
+	Cluster string
+	Tenant  string
+	Labels  map[string]string
+}
+
+// Pool holds the clusters a server places sandboxes on
+type Pool struct {
+	policy   Policy
+	clusters []*Cluster
+}
+
+// NewPool creates a pool of uniquely named clusters placed by policy
+func NewPool(policy Policy, clusters ...*Cluster) (*Pool, error) {
+	switch policy {
+	case "":
+		policy = LeastLoaded
+	case LeastLoaded, ByLabel, ByTenant:
+	default:
+		return nil, fmt.Errorf("unknown placement policy %q (expected %s, %s or %s)", policy, LeastLoaded, ByLabel, ByTenant)
+	}
+	if len(clusters) == 0 {
+		return nil, errors.New("a cluster pool needs at least one cluster")
+	}
+
+	seen := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		if c.Name == "" {
+			return nil, errors.New("cluster name is required")
+		}
+		if c.Client == nil {
+			return nil, fmt.Errorf("cluster %s has no client", c.Name)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("duplicate cluster %s", c.Name)
+		}
+		seen[c.Name] = true
+	}
+
+	return &Pool{policy: policy, clusters: clusters}, nil
+}
+
+// Single wraps one client as a pool, for servers that manage a single cluster
+func Single(name string, client *k8sclient.Client) *Pool {
+	return &Pool{policy: LeastLoaded, clusters: []*Cluster{{Name: name, Client: client}}}
+}
+
+// Policy returns the pool's placement policy
+func (p *Pool) Policy() Policy {
+	return p.policy
+}
+
+// Clusters returns the clusters in configuration order
+func (p *Pool) Clusters() []*Cluster {
+	return p.clusters
+}
+
+// Get returns the named cluster
+func (p *Pool) Get(name string) (*Cluster, error) {
+	for _, c := range p.clusters {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown cluster %q", name)
+}
+
+// Select chooses the cluster for a new sandbox
+func (p *Pool) Select(ctx context.Context, placement Placement) (*Cluster, error) {
+	if placement.Cluster != "" {
+		return p.Get(placement.Cluster)
+	}
+	if len(p.clusters) == 1 {
+		return p.clusters[0], nil
+	}
+
+	candidates, err := p.candidates(placement)
+	if err != nil {
+		return nil, err
+	}
+	return leastLoaded(ctx, candidates)
+}
+
+// candidates returns the clusters the policy allows for placement
+func (p *Pool) candidates(placement Placement) ([]*Cluster, error) {
+	var allowed []*Cluster
+	switch p.policy {
+	case ByLabel:
+		for _, c := range p.clusters {
+			if matchLabels(c.Labels, placement.Labels) {
+				allowed = append(allowed, c)
+			}
+		}
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("%w: no cluster has labels %v", ErrNoCluster, placement.Labels)
+		}
+	case ByTenant:
+		if placement.Tenant == "" {
+			return nil, errors.New("tenant is required by the tenant placement policy")
+		}
+		var shared []*Cluster
+		for _, c := range p.clusters {
+			if slices.Contains(c.Tenants, placement.Tenant) {
+				allowed = append(allowed, c)
+			} else if len(c.Tenants) == 0 {
+				shared = append(shared, c)
+			}
+		}
+		if len(allowed) == 0 {
+			allowed = shared
+		}
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("%w: no cluster serves tenant %s", ErrNoCluster, placement.Tenant)
+		}
+	default:
+		allowed = p.clusters
+	}
+	return allowed, nil
+}
+
+func matchLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// leastLoaded returns the cluster running the fewest sandboxes. Clusters that
+// cannot be reached are skipped.
+func leastLoaded(ctx context.Context, clusters []*Cluster) (*Cluster, error) {
+	var (
+		best     *Cluster
+		bestLoad int
+		errs     []error
+	)
+	for _, c := range clusters {
+		load, err := Load(ctx, c.Client)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", c.Name, err))
+			continue
+		}
+		if best == nil || load < bestLoad {
+			best, bestLoad = c, load
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoCluster, errors.Join(errs...))
+	}
+	return best, nil
+}
+
+// Load counts the sandboxes running on a cluster
+func Load(ctx context.Context, client *k8sclient.Client) (int, error) {
+	pods, err := client.ListPodsInAllNamespacesContext(ctx, k8sclient.LabelManaged+"=true")
+	if err != nil {
+		return 0, err
+	}
+
+	load := 0
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			load++
+		}
+	}
+	return load, nil
+}
+
+// Locate finds the cluster running the sandbox pod id. With a single cluster
+// no lookup is made.
+func (p *Pool) Locate(ctx context.Context, id, namespace string) (*Cluster, error) {
+	if len(p.clusters) == 1 {
+		return p.clusters[0], nil
+	}
+
+	for _, c := range p.clusters {
+		if _, err := c.Client.GetPodContext(ctx, id, namespace); err == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("sandbox %s not found on any cluster", id)
+}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeCluster returns a cluster running the given number of sandboxes
+func fakeCluster(name string, sandboxes int) *Cluster {
+	var objects []runtime.Object
+	for i := 0; i < sandboxes; i++ {
+		objects = append(objects, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("sandboxed-%s-%d", name, i),
+			Namespace: fmt.Sprintf("team-%d", i%2),
+			Labels:    map[string]string{k8sclient.LabelManaged: "true"},
+		}})
+	}
+	// Pods that are not sandboxes do not count
+	objects = append(objects, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}})
+
+	return &Cluster{Name: name, Client: k8sclient.NewClientFromClientset(fake.NewSimpleClientset(objects...), nil, "default")}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	pool, err := NewPool(LeastLoaded, fakeCluster("a", 3), fakeCluster("b", 1), fakeCluster("c", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := pool.Select(context.Background(), Placement{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Name != "b" {
+		t.Fatalf("expected the least loaded cluster, earlier winning ties, got %s", c.Name)
+	}
+
+	c, err = pool.Select(context.Background(), Placement{Cluster: "a"})
+	if err != nil || c.Name != "a" {
+		t.Fatalf("expected an explicit cluster to bypass the policy, got %v, %v", c, err)
+	}
+	if _, err := pool.Select(context.Background(), Placement{Cluster: "missing"}); err == nil {
+		t.Fatal("expected an unknown cluster to be rejected")
+	}
+}
+
+func TestByLabel(t *testing.T) {
+	gpu := fakeCluster("gpu", 5)
+	gpu.Labels = map[string]string{"gpu": "true", "region": "eu"}
+	cpu := fakeCluster("cpu", 0)
+	cpu.Labels = map[string]string{"region": "eu"}
+
+	pool, err := NewPool(ByLabel, gpu, cpu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := pool.Select(context.Background(), Placement{Labels: map[string]string{"gpu": "true"}})
+	if err != nil || c.Name != "gpu" {
+		t.Fatalf("expected the labelled cluster, got %v, %v", c, err)
+	}
+	c, err = pool.Select(context.Background(), Placement{Labels: map[string]string{"region": "eu"}})
+	if err != nil || c.Name != "cpu" {
+		t.Fatalf("expected the least loaded matching cluster, got %v, %v", c, err)
+	}
+	if _, err := pool.Select(context.Background(), Placement{Labels: map[string]string{"region": "us"}}); !errors.Is(err, ErrNoCluster) {
+		t.Fatalf("expected ErrNoCluster, got %v", err)
+	}
+}
+
+func TestByTenant(t *testing.T) {
+	acme := fakeCluster("acme", 10)
+	acme.Tenants = []string{"acme"}
+	shared := fakeCluster("shared", 0)
+
+	pool, err := NewPool(ByTenant, acme, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := pool.Select(context.Background(), Placement{Tenant: "acme"})
+	if err != nil || c.Name != "acme" {
+		t.Fatalf("expected the tenant's dedicated cluster, got %v, %v", c, err)
+	}
+	c, err = pool.Select(context.Background(), Placement{Tenant: "globex"})
+	if err != nil || c.Name != "shared" {
+		t.Fatalf("expected a shared cluster for other tenants, got %v, %v", c, err)
+	}
+	if _, err := pool.Select(context.Background(), Placement{}); err == nil {
+		t.Fatal("expected a missing tenant to be rejected")
+	}
+}
+
+func TestNewPoolValidation(t *testing.T) {
+	if _, err := NewPool("random", fakeCluster("a", 0)); err == nil {
+		t.Error("expected an unknown policy to be rejected")
+	}
+	if _, err := NewPool(LeastLoaded); err == nil {
+		t.Error("expected an empty pool to be rejected")
+	}
+	if _, err := NewPool(LeastLoaded, fakeCluster("a", 0), fakeCluster("a", 0)); err == nil {
+		t.Error("expected duplicate names to be rejected")
+	}
+}
+
+func TestLocate(t *testing.T) {
+	pool, err := NewPool(LeastLoaded, fakeCluster("a", 1), fakeCluster("b", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := pool.Locate(context.Background(), "sandboxed-b-1", "team-1")
+	if err != nil || c.Name != "b" {
+		t.Fatalf("expected the sandbox to be found on b, got %v, %v", c, err)
+	}
+	if _, err := pool.Locate(context.Background(), "sandboxed-missing", "team-0"); err == nil {
+		t.Fatal("expected a missing sandbox to be reported")
+	}
+}
@@ -0,0 +1,306 @@
+// Package config loads operator configuration for the server and MCP commands
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"github.com/system32-ai/sandboxed/pkg/snapshot"
+	"sigs.k8s.io/yaml"
+)
+
+// Cache modes
+const (
+	ModeReadWrite   = "readWrite"
+	ModeReadOnly    = "readOnly"
+	ModeCopyOnWrite = "copyOnWrite"
+)
+
+// Config is the operator configuration file, in YAML or JSON
+type Config struct {
+	// Caches maps a language to the volumes mounted into its sandboxes
+	Caches map[string][]Cache `json:"caches,omitempty"`
+	// Templates are named sandbox environments, keyed by name
+	Templates map[string]templates.Template `json:"templates,omitempty"`
+	// Clusters turns on multi-cluster mode: sandboxes are placed on one of
+	// these clusters by Placement. The first cluster wins ties.
+	Clusters []Cluster `json:"clusters,omitempty"`
+	// Placement is least-loaded (the default), label or tenant
+	Placement cluster.Policy `json:"placement,omitempty"`
+	// Snapshots is where workspace snapshots are stored; snapshots can only
+	// be downloaded when unset
+	Snapshots *Snapshots `json:"snapshots,omitempty"`
+	// Output caps the output kept from each execution and pod log read
+	Output *Output `json:"output,omitempty"`
+	// GitSecrets are the secrets the MCP clone_repo tool may use as git
+	// credentials, besides those the sandbox already references
+	GitSecrets []string `json:"gitSecrets,omitempty"`
+}
+
+// Output caps execution output. Output over MaxBytes keeps its head and
+// tail; with SpillDir set, the full output is saved to a file in the
+// sandbox so it can be downloaded.
+type Output struct {
+	// MaxBytes defaults to 1 MiB
+	MaxBytes int    `json:"maxBytes,omitempty"`
+	SpillDir string `json:"spillDir,omitempty"`
+}
+
+// Snapshots selects a snapshot store: a local directory or an S3-compatible
+// bucket. S3 credentials are read from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type Snapshots struct {
+	Dir string       `json:"dir,omitempty"`
+	S3  *S3Snapshots `json:"s3,omitempty"`
+	// MaxBytes caps the archives captured and stored, since they are held
+	// in memory; defaults to 256 MiB
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+}
+
+// S3Snapshots is an S3-compatible bucket, such as AWS S3 or MinIO
+type S3Snapshots struct {
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+}
+
+// Cluster is a named cluster for multi-cluster mode
+type Cluster struct {
+	Name string `json:"name"`
+	// Kubeconfig and Context select the cluster; InCluster uses the server's
+	// own service account instead
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	InCluster  bool   `json:"inCluster,omitempty"`
+	// Namespace is where sandboxes go when a request names none
+	Namespace string `json:"namespace,omitempty"`
+	// Labels are matched by the label placement policy
+	Labels map[string]string `json:"labels,omitempty"`
+	// Tenants the cluster is dedicated to under the tenant policy
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// Cache is a package cache volume shared between sandboxes of a language
+type Cache struct {
+	// Path is where the cache is mounted; the language's package manager
+	// cache directory is used when empty
+	Path      string `json:"path,omitempty"`
+	ClaimName string `json:"claimName,omitempty"`
+	HostPath  string `json:"hostPath,omitempty"`
+	// Mode is readWrite (the default), readOnly or copyOnWrite
+	Mode string `json:"mode,omitempty"`
+}
+
+// Load reads and validates a configuration file. An empty path yields an
+// empty configuration.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks every cache resolves to a mountable volume and every
+// template can create a sandbox
+func (c *Config) Validate() error {
+	for lang := range c.Caches {
+		if _, err := c.CacheVolumes(lang); err != nil {
+			return err
+		}
+	}
+	for name, t := range c.Templates {
+		t.Name = name
+		if err := t.Validate(); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool, len(c.Clusters))
+	for i, cl := range c.Clusters {
+		if cl.Name == "" {
+			return fmt.Errorf("clusters[%d]: name is required", i)
+		}
+		if seen[cl.Name] {
+			return fmt.Errorf("clusters: duplicate cluster %s", cl.Name)
+		}
+		seen[cl.Name] = true
+		if err := cl.clientOptions().Validate(); err != nil {
+			return fmt.Errorf("clusters.%s: %v", cl.Name, err)
+		}
+	}
+	switch c.Placement {
+	case "", cluster.LeastLoaded, cluster.ByLabel, cluster.ByTenant:
+	default:
+		return fmt.Errorf("placement: unknown policy %q (expected %s, %s or %s)", c.Placement, cluster.LeastLoaded, cluster.ByLabel, cluster.ByTenant)
+	}
+
+	if s := c.Snapshots; s != nil {
+		if (s.Dir == "") == (s.S3 == nil) {
+			return errors.New("snapshots: exactly one of dir and s3 is required")
+		}
+		if s.S3 != nil && (s.S3.Endpoint == "" || s.S3.Bucket == "") {
+			return errors.New("snapshots.s3: endpoint and bucket are required")
+		}
+		if s.MaxBytes < 0 {
+			return fmt.Errorf("snapshots: invalid maxBytes %d", s.MaxBytes)
+		}
+	}
+	if o := c.Output; o != nil {
+		if err := o.limits().Validate(); err != nil {
+			return fmt.Errorf("output: %v", err)
+		}
+	}
+	return nil
+}
+
+func (o *Output) limits() k8sclient.OutputLimits {
+	if o == nil {
+		return k8sclient.OutputLimits{}
+	}
+	return k8sclient.OutputLimits{MaxBytes: o.MaxBytes, SpillDir: o.SpillDir}
+}
+
+func (cl Cluster) clientOptions() k8sclient.ClientOptions {
+	return k8sclient.ClientOptions{
+		Namespace:  cl.Namespace,
+		Kubeconfig: cl.Kubeconfig,
+		Context:    cl.Context,
+		InCluster:  cl.InCluster,
+	}
+}
+
+// ClusterPool connects to the configured clusters. It returns nil when no
+// clusters are configured, leaving the caller in single-cluster mode.
+func (c *Config) ClusterPool() (*cluster.Pool, error) {
+	if c == nil || len(c.Clusters) == 0 {
+		return nil, nil
+	}
+
+	clusters := make([]*cluster.Cluster, 0, len(c.Clusters))
+	for _, cl := range c.Clusters {
+		client, err := k8sclient.NewClientWithOptions(cl.clientOptions())
+		if err != nil {
+			return nil, fmt.Errorf("clusters.%s: %v", cl.Name, err)
+		}
+		clusters = append(clusters, &cluster.Cluster{
+			Name:    cl.Name,
+			Client:  client,
+			Labels:  cl.Labels,
+			Tenants: cl.Tenants,
+		})
+	}
+	return cluster.NewPool(c.Placement, clusters...)
+}
+
+// SnapshotStore opens the configured snapshot store. It returns nil when no
+// store is configured.
+func (c *Config) SnapshotStore() (snapshot.Store, error) {
+	if c == nil || c.Snapshots == nil {
+		return nil, nil
+	}
+	if c.Snapshots.Dir != "" {
+		return snapshot.NewLocal(c.Snapshots.Dir)
+	}
+
+	s3 := c.Snapshots.S3
+	store, err := snapshot.NewS3(snapshot.S3Options{
+		Endpoint:        s3.Endpoint,
+		Bucket:          s3.Bucket,
+		Region:          s3.Region,
+		Prefix:          s3.Prefix,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshots.s3: %v", err)
+	}
+	return store, nil
+}
+
+// RegisterTemplates makes the configured templates available by name
+func (c *Config) RegisterTemplates() error {
+	if c == nil {
+		return nil
+	}
+	for name, t := range c.Templates {
+		t.Name = name
+		if err := templates.RegisterTemplate(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyOutputLimits sets the configured output limits on every client
+func (c *Config) ApplyOutputLimits() error {
+	if c == nil {
+		return nil
+	}
+	return k8sclient.SetOutputLimits(c.Output.limits())
+}
+
+// CacheVolumes returns the volumes to mount into a sandbox of lang
+func (c *Config) CacheVolumes(lang string) ([]k8sclient.Volume, error) {
+	if c == nil || len(c.Caches[lang]) == 0 {
+		return nil, nil
+	}
+
+	recipe, err := templates.RecipeLookup(lang)
+	if err != nil {
+		return nil, fmt.Errorf("caches: %v", err)
+	}
+
+	volumes := make([]k8sclient.Volume, 0, len(c.Caches[lang]))
+	for _, cache := range c.Caches[lang] {
+		v := k8sclient.Volume{
+			MountPath: cache.Path,
+			ClaimName: cache.ClaimName,
+			HostPath:  cache.HostPath,
+		}
+		if v.MountPath == "" {
+			v.MountPath = recipe.CacheDir
+		}
+
+		switch cache.Mode {
+		case "", ModeReadWrite:
+		case ModeReadOnly:
+			v.ReadOnly = true
+		case ModeCopyOnWrite:
+			v.CopyOnWrite = true
+		default:
+			return nil, fmt.Errorf("caches.%s: unknown mode %q (expected %s, %s or %s)", lang, cache.Mode, ModeReadWrite, ModeReadOnly, ModeCopyOnWrite)
+		}
+
+		if err := v.Validate(); err != nil {
+			return nil, fmt.Errorf("caches.%s: %v", lang, err)
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
+
+// ApplySnapshotLimits sets the configured maximum snapshot size
+func (c *Config) ApplySnapshotLimits() error {
+	if c == nil || c.Snapshots == nil {
+		return nil
+	}
+	return snapshot.SetMaxSize(c.Snapshots.MaxBytes)
+}
@@ -0,0 +1,250 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/cluster"
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCaches(t *testing.T) {
+	cfg, err := config.Load(writeConfig(t, `
+caches:
+  python:
+    - claimName: pip-cache
+      mode: copyOnWrite
+  go:
+    - hostPath: /var/cache/sandboxed/gomod
+      mode: readOnly
+    - hostPath: /var/cache/sandboxed/gobuild
+      path: /root/.cache/go-build
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	python, err := cfg.CacheVolumes("python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(python) != 1 || python[0].MountPath != "/root/.cache/pip" || !python[0].CopyOnWrite || python[0].ClaimName != "pip-cache" {
+		t.Fatalf("unexpected python caches: %+v", python)
+	}
+
+	golang, err := cfg.CacheVolumes("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(golang) != 2 || golang[0].MountPath != "/go/pkg/mod" || !golang[0].ReadOnly || golang[1].MountPath != "/root/.cache/go-build" {
+		t.Fatalf("unexpected go caches: %+v", golang)
+	}
+
+	if node, err := cfg.CacheVolumes("node"); err != nil || len(node) != 0 {
+		t.Fatalf("expected no node caches, got %+v, %v", node, err)
+	}
+}
+
+func TestLoadRejectsInvalidCaches(t *testing.T) {
+	cases := map[string]string{
+		"unknown language": "caches:\n  cobol:\n    - claimName: c\n",
+		"unknown mode":     "caches:\n  python:\n    - claimName: c\n      mode: sometimes\n",
+		"no source":        "caches:\n  python:\n    - mode: readOnly\n",
+		"unknown field":    "caches:\n  python:\n    - claim: c\n",
+		"template image":   "templates:\n  ds:\n    image: registry.example.com/ds:1\n",
+		"template workdir": "templates:\n  ds:\n    language: python\n    workdir: work\n",
+	}
+	for name, content := range cases {
+		if _, err := config.Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected config to be rejected", name)
+		}
+	}
+}
+
+func TestLoadEmptyPath(t *testing.T) {
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := cfg.CacheVolumes("python"); err != nil || v != nil {
+		t.Fatalf("expected no caches, got %+v, %v", v, err)
+	}
+	if _, err := config.Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read config") {
+		t.Fatalf("expected a read error, got %v", err)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	cfg, err := config.Load(writeConfig(t, `
+templates:
+  internal-ml:
+    language: python
+    image: registry.example.com/ml:2.1
+    packages: [pandas, scikit-learn]
+    env:
+      PIP_INDEX_URL: https://pypi.example.com/simple
+    resources:
+      requests: {cpu: 500m, memory: 1Gi}
+      limits: {cpu: "2", memory: 4Gi}
+    setup:
+      - pip install -e /opt/internal-lib
+    workdir: /srv/ml
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if err := cfg.RegisterTemplates(); err != nil {
+		t.Fatalf("failed to register templates: %v", err)
+	}
+
+	tpl, err := templates.TemplateLookup("internal-ml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Name != "internal-ml" || tpl.Image != "registry.example.com/ml:2.1" || len(tpl.Packages) != 2 || len(tpl.Setup) != 1 || tpl.Resources.Limits["memory"] != "4Gi" {
+		t.Fatalf("unexpected template: %+v", tpl)
+	}
+}
+
+func TestLoadClusters(t *testing.T) {
+	kubeconfig := writeConfig(t, `
+apiVersion: v1
+kind: Config
+clusters:
+- name: eu
+  cluster: {server: "https://eu.example.com"}
+- name: us
+  cluster: {server: "https://us.example.com"}
+contexts:
+- name: eu
+  context: {cluster: eu, user: ci}
+- name: us
+  context: {cluster: us, user: ci}
+users:
+- name: ci
+  user: {token: test}
+`)
+
+	cfg, err := config.Load(writeConfig(t, `
+placement: label
+clusters:
+  - name: eu
+    kubeconfig: `+kubeconfig+`
+    context: eu
+    labels: {region: eu}
+  - name: us
+    kubeconfig: `+kubeconfig+`
+    context: us
+    namespace: sandboxes
+    labels: {region: us, gpu: "true"}
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	pool, err := cfg.ClusterPool()
+	if err != nil {
+		t.Fatalf("failed to connect clusters: %v", err)
+	}
+	if pool.Policy() != cluster.ByLabel || len(pool.Clusters()) != 2 {
+		t.Fatalf("unexpected pool: policy %s, %d clusters", pool.Policy(), len(pool.Clusters()))
+	}
+	us, err := pool.Get("us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if us.Client.Namespace() != "sandboxes" || us.Labels["gpu"] != "true" {
+		t.Fatalf("unexpected cluster: %+v", us)
+	}
+}
+
+func TestLoadRejectsInvalidClusters(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing name":   "clusters:\n  - kubeconfig: /etc/kubeconfig\n",
+		"duplicate name": "clusters:\n  - name: a\n  - name: a\n",
+		"conflicting":    "clusters:\n  - name: a\n    inCluster: true\n    context: prod\n",
+		"unknown policy": "placement: random\n",
+	} {
+		if _, err := config.Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestClusterPoolSingleCluster(t *testing.T) {
+	pool, err := (&config.Config{}).ClusterPool()
+	if err != nil || pool != nil {
+		t.Fatalf("expected no pool without clusters, got %v, %v", pool, err)
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	cfg, err := config.Load(writeConfig(t, "snapshots:\n  dir: "+dir+"\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	store, err := cfg.SnapshotStore()
+	if err != nil || store == nil {
+		t.Fatalf("expected a local store, got %v, %v", store, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("expected the snapshot directory to be created: %v", err)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio123")
+	cfg, err = config.Load(writeConfig(t, "snapshots:\n  s3:\n    endpoint: http://localhost:9000\n    bucket: snapshots\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if store, err := cfg.SnapshotStore(); err != nil || store == nil {
+		t.Fatalf("expected an S3 store, got %v, %v", store, err)
+	}
+
+	if store, err := (&config.Config{}).SnapshotStore(); err != nil || store != nil {
+		t.Fatalf("expected no store without configuration, got %v, %v", store, err)
+	}
+
+	for name, content := range map[string]string{
+		"neither":        "snapshots: {}\n",
+		"both":           "snapshots:\n  dir: /tmp/s\n  s3:\n    endpoint: http://localhost:9000\n    bucket: b\n",
+		"missing bucket": "snapshots:\n  s3:\n    endpoint: http://localhost:9000\n",
+		"negative size":  "snapshots:\n  dir: /tmp/s\n  maxBytes: -1\n",
+	} {
+		if _, err := config.Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadOutput(t *testing.T) {
+	cfg, err := config.Load(writeConfig(t, "output:\n  maxBytes: 4096\n  spillDir: /tmp/output\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Output.MaxBytes != 4096 || cfg.Output.SpillDir != "/tmp/output" {
+		t.Fatalf("unexpected output config %+v", cfg.Output)
+	}
+
+	for _, data := range []string{
+		"output:\n  maxBytes: -1\n",
+		"output:\n  spillDir: output\n",
+	} {
+		if _, err := config.Load(writeConfig(t, data)); err == nil {
+			t.Errorf("expected %q to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package detect guesses the programming language of source code locally,
+// from shebangs, file extensions and keyword and syntax signatures
+package detect
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Result is a detected language with a confidence between 0 and 1. An empty
+// Language means nothing was recognised.
+type Result struct {
+	Language   string
+	Confidence float64
+	// Reason names the evidence: "shebang", "extension" or "signatures"
+	Reason string
+}
+
+// signature is a pattern that suggests a language, weighted by how
+// distinctive it is
+type signature struct {
+	pattern *regexp.Regexp
+	weight  float64
+}
+
+func sig(pattern string, weight float64) signature {
+	return signature{pattern: regexp.MustCompile(`(?m)` + pattern), weight: weight}
+}
+
+var signatures = map[string][]signature{
+	"python": {
+		sig(`^\s*def \w+\(.*\)\s*(->\s*[\w\[\], .]+)?:\s*$`, 3),
+		sig(`^\s*class \w+(\(.*\))?:\s*$`, 3),
+		sig(`^\s*(from [\w.]+ )?import [\w., ]+$`, 1.5),
+		sig(`^\s*(if|while|for|with|try|except|else)\b.*:\s*$`, 2),
+		sig(`\belif\b`, 3),
+		sig(`\bself\.`, 1.5),
+		sig(`\b(None|True|False)\b`, 1),
+		sig(`\bprint\(`, 1),
+		sig(`\bf"[^"]*\{`, 1.5),
+		sig(`__name__ == ['"]__main__['"]`, 4),
+	},
+	"go": {
+		sig(`^package \w+\s*$`, 4),
+		sig(`\bfunc (\(\w+ \*?\w+\) )?\w+\(`, 3),
+		sig(`^import (\(|")`, 2),
+		sig(`\bfmt\.\w+\(`, 3),
+		sig(`:=`, 1.5),
+		sig(`\berr != nil\b`, 3),
+		sig(`\b(chan|defer|go func)\b`, 2),
+	},
+	"node": {
+		sig(`\bconsole\.(log|error)\(`, 3),
+		sig(`\brequire\(['"]`, 3),
+		sig(`module\.exports|^export (default|const|function|class)\b`, 3),
+		sig(`^\s*import .* from ['"]`, 3),
+		sig(`\b(const|var) \w+\s*=`, 1.5),
+		sig(`\bfunction\s*\w*\s*\(`, 1.5),
+		sig(`\b(document|window|process)\.`, 2),
+		sig(`===|!==`, 1),
+		sig(`=>`, 0.5),
+	},
+	"java": {
+		sig(`\bpublic static void main\(String`, 5),
+		sig(`\bSystem\.(out|err)\.print`, 4),
+		sig(`^package [\w.]+;`, 4),
+		sig(`^import [\w.]+(\.\*)?;`, 3),
+		sig(`\b(public|private|protected) (static )?(final )?(class|interface|void|enum)\b`, 3),
+		sig(`\b(String|int|boolean|void|long|double)\s+\w+\s*[(=;]`, 1.5),
+	},
+	"ruby": {
+		sig(`^\s*def \w+[?!]?(\(.*\))?\s*$`, 3),
+		sig(`^\s*end\s*$`, 2),
+		sig(`\bputs\b`, 3),
+		sig(`^\s*require ['"]`, 2),
+		sig(`\bdo\s*\|\w+(, *\w+)*\|`, 3),
+		sig(`\battr_(accessor|reader|writer)\b`, 3),
+		sig(`^\s*class \w+( < [\w:]+)?\s*$`, 2),
+		sig(`#\{`, 2),
+	},
+	"php": {
+		sig(`<\?php`, 6),
+		sig(`\$\w+\s*=`, 2),
+		sig(`\$this->`, 3),
+		sig(`\bfunction \w+\(.*\$`, 2),
+		sig(`\becho\b`, 1),
+	},
+	"rust": {
+		sig(`\bfn \w+(<.*>)?\(`, 3),
+		sig(`\blet mut\b`, 3),
+		sig(`\b(println|format|vec|panic)!`, 4),
+		sig(`^\s*use (std|crate)::`, 4),
+		sig(`^\s*impl\b`, 2),
+		sig(`&(str|mut)\b`, 2),
+		sig(`->\s*(Self|Result|Option|String|[iu](8|16|32|64|size))\b`, 1),
+	},
+}
+
+// saturation is the signature score at which a clear winner is fully trusted
+const saturation = 5
+
+var interpreters = map[string]string{
+	"python": "python",
+	"node":   "node",
+	"nodejs": "node",
+	"ruby":   "ruby",
+	"php":    "php",
+	"sh":     "bash",
+	"bash":   "bash",
+}
+
+var extensions = map[string]string{
+	".py":   "python",
+	".go":   "go",
+	".js":   "node",
+	".mjs":  "node",
+	".cjs":  "node",
+	".java": "java",
+	".rb":   "ruby",
+	".php":  "php",
+	".rs":   "rust",
+}
+
+// Detect guesses the language of code
+func Detect(code string) Result {
+	if lang := fromShebang(code); lang != "" {
+		return Result{Language: lang, Confidence: 0.99, Reason: "shebang"}
+	}
+	return fromSignatures(code)
+}
+
+// DetectFile guesses the language of a file from its name and content. The
+// extension wins over the content when it is recognised.
+func DetectFile(filename, code string) Result {
+	if lang, ok := extensions[strings.ToLower(path.Ext(filename))]; ok {
+		return Result{Language: lang, Confidence: 0.95, Reason: "extension"}
+	}
+	return Detect(code)
+}
+
+// fromShebang maps an interpreter line such as "#!/usr/bin/env python3"
+func fromShebang(code string) string {
+	if !strings.HasPrefix(code, "#!") {
+		return ""
+	}
+
+	line, _, _ := strings.Cut(code[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = path.Base(f)
+				break
+			}
+		}
+	}
+
+	// Strip versions such as python3 or python3.12
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+	return interpreters[interpreter]
+}
+
+// fromSignatures scores every language and reports the best. Confidence
+// grows with the winner's share of the total score and its absolute score.
+func fromSignatures(code string) Result {
+	type score struct {
+		lang  string
+		value float64
+	}
+
+	var scores []score
+	var total float64
+	for lang, sigs := range signatures {
+		var value float64
+		for _, s := range sigs {
+			if s.pattern.MatchString(code) {
+				value += s.weight
+			}
+		}
+		scores = append(scores, score{lang, value})
+		total += value
+	}
+	if total == 0 {
+		return Result{}
+	}
+
+	// Ties are broken by name so results are stable
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].value != scores[j].value {
+			return scores[i].value > scores[j].value
+		}
+		return scores[i].lang < scores[j].lang
+	})
+
+	best := scores[0]
+	confidence := best.value / total
+	if best.value < saturation {
+		confidence *= best.value / saturation
+	}
+	return Result{Language: best.lang, Confidence: confidence, Reason: "signatures"}
+}
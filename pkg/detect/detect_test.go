@@ -0,0 +1,123 @@
+package detect_test
+
+import (
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/detect"
+)
+
+var samples = map[string]string{
+	"python": `
+import sys
+
+def greet(name):
+    if name:
+        print(f"Hello, {name}!")
+    else:
+        print("Hello!")
+
+if __name__ == "__main__":
+    greet(sys.argv[1] if len(sys.argv) > 1 else None)
+`,
+	"go": `package main
+
+import "fmt"
+
+func main() {
+	msg := "Hello, World!"
+	fmt.Println(msg)
+}
+`,
+	"node": `const fs = require('fs');
+
+function greet(name) {
+  console.log(` + "`Hello, ${name}!`" + `);
+}
+
+greet(process.argv[2] || 'World');
+`,
+	"java": `public class Main {
+    public static void main(String[] args) {
+        System.out.println("Hello, World!");
+    }
+}
+`,
+	"ruby": `require 'json'
+
+def greet(name)
+  puts "Hello, #{name}!"
+end
+
+[1, 2, 3].each do |n|
+  greet(n)
+end
+`,
+	"php": `<?php
+$name = "World";
+echo "Hello, $name!";
+`,
+	"rust": `use std::collections::HashMap;
+
+fn main() {
+    let mut counts: HashMap<&str, i32> = HashMap::new();
+    counts.insert("hello", 1);
+    println!("{:?}", counts);
+}
+`,
+}
+
+func TestDetectSignatures(t *testing.T) {
+	for want, code := range samples {
+		got := detect.Detect(code)
+		if got.Language != want {
+			t.Errorf("expected %s, got %s (%.2f)", want, got.Language, got.Confidence)
+			continue
+		}
+		if got.Confidence < 0.5 {
+			t.Errorf("%s: expected a confident result, got %.2f", want, got.Confidence)
+		}
+	}
+}
+
+func TestDetectShebang(t *testing.T) {
+	cases := map[string]string{
+		"#!/usr/bin/env python3\nx = 1\n":        "python",
+		"#!/usr/bin/python3.12\n":                "python",
+		"#!/usr/bin/env -S node --no-warnings\n": "node",
+		"#!/usr/local/bin/ruby -w\nputs 1\n":     "ruby",
+		"#!/bin/bash\necho hi\n":                 "bash",
+		"#!/bin/sh -e\necho hi\n":                "bash",
+		"#!/usr/bin/env bash\n":                  "bash",
+	}
+	for code, want := range cases {
+		got := detect.Detect(code)
+		if got.Language != want || got.Reason != "shebang" {
+			t.Errorf("%q: expected %s from shebang, got %+v", code, want, got)
+		}
+	}
+
+	// Unsupported interpreters fall through to the content
+	if got := detect.Detect("#!/usr/bin/perl\nprint 1;\n"); got.Reason == "shebang" {
+		t.Errorf("expected a perl shebang to be ignored, got %+v", got)
+	}
+}
+
+func TestDetectFile(t *testing.T) {
+	if got := detect.DetectFile("src/Main.JAVA", ""); got.Language != "java" || got.Reason != "extension" {
+		t.Fatalf("expected java from extension, got %+v", got)
+	}
+	if got := detect.DetectFile("script", samples["go"]); got.Language != "go" {
+		t.Fatalf("expected content detection without an extension, got %+v", got)
+	}
+}
+
+func TestDetectUnrecognised(t *testing.T) {
+	if got := detect.Detect("hello world"); got.Language != "" || got.Confidence != 0 {
+		t.Fatalf("expected nothing to be detected, got %+v", got)
+	}
+
+	// Ambiguous snippets are reported with low confidence
+	if got := detect.Detect(`print("hi")`); got.Confidence >= 0.5 {
+		t.Fatalf("expected low confidence for an ambiguous snippet, got %+v", got)
+	}
+}
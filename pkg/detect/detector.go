@@ -0,0 +1,120 @@
+package detect
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotDetected is returned when no detector recognises a supported language
+var ErrNotDetected = errors.New("unable to detect supported programming language from code")
+
+// Detector determines the language of code. A result with an empty Language
+// means the detector did not recognise it.
+type Detector interface {
+	Detect(ctx context.Context, code string) (Result, error)
+}
+
+// Heuristic is the local detector backed by Detect
+type Heuristic struct{}
+
+// Detect implements Detector
+func (Heuristic) Detect(_ context.Context, code string) (Result, error) {
+	return Detect(code), nil
+}
+
+// Languages returns the language keys detectors can report, sorted
+func Languages() []string {
+	langs := make([]string, 0, len(signatures))
+	for lang := range signatures {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// DefaultCacheSize is the number of results a chain remembers
+const DefaultCacheSize = 1024
+
+// Chain asks detectors in order and returns the first result at or above
+// MinConfidence. When none is confident enough, the most confident result
+// is returned. Results are cached by the SHA-256 of the code.
+type Chain struct {
+	detectors     []Detector
+	minConfidence float64
+
+	mu        sync.Mutex
+	cache     map[[sha256.Size]byte]Result
+	order     [][sha256.Size]byte
+	cacheSize int
+}
+
+// NewChain creates a chain of detectors with a cache of DefaultCacheSize
+func NewChain(minConfidence float64, detectors ...Detector) *Chain {
+	return &Chain{
+		detectors:     detectors,
+		minConfidence: minConfidence,
+		cache:         make(map[[sha256.Size]byte]Result),
+		cacheSize:     DefaultCacheSize,
+	}
+}
+
+// Detect implements Detector. Detector errors are skipped over and only
+// returned when no detector produced a result.
+func (c *Chain) Detect(ctx context.Context, code string) (Result, error) {
+	key := sha256.Sum256([]byte(code))
+
+	c.mu.Lock()
+	cached, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	var best Result
+	var errs []error
+	for _, d := range c.detectors {
+		result, err := d.Detect(ctx, code)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if result.Language == "" {
+			continue
+		}
+		if result.Confidence > best.Confidence || best.Language == "" {
+			best = result
+		}
+		if result.Confidence >= c.minConfidence {
+			break
+		}
+	}
+
+	if best.Language == "" {
+		if len(errs) > 0 {
+			return Result{}, errors.Join(append([]error{ErrNotDetected}, errs...)...)
+		}
+		return Result{}, ErrNotDetected
+	}
+
+	c.remember(key, best)
+	return best, nil
+}
+
+// remember caches a result, evicting the oldest once the cache is full
+func (c *Chain) remember(key [sha256.Size]byte, result Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.cache[key]; exists {
+		return
+	}
+	if len(c.order) >= c.cacheSize {
+		delete(c.cache, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.cache[key] = result
+	c.order = append(c.order, key)
+}
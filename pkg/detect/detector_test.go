@@ -0,0 +1,125 @@
+package detect_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/detect"
+)
+
+// stubCompletions serves an OpenAI-compatible chat completions endpoint that
+// always answers with answer, recording the requested model
+func stubCompletions(t *testing.T, answer string, calls *atomic.Int32, model *atomic.Value) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		calls.Add(1)
+
+		var req struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		model.Store(req.Model)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"model":   req.Model,
+			"choices": []map[string]any{{"index": 0, "message": map[string]string{"role": "assistant", "content": answer}, "finish_reason": "stop"}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAICompatibleEndpoint(t *testing.T) {
+	var calls atomic.Int32
+	var model atomic.Value
+	srv := stubCompletions(t, " JavaScript.\n", &calls, &model)
+
+	d := detect.NewOpenAI(detect.OpenAIConfig{BaseURL: srv.URL + "/v1/", Model: "llama3.2"})
+	result, err := d.Detect(context.Background(), "x")
+	if err != nil {
+		t.Fatalf("detection failed: %v", err)
+	}
+	if result.Language != "node" || result.Reason != "llm" {
+		t.Fatalf("expected node from the model, got %+v", result)
+	}
+	if got := model.Load(); got != "llama3.2" {
+		t.Fatalf("expected the configured model, got %v", got)
+	}
+}
+
+func TestOpenAIUnknownAnswer(t *testing.T) {
+	var calls atomic.Int32
+	var model atomic.Value
+	srv := stubCompletions(t, "cobol", &calls, &model)
+
+	result, err := detect.NewOpenAI(detect.OpenAIConfig{BaseURL: srv.URL + "/v1"}).Detect(context.Background(), "x")
+	if err != nil || result.Language != "" {
+		t.Fatalf("expected no result for an unsupported answer, got %+v, %v", result, err)
+	}
+	if got := model.Load(); got != detect.DefaultModel {
+		t.Fatalf("expected the default model, got %v", got)
+	}
+}
+
+func TestChainFallsBackAndCaches(t *testing.T) {
+	var calls atomic.Int32
+	var model atomic.Value
+	srv := stubCompletions(t, "ruby", &calls, &model)
+
+	chain := detect.NewChain(0.5, detect.Heuristic{}, detect.NewOpenAI(detect.OpenAIConfig{BaseURL: srv.URL + "/v1"}))
+
+	// Confident local results never reach the model
+	result, err := chain.Detect(context.Background(), samples["go"])
+	if err != nil || result.Language != "go" || calls.Load() != 0 {
+		t.Fatalf("expected a local result, got %+v, %v after %d calls", result, err, calls.Load())
+	}
+
+	// Ambiguous code is passed on, and the answer is cached by content
+	for i := 0; i < 3; i++ {
+		result, err = chain.Detect(context.Background(), `print("hi")`)
+		if err != nil || result.Language != "ruby" {
+			t.Fatalf("expected the model's answer, got %+v, %v", result, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected one call to the model, got %d", calls.Load())
+	}
+}
+
+type failingDetector struct{}
+
+func (failingDetector) Detect(context.Context, string) (detect.Result, error) {
+	return detect.Result{}, errors.New("endpoint unreachable")
+}
+
+func TestChainErrors(t *testing.T) {
+	chain := detect.NewChain(0.5, detect.Heuristic{}, failingDetector{})
+
+	// A failing fallback leaves the uncertain local guess
+	result, err := chain.Detect(context.Background(), `print("hi")`)
+	if err != nil || result.Language != "python" || result.Confidence >= 0.5 {
+		t.Fatalf("expected the local guess, got %+v, %v", result, err)
+	}
+
+	// With nothing detected, the detector errors are reported
+	_, err = chain.Detect(context.Background(), "hello world")
+	if !errors.Is(err, detect.ErrNotDetected) || !strings.Contains(err.Error(), "endpoint unreachable") {
+		t.Fatalf("expected ErrNotDetected with the cause, got %v", err)
+	}
+}
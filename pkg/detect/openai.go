@@ -0,0 +1,98 @@
+package detect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultModel is used when OpenAIConfig.Model is empty
+const DefaultModel = openai.GPT4oMini
+
+// llmConfidence is reported for answers from a model, which gives no score
+const llmConfidence = 0.9
+
+// OpenAIConfig configures a detector for an OpenAI-compatible endpoint
+type OpenAIConfig struct {
+	APIKey string
+	// BaseURL points at any OpenAI-compatible API, such as a local Ollama
+	// (http://localhost:11434/v1) or vLLM server; OpenAI's when empty
+	BaseURL string
+	Model   string
+}
+
+// OpenAI asks a chat completion model for the language of code
+type OpenAI struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAI creates a detector for an OpenAI-compatible endpoint
+func NewOpenAI(cfg OpenAIConfig) *OpenAI {
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	}
+
+	model := cfg.Model
+	if model == "" {
+		model = DefaultModel
+	}
+
+	return &OpenAI{client: openai.NewClientWithConfig(clientConfig), model: model}
+}
+
+// Detect implements Detector
+func (o *OpenAI) Detect(ctx context.Context, code string) (Result, error) {
+	prompt := `Analyze the following code and determine the primary programming language it is written in. 
+Respond with only the language name in lowercase (one of: ` + strings.Join(Languages(), ", ") + `).
+
+Code:
+` + code
+
+	resp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: o.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		MaxTokens:   10,
+		Temperature: 0,
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("language detection with %s failed: %w", o.model, err)
+	}
+	if len(resp.Choices) == 0 {
+		return Result{}, errors.New("no response from " + o.model)
+	}
+
+	lang := normalizeAnswer(resp.Choices[0].Message.Content)
+	if lang == "" {
+		return Result{}, nil
+	}
+	return Result{Language: lang, Confidence: llmConfidence, Reason: "llm"}, nil
+}
+
+// normalizeAnswer maps a model's answer to a language key, tolerating
+// capitalisation, punctuation and common aliases
+func normalizeAnswer(answer string) string {
+	answer = strings.Trim(strings.ToLower(strings.TrimSpace(answer)), ".`'\" ")
+
+	switch answer {
+	case "javascript", "js", "nodejs":
+		return "node"
+	case "golang":
+		return "go"
+	case "py", "python3":
+		return "python"
+	}
+	if _, ok := signatures[answer]; ok {
+		return answer
+	}
+	return ""
+}
@@ -0,0 +1,343 @@
+// Package eval runs benchmark cases, such as model-generated solutions and
+// their tests, across a bounded pool of sandboxes and scores them with pass@k.
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+)
+
+// DefaultTimeout bounds a case that sets no timeout of its own
+const DefaultTimeout = 30 * time.Second
+
+// Case is one sample to evaluate: a solution and the tests that check it
+type Case struct {
+	// ID identifies the case in results; the line number when read by
+	// ReadCases without one
+	ID string `json:"id,omitempty"`
+	// Problem groups samples of the same task for pass@k; each case is its
+	// own problem when empty
+	Problem  string `json:"problem,omitempty"`
+	Language string `json:"language"`
+	Code     string `json:"code"`
+	// Tests is appended to Code to form the program that is run
+	Tests string `json:"tests,omitempty"`
+	// ExpectedOutput, when set, must match what the program prints
+	ExpectedOutput *string `json:"expected_output,omitempty"`
+	// Timeout is in seconds; Options.Timeout is used when zero
+	Timeout float64 `json:"timeout,omitempty"`
+}
+
+// Status is the outcome of a case
+type Status string
+
+const (
+	StatusPassed   Status = "passed"
+	StatusFailed   Status = "failed"
+	StatusTimedOut Status = "timeout"
+	// StatusError means the case could not be run, such as when no sandbox
+	// could be created for it
+	StatusError Status = "error"
+)
+
+// CaseResult is the outcome of running a case
+type CaseResult struct {
+	ID       string `json:"id"`
+	Problem  string `json:"problem"`
+	Language string `json:"language"`
+	Status   Status `json:"status"`
+	ExitCode int    `json:"exit_code"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	Output   string  `json:"output,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Passed reports whether the case passed
+func (r CaseResult) Passed() bool {
+	return r.Status == StatusPassed
+}
+
+// ReadCases reads cases from JSONL, one per line. Blank lines are skipped.
+func ReadCases(r io.Reader) ([]Case, error) {
+	var cases []Case
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if c.ID == "" {
+			c.ID = strconv.Itoa(line)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+func (c *Case) validate() error {
+	if c.Problem == "" {
+		c.Problem = c.ID
+	}
+	if _, ok := sourceFiles[sdk.Language(c.Language)]; !ok {
+		return fmt.Errorf("case %s: unsupported language %q", c.ID, c.Language)
+	}
+	if strings.TrimSpace(c.Code) == "" {
+		return fmt.Errorf("case %s: code is empty", c.ID)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("case %s: timeout must not be negative", c.ID)
+	}
+	return nil
+}
+
+// source is the file a case's program is written to and the entrypoint
+// passed to the language's recipe, its default when empty
+type source struct {
+	file       string
+	entrypoint string
+}
+
+var sourceFiles = map[sdk.Language]source{
+	sdk.Python: {"main.py", "main.py"},
+	sdk.Go:     {"main.go", ""},
+	sdk.Node:   {"index.js", "index.js"},
+	sdk.Java:   {"Main.java", "Main"},
+	sdk.Ruby:   {"main.rb", "main.rb"},
+	sdk.PHP:    {"index.php", "index.php"},
+	sdk.Rust:   {"main.rs", "main.rs"},
+	sdk.Bash:   {"main.sh", "main.sh"},
+}
+
+// Options configures Run
+type Options struct {
+	// Parallelism is the number of cases run at once, and so the number of
+	// sandboxes in the pool; 1 when zero
+	Parallelism int
+	// Timeout bounds each case; DefaultTimeout when zero
+	Timeout time.Duration
+	// Factory creates the pool's sandboxes
+	Factory Factory
+	// Reuse runs cases one after another on the same sandbox, resetting its
+	// processes, workspace, /tmp and home directory in between. Anything
+	// else a case changes, such as installed packages, carries over to the
+	// cases after it, so only reuse sandboxes for trusted cases. Each case
+	// gets a new sandbox when false.
+	Reuse bool
+	// OnResult is called as each case finishes, one call at a time
+	OnResult func(CaseResult)
+}
+
+// Run evaluates cases on a pool of at most Options.Parallelism sandboxes,
+// created as needed and destroyed once their case finishes, or before Run
+// returns when they are reused. Results are in the
+// order of cases. When ctx is cancelled, Run stops and returns the results of
+// the cases that finished along with ctx's error.
+func Run(ctx context.Context, cases []Case, opts Options) ([]CaseResult, error) {
+	if opts.Factory == nil {
+		return nil, errors.New("eval needs a sandbox factory")
+	}
+	cases = append([]Case(nil), cases...)
+	for i := range cases {
+		if err := cases[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	// Cases of a language run together so that sandboxes are reused rather
+	// than replaced
+	order := make([]int, len(cases))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return cases[order[a]].Language < cases[order[b]].Language
+	})
+
+	p := newPool(parallelism, opts.Factory)
+	work := make(chan int)
+	results := make([]CaseResult, len(cases))
+	done := make([]bool, len(cases))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				result, ok := runOn(ctx, p, cases[i], timeout, opts.Reuse)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				results[i], done[i] = result, true
+				if opts.OnResult != nil {
+					opts.OnResult(result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, i := range order {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	closeErr := p.close()
+	if err := ctx.Err(); err != nil {
+		finished := results[:0]
+		for i, result := range results {
+			if done[i] {
+				finished = append(finished, result)
+			}
+		}
+		return finished, err
+	}
+	if closeErr != nil {
+		return results, fmt.Errorf("failed to destroy sandboxes: %w", closeErr)
+	}
+	return results, nil
+}
+
+// runOn runs a case on a sandbox from the pool, returning the sandbox to the
+// pool when reuse is set. It reports false when ctx was cancelled before the
+// case finished.
+func runOn(ctx context.Context, p *pool, c Case, timeout time.Duration, reuse bool) (CaseResult, bool) {
+	lang := sdk.Language(c.Language)
+	sandbox, err := p.acquire(lang)
+	if err != nil {
+		if ctx.Err() != nil {
+			return CaseResult{}, false
+		}
+		return CaseResult{
+			ID:       c.ID,
+			Problem:  c.Problem,
+			Language: c.Language,
+			Status:   StatusError,
+			Error:    fmt.Sprintf("failed to create sandbox: %v", err),
+		}, true
+	}
+
+	if c.Timeout > 0 {
+		timeout = time.Duration(c.Timeout * float64(time.Second))
+	}
+	// Only pooled sandboxes can hold state from an earlier case
+	result, healthy := runCase(ctx, sandbox, c, timeout, reuse)
+	p.release(lang, sandbox, healthy && reuse)
+	return result, ctx.Err() == nil
+}
+
+// resetScript isolates a case from the ones before it on the same sandbox:
+// it kills every process but the container's own and this shell, and
+// empties the workspace, /tmp and the home directory, caches included.
+// Changes elsewhere, such as installed packages, are not undone.
+const resetScript = `for p in /proc/[0-9]*; do
+	pid=${p#/proc/}
+	if [ "$pid" != 1 ] && [ "$pid" != $$ ]; then kill -9 "$pid" 2>/dev/null; fi
+done
+rm -rf ` + sdk.WorkspaceDir + `/* ` + sdk.WorkspaceDir + `/.[!.]* /tmp/* /tmp/.[!.]* 2>/dev/null
+if [ -n "$HOME" ] && [ "$HOME" != / ]; then rm -rf "$HOME"/* "$HOME"/.[!.]* 2>/dev/null; fi
+true`
+
+// runCase runs a case on a sandbox, resetting it first when reset is set. It
+// reports whether the sandbox can be reused.
+func runCase(ctx context.Context, sandbox Sandbox, c Case, timeout time.Duration, reset bool) (CaseResult, bool) {
+	result := CaseResult{ID: c.ID, Problem: c.Problem, Language: c.Language}
+
+	if reset {
+		if _, err := sandbox.Run(resetScript); err != nil {
+			result.Status = StatusError
+			result.Error = fmt.Sprintf("failed to reset sandbox: %v", err)
+			return result, false
+		}
+	}
+
+	src := sourceFiles[sdk.Language(c.Language)]
+	program := c.Code
+	if c.Tests != "" {
+		program = strings.TrimRight(program, "\n") + "\n\n" + c.Tests
+	}
+
+	caseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	output, err := sandbox.RunProjectContext(caseCtx, sdk.Project{
+		Files:      map[string][]byte{src.file: []byte(program)},
+		Entrypoint: src.entrypoint,
+	})
+	result.Duration = time.Since(start).Seconds()
+
+	switch {
+	case ctx.Err() == nil && errors.Is(caseCtx.Err(), context.DeadlineExceeded):
+		// The next reset kills whatever is still running
+		result.Status = StatusTimedOut
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+		return result, true
+	case err != nil:
+		result.Status = StatusError
+		result.Error = err.Error()
+		return result, false
+	}
+
+	result.ExitCode = output.ExitCode
+	result.Output = output.Result
+	switch {
+	case output.ExitCode != 0:
+		result.Status = StatusFailed
+		result.Error = output.Error
+	case c.ExpectedOutput != nil && normalizeOutput(output.Result) != normalizeOutput(*c.ExpectedOutput):
+		result.Status = StatusFailed
+		result.Error = "output does not match the expected output"
+	default:
+		result.Status = StatusPassed
+	}
+	return result, true
+}
+
+// normalizeOutput makes output comparable across terminals: line endings are
+// unified and surrounding whitespace trimmed
+func normalizeOutput(s string) string {
+	return strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
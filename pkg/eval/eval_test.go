@@ -0,0 +1,297 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+)
+
+// fakeSandbox runs programs by keyword: HANG waits for cancellation, EXIT1
+// exits 1, BROKEN fails to run, and anything else prints its last line
+type fakeSandbox struct {
+	lang    sdk.Language
+	factory *fakeFactory
+	// dirty is set by a case and cleared by a reset, to check isolation
+	dirty bool
+}
+
+func (s *fakeSandbox) Run(code string) (*sdk.Output, error) {
+	if code != resetScript {
+		return nil, errors.New("unexpected command")
+	}
+	s.dirty = false
+	return &sdk.Output{}, nil
+}
+
+func (s *fakeSandbox) RunProjectContext(ctx context.Context, project sdk.Project) (*sdk.Output, error) {
+	if s.dirty {
+		return nil, errors.New("sandbox was not reset")
+	}
+	s.dirty = true
+	if len(project.Files) != 1 {
+		return nil, errors.New("expected one file")
+	}
+	var program string
+	for name, content := range project.Files {
+		if name != sourceFiles[s.lang].file {
+			return nil, errors.New("unexpected file " + name)
+		}
+		program = string(content)
+	}
+
+	switch {
+	case strings.Contains(program, "HANG"):
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case strings.Contains(program, "EXIT1"):
+		return &sdk.Output{Result: "boom", Error: "command terminated with exit code 1", ExitCode: 1}, nil
+	case strings.Contains(program, "BROKEN"):
+		return nil, errors.New("pod is gone")
+	}
+	lines := strings.Split(strings.TrimSpace(program), "\n")
+	return &sdk.Output{Result: lines[len(lines)-1] + "\r\n"}, nil
+}
+
+func (s *fakeSandbox) Destroy() error {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	s.factory.live--
+	s.factory.destroyed++
+	return nil
+}
+
+type fakeFactory struct {
+	mu        sync.Mutex
+	live      int
+	maxLive   int
+	created   int
+	destroyed int
+}
+
+func (f *fakeFactory) create(lang sdk.Language) (Sandbox, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.live++
+	f.created++
+	if f.live > f.maxLive {
+		f.maxLive = f.live
+	}
+	return &fakeSandbox{lang: lang, factory: f}, nil
+}
+
+func expect(s string) *string { return &s }
+
+func TestRun(t *testing.T) {
+	cases := []Case{
+		{ID: "pass", Problem: "sum", Language: "python", Code: "def f(): pass", Tests: "assert True\nok"},
+		{ID: "output", Problem: "sum", Language: "python", Code: "print(3)\n3", ExpectedOutput: expect("3\n")},
+		{ID: "wrong output", Problem: "sum", Language: "python", Code: "print(4)\n4", ExpectedOutput: expect("3")},
+		{ID: "exit", Problem: "greet", Language: "node", Code: "EXIT1"},
+		{ID: "hang", Problem: "greet", Language: "go", Code: "HANG", Timeout: 0.05},
+		{ID: "broken", Problem: "loop", Language: "ruby", Code: "BROKEN"},
+		{ID: "after", Problem: "loop", Language: "python", Code: "ok"},
+	}
+
+	factory := &fakeFactory{}
+	var reported []string
+	results, err := Run(context.Background(), cases, Options{
+		Parallelism: 2,
+		Timeout:     time.Minute,
+		Factory:     factory.create,
+		Reuse:       true,
+		OnResult:    func(r CaseResult) { reported = append(reported, r.ID) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Status{
+		"pass":         StatusPassed,
+		"output":       StatusPassed,
+		"wrong output": StatusFailed,
+		"exit":         StatusFailed,
+		"hang":         StatusTimedOut,
+		"broken":       StatusError,
+		"after":        StatusPassed,
+	}
+	for i, r := range results {
+		if r.ID != cases[i].ID {
+			t.Fatalf("expected results in the order of cases, got %s at %d", r.ID, i)
+		}
+		if r.Status != want[r.ID] {
+			t.Errorf("%s: expected %s, got %s (%s)", r.ID, want[r.ID], r.Status, r.Error)
+		}
+	}
+	if results[3].ExitCode != 1 {
+		t.Errorf("expected the exit code to be reported, got %d", results[3].ExitCode)
+	}
+	if len(reported) != len(cases) {
+		t.Errorf("expected every result to be reported, got %v", reported)
+	}
+
+	if factory.maxLive > 2 {
+		t.Errorf("expected at most 2 sandboxes at once, got %d", factory.maxLive)
+	}
+	if factory.live != 0 {
+		t.Errorf("expected every sandbox to be destroyed, %d left", factory.live)
+	}
+	if factory.created >= len(cases) {
+		t.Errorf("expected sandboxes to be reused, created %d for %d cases", factory.created, len(cases))
+	}
+}
+
+func TestRunWithoutReuse(t *testing.T) {
+	cases := []Case{
+		{ID: "1", Language: "python", Code: "ok"},
+		{ID: "2", Language: "python", Code: "ok"},
+		{ID: "3", Language: "python", Code: "HANG", Timeout: 0.05},
+	}
+
+	factory := &fakeFactory{}
+	results, err := Run(context.Background(), cases, Options{Factory: factory.create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Status == StatusError {
+			t.Errorf("%s: unexpected error %s", r.ID, r.Error)
+		}
+	}
+	if factory.created != len(cases) || factory.live != 0 {
+		t.Errorf("expected a sandbox per case, all destroyed; created %d, %d left", factory.created, factory.live)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	factory := &fakeFactory{}
+
+	cases := []Case{
+		{ID: "1", Language: "python", Code: "ok"},
+		{ID: "2", Language: "python", Code: "HANG"},
+		{ID: "3", Language: "python", Code: "ok"},
+	}
+	results, err := Run(ctx, cases, Options{
+		Factory: factory.create,
+		OnResult: func(r CaseResult) {
+			if r.ID == "1" {
+				cancel()
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "1" {
+		t.Fatalf("expected only the finished case, got %+v", results)
+	}
+	if factory.live != 0 {
+		t.Errorf("expected every sandbox to be destroyed, %d left", factory.live)
+	}
+}
+
+func TestReadCases(t *testing.T) {
+	input := `{"language": "python", "code": "print(1)", "expected_output": ""}
+
+{"id": "b", "problem": "p", "language": "go", "code": "package main", "tests": "func main() {}"}
+`
+	cases, err := ReadCases(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("expected 2 cases, got %d", len(cases))
+	}
+	if cases[0].ID != "1" || cases[0].Problem != "1" {
+		t.Errorf("expected the line number as ID and problem, got %q and %q", cases[0].ID, cases[0].Problem)
+	}
+	if cases[0].ExpectedOutput == nil || *cases[0].ExpectedOutput != "" {
+		t.Errorf("expected an empty expected output to be kept")
+	}
+	if cases[1].Problem != "p" || cases[1].Tests == "" {
+		t.Errorf("unexpected case %+v", cases[1])
+	}
+
+	for name, input := range map[string]string{
+		"bad json":     `{"language": "python",`,
+		"bad language": `{"language": "cobol", "code": "x"}`,
+		"no code":      `{"language": "python"}`,
+	} {
+		if _, err := ReadCases(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%s: expected an error naming the line, got %v", name, err)
+		}
+	}
+}
+
+func TestPassAtK(t *testing.T) {
+	for _, tc := range []struct {
+		n, c, k int
+		want    float64
+		ok      bool
+	}{
+		{n: 10, c: 0, k: 1, want: 0, ok: true},
+		{n: 10, c: 10, k: 5, want: 1, ok: true},
+		{n: 2, c: 1, k: 1, want: 0.5, ok: true},
+		// 1 - C(3,2)/C(5,2)
+		{n: 5, c: 2, k: 2, want: 0.7, ok: true},
+		{n: 5, c: 1, k: 5, want: 1, ok: true},
+		{n: 1, c: 1, k: 2, ok: false},
+	} {
+		got, ok := PassAtK(tc.n, tc.c, tc.k)
+		if ok != tc.ok || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("pass@%d with %d of %d: expected %v %v, got %v %v", tc.k, tc.c, tc.n, tc.want, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestSummarizeAndReport(t *testing.T) {
+	results := []CaseResult{
+		{ID: "1", Problem: "a", Language: "python", Status: StatusPassed},
+		{ID: "2", Problem: "a", Language: "python", Status: StatusFailed},
+		{ID: "3", Problem: "b", Language: "python", Status: StatusTimedOut},
+		{ID: "4", Problem: "b", Language: "python", Status: StatusError},
+	}
+	summary := Summarize(results, []int{2, 1})
+
+	if summary.Passed != 1 || summary.Failed != 1 || summary.TimedOut != 1 || summary.Errors != 1 {
+		t.Fatalf("unexpected counts %+v", summary)
+	}
+	// The errored case is left out of problem b's samples
+	if got := summary.PassAtK[1]; got != 0.25 {
+		t.Errorf("expected pass@1 of 0.25, got %v", got)
+	}
+	if got := summary.PassAtK[2]; got != 1 {
+		t.Errorf("expected pass@2 of 1 from problem a alone, got %v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, FormatCSV, summary); err != nil {
+		t.Fatal(err)
+	}
+	want := `problem,language,samples,correct,pass@1,pass@2
+a,python,2,1,0.5000,1.0000
+b,python,1,0,0.0000,
+(all),,3,1,0.2500,1.0000
+`
+	if buf.String() != want {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteResults(&buf, FormatJSONL, results); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != len(results) {
+		t.Errorf("expected a line per result, got %d", lines)
+	}
+	if FormatForPath("report.CSV") != FormatCSV || FormatForPath("report.jsonl") != FormatJSONL {
+		t.Error("unexpected format for path")
+	}
+}
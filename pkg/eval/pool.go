@@ -0,0 +1,117 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/sdk"
+)
+
+// Sandbox is the part of sdk.Sandboxed that eval uses
+type Sandbox interface {
+	Run(code string) (*sdk.Output, error)
+	RunProjectContext(ctx context.Context, project sdk.Project) (*sdk.Output, error)
+	Destroy() error
+}
+
+// Factory creates a sandbox for a language
+type Factory func(lang sdk.Language) (Sandbox, error)
+
+// SandboxFactory creates sandboxes with the SDK, applying opts to each
+func SandboxFactory(opts ...sdk.SandboxOption) Factory {
+	return func(lang sdk.Language) (Sandbox, error) {
+		return sdk.CreateSandbox(fmt.Sprintf("eval-%s-%d", lang, time.Now().UnixNano()), lang, opts...)
+	}
+}
+
+// pool holds at most size sandboxes, idle or in use. Each worker holds at
+// most one sandbox and there are as many workers as the pool's size, so a
+// worker always finds an idle sandbox or room for a new one.
+type pool struct {
+	mu      sync.Mutex
+	size    int
+	live    int
+	idle    []pooled
+	factory Factory
+}
+
+type pooled struct {
+	lang    sdk.Language
+	sandbox Sandbox
+}
+
+func newPool(size int, factory Factory) *pool {
+	return &pool{size: size, factory: factory}
+}
+
+// acquire returns an idle sandbox for lang, creating one when there is room
+// and otherwise replacing the longest idle sandbox of another language
+func (p *pool) acquire(lang sdk.Language) (Sandbox, error) {
+	p.mu.Lock()
+	for i, e := range p.idle {
+		if e.lang == lang {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			p.mu.Unlock()
+			return e.sandbox, nil
+		}
+	}
+
+	var evicted Sandbox
+	switch {
+	case p.live < p.size:
+		p.live++
+	case len(p.idle) > 0:
+		evicted = p.idle[0].sandbox
+		p.idle = p.idle[1:]
+	default:
+		p.mu.Unlock()
+		return nil, errors.New("sandbox pool is exhausted")
+	}
+	p.mu.Unlock()
+
+	if evicted != nil {
+		_ = evicted.Destroy()
+	}
+	sandbox, err := p.factory(lang)
+	if err != nil {
+		p.mu.Lock()
+		p.live--
+		p.mu.Unlock()
+		return nil, err
+	}
+	return sandbox, nil
+}
+
+// release returns a sandbox to the pool, or destroys it when it cannot be
+// reused
+func (p *pool) release(lang sdk.Language, sandbox Sandbox, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if healthy {
+		p.idle = append(p.idle, pooled{lang: lang, sandbox: sandbox})
+		return
+	}
+	p.live--
+	_ = sandbox.Destroy()
+}
+
+// close destroys the idle sandboxes
+func (p *pool) close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.live -= len(idle)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, e := range idle {
+		if err := e.sandbox.Destroy(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,198 @@
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PassAtK estimates the probability that at least one of k samples passes,
+// given that c of n samples passed, with the unbiased estimator from
+// "Evaluating Large Language Models Trained on Code". It reports false when
+// there are fewer than k samples.
+func PassAtK(n, c, k int) (float64, bool) {
+	if k < 1 || n < k {
+		return 0, false
+	}
+	if n-c < k {
+		return 1, true
+	}
+	// 1 - C(n-c, k) / C(n, k), as a product to stay within float range
+	fail := 1.0
+	for i := n - c + 1; i <= n; i++ {
+		fail *= 1 - float64(k)/float64(i)
+	}
+	return 1 - fail, true
+}
+
+// Summary scores a run
+type Summary struct {
+	Cases    int `json:"cases"`
+	Passed   int `json:"passed"`
+	Failed   int `json:"failed"`
+	TimedOut int `json:"timed_out"`
+	Errors   int `json:"errors"`
+	// K lists the k that pass@k is computed for
+	K []int `json:"k"`
+	// PassAtK is the mean over problems with at least k samples that ran
+	PassAtK  map[int]float64  `json:"pass_at_k"`
+	Problems []ProblemSummary `json:"problems"`
+}
+
+// ProblemSummary scores the samples of one problem. Samples excludes cases
+// that could not be run, which say nothing about the solution.
+type ProblemSummary struct {
+	Problem  string          `json:"problem"`
+	Language string          `json:"language"`
+	Samples  int             `json:"samples"`
+	Correct  int             `json:"correct"`
+	PassAtK  map[int]float64 `json:"pass_at_k"`
+}
+
+// Summarize counts results and computes pass@k for each of ks. Cases with
+// StatusError are counted but not scored.
+func Summarize(results []CaseResult, ks []int) Summary {
+	ks = append([]int(nil), ks...)
+	sort.Ints(ks)
+	summary := Summary{Cases: len(results), K: ks, PassAtK: map[int]float64{}}
+
+	problems := map[string]*ProblemSummary{}
+	for _, r := range results {
+		switch r.Status {
+		case StatusPassed:
+			summary.Passed++
+		case StatusFailed:
+			summary.Failed++
+		case StatusTimedOut:
+			summary.TimedOut++
+		case StatusError:
+			summary.Errors++
+		}
+
+		p := problems[r.Problem]
+		if p == nil {
+			p = &ProblemSummary{Problem: r.Problem, Language: r.Language}
+			problems[r.Problem] = p
+		}
+		if r.Status == StatusError {
+			continue
+		}
+		p.Samples++
+		if r.Passed() {
+			p.Correct++
+		}
+	}
+
+	totals := map[int]float64{}
+	counts := map[int]int{}
+	for _, p := range problems {
+		p.PassAtK = map[int]float64{}
+		for _, k := range ks {
+			if score, ok := PassAtK(p.Samples, p.Correct, k); ok {
+				p.PassAtK[k] = score
+				totals[k] += score
+				counts[k]++
+			}
+		}
+		summary.Problems = append(summary.Problems, *p)
+	}
+	for k, total := range totals {
+		summary.PassAtK[k] = total / float64(counts[k])
+	}
+	sort.Slice(summary.Problems, func(i, j int) bool {
+		return summary.Problems[i].Problem < summary.Problems[j].Problem
+	})
+	return summary
+}
+
+// Format is the file format of results and reports
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+)
+
+// FormatForPath picks the format from a file's extension, JSONL unless it
+// is .csv
+func FormatForPath(path string) Format {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSONL
+}
+
+// WriteResults writes one row per case
+func WriteResults(w io.Writer, format Format, results []CaseResult) error {
+	if format == FormatCSV {
+		rows := [][]string{{"id", "problem", "language", "status", "exit_code", "duration", "error", "output"}}
+		for _, r := range results {
+			rows = append(rows, []string{
+				r.ID, r.Problem, r.Language, string(r.Status), strconv.Itoa(r.ExitCode),
+				formatFloat(r.Duration), r.Error, r.Output,
+			})
+		}
+		return csv.NewWriter(w).WriteAll(rows)
+	}
+
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TotalProblem names the report row that covers every problem
+const TotalProblem = "(all)"
+
+// WriteReport writes one row per problem with its pass@k, followed by a
+// TotalProblem row with the counts and pass@k of the whole run
+func WriteReport(w io.Writer, format Format, summary Summary) error {
+	rows := append(append([]ProblemSummary(nil), summary.Problems...), ProblemSummary{
+		Problem: TotalProblem,
+		Samples: summary.Cases - summary.Errors,
+		Correct: summary.Passed,
+		PassAtK: summary.PassAtK,
+	})
+
+	if format == FormatCSV {
+		header := []string{"problem", "language", "samples", "correct"}
+		for _, k := range summary.K {
+			header = append(header, fmt.Sprintf("pass@%d", k))
+		}
+		records := [][]string{header}
+		for _, p := range rows {
+			record := []string{p.Problem, p.Language, strconv.Itoa(p.Samples), strconv.Itoa(p.Correct)}
+			for _, k := range summary.K {
+				// Left empty when the problem has fewer than k samples
+				score, ok := p.PassAtK[k]
+				if ok {
+					record = append(record, formatFloat(score))
+				} else {
+					record = append(record, "")
+				}
+			}
+			records = append(records, record)
+		}
+		return csv.NewWriter(w).WriteAll(records)
+	}
+
+	enc := json.NewEncoder(w)
+	for _, p := range rows {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
@@ -0,0 +1,310 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/webhook"
+)
+
+// Status describes where a job is in its lifecycle
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Done reports whether the job has reached a terminal state
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+var (
+	// ErrQueueFull is returned by Submit when every worker is busy and the queue is at capacity
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrNotFound is returned when no job exists with the given ID
+	ErrNotFound = errors.New("job not found")
+	// ErrStopped is returned by Submit after the manager has been stopped
+	ErrStopped = errors.New("job manager is stopped")
+)
+
+// Result is what a RunFunc reports back when it finishes
+type Result struct {
+	Output []string
+	// Truncated and OutputFile describe output cut to the output limit
+	Truncated  bool
+	OutputFile string
+	ExitCode   int
+}
+
+// RunFunc performs the work of a job. It must return promptly once ctx is cancelled.
+type RunFunc func(ctx context.Context) (*Result, error)
+
+// Job is a point-in-time snapshot of an asynchronous execution
+type Job struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	Output     []string   `json:"output,omitempty"`
+	Truncated  bool       `json:"truncated,omitempty"`
+	OutputFile string     `json:"output_file,omitempty"`
+	ExitCode   int        `json:"exit_code"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Deliveries  []webhook.Attempt `json:"deliveries,omitempty"`
+}
+
+// SubmitOption customises a submitted job
+type SubmitOption func(*Job)
+
+// WithCallback posts the finished job to callbackURL through the manager's Notifier
+func WithCallback(callbackURL string) SubmitOption {
+	return func(j *Job) {
+		j.CallbackURL = callbackURL
+	}
+}
+
+type entry struct {
+	job    Job
+	run    RunFunc
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Manager runs submitted jobs on a bounded pool of workers and keeps their
+// results around for polling
+type Manager struct {
+	mu      sync.RWMutex
+	jobs    map[string]*entry
+	queue   chan *entry
+	wg      sync.WaitGroup
+	stopped bool
+
+	// Retention is how long finished jobs are kept before being pruned
+	Retention time.Duration
+	// Notifier delivers finished jobs that were submitted with a callback URL
+	Notifier *webhook.Notifier
+}
+
+// NewManager creates a manager with the given number of workers and queue
+// capacity and starts the workers
+func NewManager(workers, queueSize int) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	m := &Manager{
+		jobs:      make(map[string]*entry),
+		queue:     make(chan *entry, queueSize),
+		Retention: time.Hour,
+	}
+
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	return m
+}
+
+// Submit queues run for execution and returns the queued job
+func (m *Manager) Submit(run RunFunc, opts ...SubmitOption) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Status:    StatusQueued,
+			CreatedAt: time.Now(),
+		},
+		run:    run,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, opt := range opts {
+		opt(&e.job)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		cancel()
+		return Job{}, ErrStopped
+	}
+
+	m.pruneLocked()
+
+	select {
+	case m.queue <- e:
+	default:
+		cancel()
+		return Job{}, ErrQueueFull
+	}
+
+	m.jobs[id] = e
+	return e.job, nil
+}
+
+// Get returns a snapshot of the job with the given ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return snapshot(e.job), nil
+}
+
+// Cancel stops a queued or running job. Cancelling a finished job is a no-op.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	if !e.job.Status.Done() {
+		e.cancel()
+		if e.job.Status == StatusQueued {
+			m.finishLocked(e, StatusCancelled, nil, context.Canceled)
+		}
+	}
+	return snapshot(e.job), nil
+}
+
+// Stop cancels all outstanding jobs and waits for the workers to exit
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	m.stopped = true
+	for _, e := range m.jobs {
+		e.cancel()
+	}
+	close(m.queue)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+
+	for e := range m.queue {
+		m.mu.Lock()
+		if e.job.Status != StatusQueued {
+			// Cancelled while waiting in the queue
+			m.mu.Unlock()
+			continue
+		}
+		if e.ctx.Err() != nil {
+			// The manager was stopped before this job got a worker
+			m.finishLocked(e, StatusCancelled, nil, e.ctx.Err())
+			m.mu.Unlock()
+			continue
+		}
+		now := time.Now()
+		e.job.Status = StatusRunning
+		e.job.StartedAt = &now
+		m.mu.Unlock()
+
+		result, err := e.run(e.ctx)
+
+		m.mu.Lock()
+		switch {
+		case e.ctx.Err() != nil:
+			m.finishLocked(e, StatusCancelled, result, e.ctx.Err())
+		case err != nil:
+			m.finishLocked(e, StatusFailed, result, err)
+		default:
+			m.finishLocked(e, StatusSucceeded, result, nil)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) finishLocked(e *entry, status Status, result *Result, err error) {
+	now := time.Now()
+	e.job.Status = status
+	e.job.FinishedAt = &now
+	if result != nil {
+		e.job.Output = result.Output
+		e.job.Truncated, e.job.OutputFile = result.Truncated, result.OutputFile
+		e.job.ExitCode = result.ExitCode
+	}
+	if err != nil {
+		e.job.Error = err.Error()
+	}
+	e.cancel()
+
+	if e.job.CallbackURL != "" && m.Notifier != nil {
+		go m.notify(e.job)
+	}
+}
+
+// notify delivers a finished job to its callback URL, recording each attempt on the job
+func (m *Manager) notify(job Job) {
+	record := func(a webhook.Attempt) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if e, ok := m.jobs[job.ID]; ok {
+			e.job.Deliveries = append(e.job.Deliveries, a)
+		}
+	}
+
+	if err := m.Notifier.Deliver(context.Background(), job.CallbackURL, job, record); err != nil {
+		log.Printf("job %s: %v", job.ID, err)
+	}
+}
+
+func (m *Manager) pruneLocked() {
+	if m.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-m.Retention)
+	for id, e := range m.jobs {
+		if e.job.FinishedAt != nil && e.job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot copies a job so callers never share the deliveries slice with the manager
+func snapshot(job Job) Job {
+	job.Deliveries = append([]webhook.Attempt(nil), job.Deliveries...)
+	return job
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "job-" + hex.EncodeToString(b), nil
+}
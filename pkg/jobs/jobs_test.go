@@ -0,0 +1,166 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/jobs"
+	"github.com/system32-ai/sandboxed/pkg/webhook"
+)
+
+func waitForStatus(t *testing.T, m *jobs.Manager, id string, want jobs.Status) jobs.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if job.Status == want {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s never reached status %s", id, want)
+	return jobs.Job{}
+}
+
+func TestJobSucceeds(t *testing.T) {
+	m := jobs.NewManager(1, 1)
+	defer m.Stop()
+
+	job, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) {
+		return &jobs.Result{Output: []string{"hello"}, Truncated: true, OutputFile: "/tmp/out.log", ExitCode: 0}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+
+	done := waitForStatus(t, m, job.ID, jobs.StatusSucceeded)
+	if len(done.Output) != 1 || done.Output[0] != "hello" {
+		t.Fatalf("unexpected output: %v", done.Output)
+	}
+	if !done.Truncated || done.OutputFile != "/tmp/out.log" {
+		t.Fatalf("expected the truncation to be reported, got %v %q", done.Truncated, done.OutputFile)
+	}
+	if done.FinishedAt == nil {
+		t.Fatal("expected finished timestamp to be set")
+	}
+}
+
+func TestJobFailureKeepsExitCode(t *testing.T) {
+	m := jobs.NewManager(1, 1)
+	defer m.Stop()
+
+	job, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) {
+		return &jobs.Result{ExitCode: 3}, errors.New("boom")
+	})
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+
+	done := waitForStatus(t, m, job.ID, jobs.StatusFailed)
+	if done.ExitCode != 3 || done.Error != "boom" {
+		t.Fatalf("unexpected result: exit=%d error=%q", done.ExitCode, done.Error)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	m := jobs.NewManager(1, 1)
+	defer m.Stop()
+
+	started := make(chan struct{})
+	job, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+
+	<-started
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("failed to cancel job: %v", err)
+	}
+
+	waitForStatus(t, m, job.ID, jobs.StatusCancelled)
+}
+
+func TestQueueIsBounded(t *testing.T) {
+	m := jobs.NewManager(1, 1)
+	defer m.Stop()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	running := make(chan struct{})
+	first, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) {
+		close(running)
+		<-block
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to submit first job: %v", err)
+	}
+	<-running
+
+	queued, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) { return nil, nil })
+	if err != nil {
+		t.Fatalf("failed to submit queued job: %v", err)
+	}
+
+	if _, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) { return nil, nil }); !errors.Is(err, jobs.ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	// A queued job can be cancelled before it ever reaches a worker
+	cancelled, err := m.Cancel(queued.ID)
+	if err != nil {
+		t.Fatalf("failed to cancel queued job: %v", err)
+	}
+	if cancelled.Status != jobs.StatusCancelled {
+		t.Fatalf("expected queued job to be cancelled, got %s", cancelled.Status)
+	}
+
+	if _, err := m.Get(first.ID); err != nil {
+		t.Fatalf("failed to get first job: %v", err)
+	}
+}
+
+func TestJobCallbackRecordsDeliveries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	m := jobs.NewManager(1, 1)
+	m.Notifier = webhook.NewNotifier("s3cret")
+	m.Notifier.AllowPrivate = true
+	defer m.Stop()
+
+	job, err := m.Submit(func(ctx context.Context) (*jobs.Result, error) {
+		return &jobs.Result{Output: []string{"ok"}}, nil
+	}, jobs.WithCallback(srv.URL))
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, _ := m.Get(job.ID)
+		if len(got.Deliveries) == 1 {
+			if got.Deliveries[0].StatusCode != http.StatusOK {
+				t.Fatalf("unexpected delivery: %+v", got.Deliveries[0])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("delivery attempt was never recorded on the job")
+}
@@ -1,29 +1,36 @@
 package k8sclient
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/client-go/util/homedir"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // Client wraps the Kubernetes clientset
 type Client struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 	config    *rest.Config
 	namespace string
+
+	dynamicOnce sync.Once
+	dynamic     dynamic.Interface
+	dynamicErr  error
 }
 
 // PodSpec represents the configuration for creating a pod
@@ -32,37 +39,99 @@ type PodSpec struct {
 	Namespace string
 	Image     string
 	Command   []string
-	Args      []string
-	Labels    map[string]string
+	Args        []string
+	Labels      map[string]string
+	Annotations map[string]string
+	Volumes     []Volume
+	// Env sets plain environment variables; Secrets exposes Kubernetes
+	// Secrets without their values passing through the client
+	Env     map[string]string
+	Secrets []SecretRef
+	// Resources and WorkingDir configure the sandbox container
+	Resources  Resources
+	WorkingDir string
+	// RuntimeClassName selects a RuntimeClass such as gVisor for the pod
+	RuntimeClassName string
 }
 
-// NewClient creates a new Kubernetes client
-func NewClient(namespace string) (*Client, error) {
-	// Try to get the kubeconfig from the default location
-	var kubeconfig string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = filepath.Join(home, ".kube", "config")
+// Client-side rate limits used unless the rest.Config sets its own
+const (
+	DefaultQPS   = 50
+	DefaultBurst = 100
+)
+
+// ClientOptions selects how a client connects to the cluster
+type ClientOptions struct {
+	// Namespace is the default namespace, "default" when empty
+	Namespace string
+	// Config is used as is when set
+	Config *rest.Config
+	// Kubeconfig is the kubeconfig file to load. When empty, $KUBECONFIG
+	// and ~/.kube/config are tried, then the in-cluster config.
+	Kubeconfig string
+	// Context selects a kubeconfig context instead of the current one
+	Context string
+	// InCluster uses the pod's service account and skips kubeconfig lookup
+	InCluster bool
+}
+
+// Validate rejects options that select the cluster in two ways
+func (o ClientOptions) Validate() error {
+	if o.InCluster && (o.Config != nil || o.Kubeconfig != "" || o.Context != "") {
+		return errors.New("in-cluster config cannot be combined with a kubeconfig, context or rest config")
+	}
+	if o.Config != nil && (o.Kubeconfig != "" || o.Context != "") {
+		return errors.New("a rest config cannot be combined with a kubeconfig or context")
 	}
+	return nil
+}
 
-	var config *rest.Config
-	var err error
+// NewClient creates a new Kubernetes client
+func NewClient(namespace string) (*Client, error) {
+	return NewClientWithOptions(ClientOptions{Namespace: namespace})
+}
 
-	// Try to use out-of-cluster config first (kubeconfig file)
-	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
-		// If that fails, try in-cluster config
-		config, err = rest.InClusterConfig()
+// NewClientWithOptions creates a Kubernetes client from a custom rest.Config,
+// a kubeconfig file and context, or the in-cluster config. A client is safe for concurrent use and
+// meant to be shared, since each one holds its own connection pool.
+func NewClientWithOptions(opts ClientOptions) (*Client, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	config := opts.Config
+	if config == nil {
+		var err error
+		if opts.InCluster {
+			config, err = rest.InClusterConfig()
+		} else {
+			config, err = loadConfig(opts.Kubeconfig, opts.Context)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to create kubernetes config: %v", err)
 		}
 	}
 
+	// A shared client serves every sandbox, so client-go's default limit of
+	// 5 requests per second would throttle it
+	if config.QPS == 0 && config.Burst == 0 {
+		config = rest.CopyConfig(config)
+		config.QPS = DefaultQPS
+		config.Burst = DefaultBurst
+	}
+
 	// Create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
 	}
 
+	return NewClientFromClientset(clientset, config, opts.Namespace), nil
+}
+
+// NewClientFromClientset wraps an existing clientset, such as a fake one in
+// tests. config is only needed for exec and may be nil otherwise.
+func NewClientFromClientset(clientset kubernetes.Interface, config *rest.Config, namespace string) *Client {
 	if namespace == "" {
 		namespace = "default"
 	}
@@ -71,7 +140,51 @@ func NewClient(namespace string) (*Client, error) {
 		clientset: clientset,
 		config:    config,
 		namespace: namespace,
-	}, nil
+	}
+}
+
+// loadConfig reads a kubeconfig, falling back to the in-cluster config when
+// no kubeconfig exists and none was asked for explicitly
+func loadConfig(kubeconfig, context string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err == nil {
+		return config, nil
+	}
+	if kubeconfig != "" || context != "" || !clientcmd.IsEmptyConfig(err) {
+		return nil, err
+	}
+
+	return rest.InClusterConfig()
+}
+
+// Namespace returns the client's default namespace
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// Dynamic returns a dynamic client for custom resources, sharing the
+// client's configuration. It is created on first use.
+func (c *Client) Dynamic() (dynamic.Interface, error) {
+	c.dynamicOnce.Do(func() {
+		if c.config == nil {
+			c.dynamicErr = errors.New("client has no rest config for a dynamic client")
+			return
+		}
+		c.dynamic, c.dynamicErr = dynamic.NewForConfig(c.config)
+	})
+	return c.dynamic, c.dynamicErr
+}
+
+// SetDynamic replaces the dynamic client, such as with a fake one in tests
+func (c *Client) SetDynamic(client dynamic.Interface) {
+	c.dynamicOnce.Do(func() {})
+	c.dynamic, c.dynamicErr = client, nil
 }
 
 // CreatePod creates a new pod in the cluster
@@ -80,6 +193,27 @@ func (c *Client) CreatePod(spec PodSpec) (*corev1.Pod, error) {
 		spec.Namespace = c.namespace
 	}
 
+	pod, err := BuildPod(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the pod
+	createdPod, err := c.clientset.CoreV1().Pods(spec.Namespace).Create(
+		context.TODO(),
+		pod,
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pod: %v", err)
+	}
+
+	return createdPod, nil
+}
+
+// BuildPod turns a PodSpec into the pod CreatePod would create, for callers
+// that create pods through another client
+func BuildPod(spec PodSpec) (*corev1.Pod, error) {
 	if spec.Labels == nil {
 		spec.Labels = make(map[string]string)
 	}
@@ -90,9 +224,10 @@ func (c *Client) CreatePod(spec PodSpec) (*corev1.Pod, error) {
 
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      spec.Name,
-			Namespace: spec.Namespace,
-			Labels:    spec.Labels,
+			Name:        spec.Name,
+			Namespace:   spec.Namespace,
+			Labels:      spec.Labels,
+			Annotations: spec.Annotations,
 		},
 		Spec: corev1.PodSpec{
 			RestartPolicy: corev1.RestartPolicyNever,
@@ -113,17 +248,24 @@ func (c *Client) CreatePod(spec PodSpec) (*corev1.Pod, error) {
 		pod.Spec.Containers[0].Args = spec.Args
 	}
 
-	// Create the pod
-	createdPod, err := c.clientset.CoreV1().Pods(spec.Namespace).Create(
-		context.TODO(),
-		pod,
-		metav1.CreateOptions{},
-	)
+	if err := applyVolumes(pod, spec); err != nil {
+		return nil, err
+	}
+	if err := applyEnv(pod, spec); err != nil {
+		return nil, err
+	}
+
+	resources, err := spec.Resources.requirements()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create pod: %v", err)
+		return nil, err
+	}
+	pod.Spec.Containers[0].Resources = resources
+	pod.Spec.Containers[0].WorkingDir = spec.WorkingDir
+	if spec.RuntimeClassName != "" {
+		pod.Spec.RuntimeClassName = &spec.RuntimeClassName
 	}
 
-	return createdPod, nil
+	return pod, nil
 }
 
 // DeletePod deletes a pod from the cluster
@@ -168,17 +310,22 @@ func (c *Client) DeletePodWithOptions(name, namespace string, force bool) error
 
 // GetPod retrieves a pod by name
 func (c *Client) GetPod(name, namespace string) (*corev1.Pod, error) {
+	return c.GetPodContext(context.TODO(), name, namespace)
+}
+
+// GetPodContext is GetPod with cancellation
+func (c *Client) GetPodContext(ctx context.Context, name, namespace string) (*corev1.Pod, error) {
 	if namespace == "" {
 		namespace = c.namespace
 	}
 
 	pod, err := c.clientset.CoreV1().Pods(namespace).Get(
-		context.TODO(),
+		ctx,
 		name,
 		metav1.GetOptions{},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pod %s in namespace %s: %v", name, namespace, err)
+		return nil, fmt.Errorf("failed to get pod %s in namespace %s: %w", name, namespace, err)
 	}
 
 	return pod, nil
@@ -201,64 +348,161 @@ func (c *Client) ListPods(namespace string) (*corev1.PodList, error) {
 	return pods, nil
 }
 
-// WaitForPodReady waits for a pod to be in Ready state
-func (c *Client) WaitForPodReady(name, namespace string, timeout time.Duration) error {
+// ListPodsWithSelector lists the pods in the namespace matching a label selector
+func (c *Client) ListPodsWithSelector(namespace, selector string) (*corev1.PodList, error) {
 	if namespace == "" {
 		namespace = c.namespace
 	}
 
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(
+		context.TODO(),
+		metav1.ListOptions{LabelSelector: selector},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in namespace %s: %v", namespace, err)
+	}
+
+	return pods, nil
+}
+
+// ListPodsInAllNamespaces lists pods matching a label selector across the
+// whole cluster
+func (c *Client) ListPodsInAllNamespaces(selector string) (*corev1.PodList, error) {
+	return c.ListPodsInAllNamespacesContext(context.Background(), selector)
+}
+
+// ListPodsInAllNamespacesContext is ListPodsInAllNamespaces with cancellation
+func (c *Client) ListPodsInAllNamespacesContext(ctx context.Context, selector string) (*corev1.PodList, error) {
+	pods, err := c.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in all namespaces: %v", err)
+	}
+
+	return pods, nil
+}
+
+// PatchPodMetadata merges labels and annotations into an existing pod
+func (c *Client) PatchPodMetadata(name, namespace string, labels, annotations map[string]string) error {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode patch for pod %s: %v", name, err)
+	}
+
+	_, err = c.clientset.CoreV1().Pods(namespace).Patch(
+		context.TODO(),
+		name,
+		types.MergePatchType,
+		patch,
+		metav1.PatchOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to patch pod %s in namespace %s: %v", name, namespace, err)
+	}
+
+	return nil
+}
+
+// WaitForPodReady waits for a pod to be in Ready state
+func (c *Client) WaitForPodReady(name, namespace string, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	return c.WaitForPodReadyContext(ctx, name, namespace)
+}
+
+// WaitForPodReadyContext waits for a pod to be in Ready state until ctx is done
+func (c *Client) WaitForPodReadyContext(ctx context.Context, name, namespace string) error {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
 	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for pod %s to be ready", name)
-		default:
-			pod, err := c.GetPod(name, namespace)
-			if err != nil {
-				return err
-			}
+		pod, err := c.GetPod(name, namespace)
+		if err != nil {
+			return err
+		}
 
-			for _, condition := range pod.Status.Conditions {
-				if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
-					return nil
-				}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				return nil
 			}
+		}
 
-			time.Sleep(2 * time.Second)
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return fmt.Errorf("cancelled waiting for pod %s to be ready: %w", name, ctx.Err())
+			}
+			return fmt.Errorf("timeout waiting for pod %s to be ready", name)
+		case <-ticker.C:
 		}
 	}
 }
 
 // GetPodLogs retrieves logs from a pod
 func (c *Client) GetPodLogs(name, namespace string) (string, error) {
+	return c.GetPodLogsContext(context.Background(), name, namespace)
+}
+
+// GetPodLogsContext retrieves logs from a pod until ctx is done, within
+// the output limits
+func (c *Client) GetPodLogsContext(ctx context.Context, name, namespace string) (string, error) {
+	logs, err := c.GetPodLogsOutputContext(ctx, name, namespace)
+	if logs == nil {
+		return "", err
+	}
+	return logs.Text, err
+}
+
+// LogOptions selects which of a pod's logs are streamed
+type LogOptions struct {
+	// Container names the container; the pod's only container when empty
+	Container string
+	// Follow keeps the stream open for new output until the container exits
+	// or ctx is done
+	Follow bool
+	// TailLines starts with the last n lines; all lines when nil
+	TailLines *int64
+	// SinceSeconds starts with output from the last n seconds; all when zero
+	SinceSeconds int64
+	// Timestamps prefixes each line with its RFC3339 timestamp
+	Timestamps bool
+}
+
+// StreamPodLogs opens a pod's logs. The caller closes the stream; when
+// following, closing it or cancelling ctx stops the stream.
+func (c *Client) StreamPodLogs(ctx context.Context, name, namespace string, opts LogOptions) (io.ReadCloser, error) {
 	if namespace == "" {
 		namespace = c.namespace
 	}
 
-	podLogOpts := corev1.PodLogOptions{}
-	req := c.clientset.CoreV1().Pods(namespace).GetLogs(name, &podLogOpts)
-	podLogs, err := req.Stream(context.TODO())
-	if err != nil {
-		return "", fmt.Errorf("failed to get logs for pod %s: %v", name, err)
+	podLogOpts := &corev1.PodLogOptions{
+		Container:  opts.Container,
+		Follow:     opts.Follow,
+		TailLines:  opts.TailLines,
+		Timestamps: opts.Timestamps,
 	}
-	defer podLogs.Close()
-
-	buf := make([]byte, 2048)
-	var logs string
-	for {
-		numBytes, err := podLogs.Read(buf)
-		if numBytes == 0 {
-			break
-		}
-		if err != nil {
-			break
-		}
-		logs += string(buf[:numBytes])
+	if opts.SinceSeconds > 0 {
+		podLogOpts.SinceSeconds = &opts.SinceSeconds
 	}
 
-	return logs, nil
+	podLogs, err := c.clientset.CoreV1().Pods(namespace).GetLogs(name, podLogOpts).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs for pod %s: %w", name, err)
+	}
+	return podLogs, nil
 }
 
 // ExecOptions represents options for executing commands in a pod
@@ -273,6 +517,11 @@ type ExecOptions struct {
 
 // ExecInPod executes a command in a running pod
 func (c *Client) ExecInPod(podName, namespace string, options ExecOptions) error {
+	return c.ExecInPodContext(context.Background(), podName, namespace, options)
+}
+
+// ExecInPodContext executes a command in a running pod, aborting the stream when ctx is done
+func (c *Client) ExecInPodContext(ctx context.Context, podName, namespace string, options ExecOptions) error {
 	if namespace == "" {
 		namespace = c.namespace
 	}
@@ -313,14 +562,14 @@ func (c *Client) ExecInPod(podName, namespace string, options ExecOptions) error
 		return fmt.Errorf("failed to create executor: %v", err)
 	}
 
-	err = exec.Stream(remotecommand.StreamOptions{
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
 		Stdin:  options.Stdin,
 		Stdout: options.Stdout,
 		Stderr: options.Stderr,
 		Tty:    options.TTY,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to execute command in pod: %v", err)
+		return fmt.Errorf("failed to execute command in pod: %w", err)
 	}
 
 	return nil
@@ -328,31 +577,44 @@ func (c *Client) ExecInPod(podName, namespace string, options ExecOptions) error
 
 // ExecCommand executes a command in a pod and returns the output
 func (c *Client) ExecCommand(podName, namespace string, command []string) (string, error) {
-	if namespace == "" {
-		namespace = c.namespace
-	}
+	return c.ExecCommandContext(context.Background(), podName, namespace, command)
+}
 
-	var stdout, stderr bytes.Buffer
+// ExecCommandContext executes a command in a pod and returns the output, aborting when ctx is done.
+// Output beyond the output limits is dropped from the middle.
+func (c *Client) ExecCommandContext(ctx context.Context, podName, namespace string, command []string) (string, error) {
+	output, err := c.execCapped(ctx, podName, namespace, command, CurrentOutputLimits().Limit(), nil)
+	return output.Text, err
+}
 
-	err := c.ExecInPod(podName, namespace, ExecOptions{
-		Command: command,
-		Stdout:  &stdout,
-		Stderr:  &stderr,
-		TTY:     true,
-	})
-	if err != nil {
-		return "", fmt.Errorf("exec failed: %v, stderr: %s", err, stderr.String())
+// ExitCode extracts the exit status of a remote command from an exec error.
+// It reports false when err did not come from a command exiting non-zero.
+func ExitCode(err error) (int, bool) {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return exitErr.ExitStatus(), true
 	}
-
-	return stdout.String(), nil
+	return 0, false
 }
 
 // CreateAndRunPod creates a pod, waits for it to be ready, and optionally executes commands
 func (c *Client) CreateAndRunPod(spec PodSpec, commands [][]string, cleanup bool) ([]string, error) {
+	return c.CreateAndRunPodContext(context.Background(), spec, commands, cleanup)
+}
+
+// CreateAndRunPodContext is CreateAndRunPod with cancellation. When ctx is done
+// the readiness wait and any running command are aborted; cleanup still runs.
+func (c *Client) CreateAndRunPodContext(ctx context.Context, spec PodSpec, commands [][]string, cleanup bool) ([]string, error) {
+	return c.CreateAndRunPodWithFiles(ctx, spec, "", nil, commands, cleanup)
+}
+
+// CreateAndRunPodWithFiles is CreateAndRunPodContext that first copies files
+// into dir inside the pod once it is ready
+func (c *Client) CreateAndRunPodWithFiles(ctx context.Context, spec PodSpec, dir string, files []File, commands [][]string, cleanup bool) ([]string, error) {
 	// Create the pod
 	pod, err := c.CreatePod(spec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create pod: %v", err)
+		return nil, fmt.Errorf("failed to create pod: %w", err)
 	}
 
 	// If cleanup is requested, delete the pod when done
@@ -363,20 +625,30 @@ func (c *Client) CreateAndRunPod(spec PodSpec, commands [][]string, cleanup bool
 	}
 
 	// Wait for pod to be ready
-	err = c.WaitForPodReady(pod.Name, pod.Namespace, 5*time.Minute)
+	readyCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	err = c.WaitForPodReadyContext(readyCtx, pod.Name, pod.Namespace)
 	if err != nil {
-		return nil, fmt.Errorf("pod not ready: %v", err)
+		return nil, fmt.Errorf("pod not ready: %w", err)
+	}
+
+	// Deliver files before running anything that needs them
+	if len(files) > 0 {
+		if err := c.CopyFilesToPodContext(ctx, pod.Name, pod.Namespace, dir, files); err != nil {
+			return nil, err
+		}
 	}
 
 	// Execute commands if provided
 	var results []string
 	for _, command := range commands {
-		output, err := c.ExecCommand(pod.Name, pod.Namespace, command)
+		output, err := c.ExecCommandContext(ctx, pod.Name, pod.Namespace, command)
 		if err != nil {
-			return results, fmt.Errorf("command execution failed: %v", err)
+			return append(results, output), fmt.Errorf("command execution failed: %w", err)
 		}
 		results = append(results, output)
 	}
 
 	return results, nil
-}
\ No newline at end of file
+}
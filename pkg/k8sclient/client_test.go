@@ -0,0 +1,191 @@
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// writeKubeconfig writes a kubeconfig with one context per server
+func writeKubeconfig(t testing.TB, servers map[string]string, current string) string {
+	t.Helper()
+
+	config := "apiVersion: v1\nkind: Config\ncurrent-context: " + current + "\nclusters:\n"
+	for name, server := range servers {
+		config += "- name: " + name + "\n  cluster:\n    server: " + server + "\n    insecure-skip-tls-verify: true\n"
+	}
+	config += "contexts:\n"
+	for name := range servers {
+		config += "- name: " + name + "\n  context:\n    cluster: " + name + "\n    user: " + name + "\n"
+	}
+	config += "users:\n"
+	for name := range servers {
+		config += "- name: " + name + "\n  user:\n    token: test\n"
+	}
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestNewClientWithOptionsKubeconfigContext(t *testing.T) {
+	path := writeKubeconfig(t, map[string]string{
+		"staging":    "https://staging.example.com",
+		"production": "https://production.example.com",
+	}, "staging")
+
+	client, err := NewClientWithOptions(ClientOptions{Kubeconfig: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.config.Host != "https://staging.example.com" {
+		t.Errorf("expected the current context, got host %s", client.config.Host)
+	}
+	if client.Namespace() != "default" {
+		t.Errorf("expected the default namespace, got %s", client.Namespace())
+	}
+
+	client, err = NewClientWithOptions(ClientOptions{Kubeconfig: path, Context: "production", Namespace: "sandboxes"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.config.Host != "https://production.example.com" {
+		t.Errorf("expected the selected context, got host %s", client.config.Host)
+	}
+	if client.Namespace() != "sandboxes" {
+		t.Errorf("expected namespace sandboxes, got %s", client.Namespace())
+	}
+
+	if _, err := NewClientWithOptions(ClientOptions{Kubeconfig: path, Context: "missing"}); err == nil {
+		t.Error("expected an unknown context to be rejected")
+	}
+	if _, err := NewClientWithOptions(ClientOptions{Kubeconfig: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("expected a missing kubeconfig to be rejected rather than falling back to in-cluster config")
+	}
+}
+
+func TestClientOptionsValidate(t *testing.T) {
+	for name, opts := range map[string]ClientOptions{
+		"in-cluster with context":    {InCluster: true, Context: "prod"},
+		"in-cluster with kubeconfig": {InCluster: true, Kubeconfig: "/etc/kubeconfig"},
+		"rest config with context":   {Config: &rest.Config{}, Context: "prod"},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := NewClientWithOptions(opts); err == nil {
+			t.Errorf("%s: expected the client to be refused", name)
+		}
+	}
+
+	if err := (ClientOptions{InCluster: true, Namespace: "sandboxes"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewClientFromClientset(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-demo", Namespace: "sandboxes"},
+	})
+
+	client := NewClientFromClientset(clientset, nil, "sandboxes")
+	pod, err := client.GetPod("sandboxed-demo", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Name != "sandboxed-demo" {
+		t.Errorf("unexpected pod %s", pod.Name)
+	}
+}
+
+// BenchmarkClientReuse compares creating a client for every call, as each
+// sandbox operation used to, with sharing one client. Each new client builds
+// its clientset and request machinery again before the call can be made.
+func BenchmarkClientReuse(b *testing.B) {
+	pod, _ := json.Marshal(&corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-demo", Namespace: "default"},
+	})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(pod)
+	}))
+	defer server.Close()
+
+	path := writeKubeconfig(b, map[string]string{"bench": server.URL}, "bench")
+	config, err := loadConfig(path, "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Measure connection reuse, not the client-side rate limiter
+	config.QPS = -1
+
+	b.Run("NewClientPerCall", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			client, err := NewClientWithOptions(ClientOptions{Config: config})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := client.GetPod("sandboxed-demo", ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("SharedClient", func(b *testing.B) {
+		client, err := NewClientWithOptions(ClientOptions{Config: config})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := client.GetPod("sandboxed-demo", ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestStreamPodLogs(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	client := NewClientFromClientset(clientset, nil, "sandboxes")
+
+	tail := int64(20)
+	logs, err := client.StreamPodLogs(context.Background(), "sandbox-1", "", LogOptions{
+		Container:    "main",
+		Follow:       true,
+		TailLines:    &tail,
+		SinceSeconds: 60,
+		Timestamps:   true,
+	})
+	if err != nil {
+		t.Fatalf("failed to stream logs: %v", err)
+	}
+	defer logs.Close()
+
+	if out, _ := io.ReadAll(logs); string(out) != "fake logs" {
+		t.Fatalf("unexpected logs: %q", out)
+	}
+
+	actions := clientset.Actions()
+	if len(actions) != 1 || actions[0].GetSubresource() != "log" || actions[0].GetNamespace() != "sandboxes" {
+		t.Fatalf("unexpected actions: %+v", actions)
+	}
+	opts := actions[0].(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+	if opts.Container != "main" || !opts.Follow || *opts.TailLines != 20 || *opts.SinceSeconds != 60 || !opts.Timestamps {
+		t.Fatalf("options not passed through: %+v", opts)
+	}
+}
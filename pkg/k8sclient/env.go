@@ -0,0 +1,357 @@
+package k8sclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretRef exposes a Kubernetes Secret to a sandbox container. The values
+// are resolved by the kubelet and never pass through this client or its
+// callers. Set Env to expose one key as an environment variable, or
+// MountPath to mount every key of the secret as a read-only file.
+type SecretRef struct {
+	Secret    string `json:"secret"`
+	Key       string `json:"key,omitempty"`
+	Env       string `json:"env,omitempty"`
+	MountPath string `json:"mount_path,omitempty"`
+}
+
+// Redacted replaces secret values in captured output
+const Redacted = "[REDACTED]"
+
+// minRedactLength keeps very short values, which would match all over
+// ordinary output, from being redacted
+const minRedactLength = 4
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnv reports whether every name is a valid environment variable name
+func ValidateEnv(env map[string]string) error {
+	for name := range env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// Validate reports whether the reference can be applied to a pod
+func (r SecretRef) Validate() error {
+	if r.Secret == "" {
+		return fmt.Errorf("secret reference needs a secret name")
+	}
+	if (r.Env == "") == (r.MountPath == "") {
+		return fmt.Errorf("secret %s needs exactly one of env or mount_path", r.Secret)
+	}
+	if r.Env != "" {
+		if r.Key == "" {
+			return fmt.Errorf("secret %s needs a key to expose as %s", r.Secret, r.Env)
+		}
+		if !envNamePattern.MatchString(r.Env) {
+			return fmt.Errorf("invalid environment variable name %q", r.Env)
+		}
+	}
+	if r.MountPath != "" && !strings.HasPrefix(r.MountPath, "/") {
+		return fmt.Errorf("secret mount path %q must be absolute", r.MountPath)
+	}
+	return nil
+}
+
+// WithEnv prefixes command with env(1) so that it runs with the given
+// variables. Values are passed as arguments, never interpolated by a shell.
+func WithEnv(env map[string]string, command []string) []string {
+	if len(env) == 0 {
+		return command
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	argv := []string{"env"}
+	for _, name := range names {
+		argv = append(argv, name+"="+env[name])
+	}
+	return append(argv, command...)
+}
+
+// applyEnv adds the spec's environment and secret references to the pod
+func applyEnv(pod *corev1.Pod, spec PodSpec) error {
+	if err := ValidateEnv(spec.Env); err != nil {
+		return err
+	}
+
+	container := &pod.Spec.Containers[0]
+	names := make([]string, 0, len(spec.Env))
+	for name := range spec.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: spec.Env[name]})
+	}
+
+	for i, ref := range spec.Secrets {
+		if err := ref.Validate(); err != nil {
+			return err
+		}
+
+		if ref.Env != "" {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name: ref.Env,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: ref.Secret},
+						Key:                  ref.Key,
+					},
+				},
+			})
+			continue
+		}
+
+		name := fmt.Sprintf("secret-%d", i)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: ref.Secret}},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: ref.MountPath,
+			ReadOnly:  true,
+		})
+	}
+	return nil
+}
+
+// serviceAccountMountPath is where service account tokens are mounted. Older
+// clusters mount them from secrets, which sandboxes do not reference.
+const serviceAccountMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// PodSecretValues returns the values of the secrets a pod references through
+// environment variables and volumes, for redacting them from output. Service
+// account token volumes are skipped. Pods that reference no secrets cost a
+// single pod read.
+func (c *Client) PodSecretValues(ctx context.Context, podName, namespace string) ([]string, error) {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s: %v", podName, err)
+	}
+
+	keys := podSecretKeys(pod)
+	var values []string
+	for name, used := range keys {
+		secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s for redaction: %v", name, err)
+		}
+		for key, value := range secret.Data {
+			if used == nil || used[key] {
+				values = append(values, string(value))
+			}
+		}
+	}
+	return values, nil
+}
+
+// PodReferencesSecret reports whether a pod references key of the named
+// secret, through an environment variable or a mounted volume
+func (c *Client) PodReferencesSecret(ctx context.Context, podName, namespace, name, key string) (bool, error) {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get pod %s: %v", podName, err)
+	}
+	used, ok := podSecretKeys(pod)[name]
+	return ok && (used == nil || used[key]), nil
+}
+
+// podSecretKeys returns the keys of each secret a pod references. nil keys
+// means every key of the secret is in use. Service account token volumes are
+// skipped.
+func podSecretKeys(pod *corev1.Pod) map[string]map[string]bool {
+	keys := map[string]map[string]bool{}
+	tokenVolumes := map[string]bool{}
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.MountPath == serviceAccountMountPath {
+				tokenVolumes[mount.Name] = true
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+				continue
+			}
+			ref := env.ValueFrom.SecretKeyRef
+			if keys[ref.Name] == nil {
+				keys[ref.Name] = map[string]bool{}
+			}
+			keys[ref.Name][ref.Key] = true
+		}
+	}
+	// Mounted secrets expose every key
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Secret != nil && !tokenVolumes[volume.Name] {
+			keys[volume.Secret.SecretName] = nil
+		}
+	}
+	return keys
+}
+
+// SecretValue reads one key of a secret, for credentials the client itself
+// must pass on, such as to git. Callers redact the value from any output.
+func (c *Client) SecretValue(ctx context.Context, namespace, name, key string) (string, error) {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %v", name, err)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", name, key)
+	}
+	return string(value), nil
+}
+
+// Redact replaces every occurrence of the secret values in output
+func Redact(output string, secrets []string) string {
+	for _, secret := range redactPatterns(secrets) {
+		output = strings.ReplaceAll(output, secret, Redacted)
+	}
+	return output
+}
+
+// redactPatterns returns the strings to replace for secrets, longest first so
+// a secret containing another is replaced whole. A terminal sends each
+// newline as "\r\n", so multi-line secrets are matched in that form too.
+func redactPatterns(secrets []string) []string {
+	var patterns []string
+	for _, secret := range secrets {
+		secret = strings.TrimRight(secret, "\r\n")
+		if len(secret) < minRedactLength {
+			continue
+		}
+		patterns = append(patterns, secret)
+		if crlf := strings.ReplaceAll(strings.ReplaceAll(secret, "\r\n", "\n"), "\n", "\r\n"); crlf != secret {
+			patterns = append(patterns, crlf)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+	return patterns
+}
+
+// Redactor is a writer that replaces secret values in what is written
+// through it, including values split across writes. It holds back the last
+// bytes that could begin a secret until more is written or Flush is called.
+type Redactor struct {
+	w        io.Writer
+	patterns []string
+	hold     int
+	pending  []byte
+}
+
+// NewRedactor returns a writer that redacts secrets before writing to w
+func NewRedactor(w io.Writer, secrets []string) *Redactor {
+	r := &Redactor{w: w, patterns: redactPatterns(secrets)}
+	for _, pattern := range r.patterns {
+		if len(pattern)-1 > r.hold {
+			r.hold = len(pattern) - 1
+		}
+	}
+	return r
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	if len(r.patterns) == 0 {
+		return r.w.Write(p)
+	}
+	r.pending = append(r.pending, p...)
+	for _, pattern := range r.patterns {
+		r.pending = bytes.ReplaceAll(r.pending, []byte(pattern), []byte(Redacted))
+	}
+	// A secret starting before the last hold bytes would have been replaced
+	if n := len(r.pending) - r.hold; n > 0 {
+		if _, err := r.w.Write(r.pending[:n]); err != nil {
+			return 0, err
+		}
+		r.pending = append(r.pending[:0], r.pending[n:]...)
+	}
+	return len(p), nil
+}
+
+// Flush writes the bytes held back, once nothing more will be written
+func (r *Redactor) Flush() error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.pending)
+	r.pending = r.pending[:0]
+	return err
+}
+
+// ExecCommandRedacted runs ExecCommand and redacts the values of the secrets
+// the pod references from the output and error. Output is withheld when the
+// secrets cannot be read, rather than risk leaking them.
+func (c *Client) ExecCommandRedacted(podName, namespace string, command []string) (string, error) {
+	return c.ExecCommandRedactedContext(context.Background(), podName, namespace, command)
+}
+
+// ExecCommandRedactedContext is ExecCommandRedacted with cancellation
+func (c *Client) ExecCommandRedactedContext(ctx context.Context, podName, namespace string, command []string) (string, error) {
+	secrets, err := c.PodSecretValues(ctx, podName, namespace)
+	if err != nil {
+		return "", err
+	}
+	output, execErr := c.execCapped(ctx, podName, namespace, command, CurrentOutputLimits().Limit(), secrets)
+	return output.Text, RedactError(execErr, secrets)
+}
+
+// ExecCommandOutputRedactedContext is ExecCommandOutputContext with the
+// values of the pod's secrets redacted from the output and error. A spilled
+// file holds the output as the command printed it.
+func (c *Client) ExecCommandOutputRedactedContext(ctx context.Context, podName, namespace string, command []string) (*Output, error) {
+	secrets, err := c.PodSecretValues(ctx, podName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExecCommandOutputSecretsContext(ctx, podName, namespace, command, secrets)
+}
+
+// RedactError replaces the secret values in an error's message, keeping the
+// error itself reachable through errors.As
+func RedactError(err error, secrets []string) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{msg: Redact(err.Error(), secrets), err: err}
+}
+
+// redactedError hides secret values in an error message while keeping the
+// original error, and its exit code, reachable through errors.As
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
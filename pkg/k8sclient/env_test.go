@@ -0,0 +1,197 @@
+package k8sclient
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWithEnv(t *testing.T) {
+	env := map[string]string{
+		"GREETING": "it's $(not) `expanded`",
+		"EMPTY":    "",
+	}
+
+	argv := WithEnv(env, []string{"sh", "-c", `printf '%s|%s' "$GREETING" "$EMPTY"`})
+	out, err := exec.Command(argv[0], argv[1:]...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v: %s", err, out)
+	}
+	if string(out) != "it's $(not) `expanded`|" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	if got := WithEnv(nil, []string{"true"}); len(got) != 1 {
+		t.Fatalf("expected the command unchanged without env, got %q", got)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	spec := PodSpec{
+		Env: map[string]string{"MODE": "test"},
+		Secrets: []SecretRef{
+			{Secret: "api", Key: "token", Env: "API_TOKEN"},
+			{Secret: "certs", MountPath: "/etc/certs"},
+		},
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "sandbox"}}}}
+
+	if err := applyEnv(pod, spec); err != nil {
+		t.Fatalf("failed to apply env: %v", err)
+	}
+
+	env := pod.Spec.Containers[0].Env
+	if len(env) != 2 || env[0].Value != "test" || env[1].ValueFrom.SecretKeyRef.Name != "api" || env[1].Value != "" {
+		t.Fatalf("unexpected env: %+v", env)
+	}
+	if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].Secret.SecretName != "certs" || !pod.Spec.Containers[0].VolumeMounts[0].ReadOnly {
+		t.Fatalf("expected a read-only secret mount, got %+v", pod.Spec.Volumes)
+	}
+
+	for _, bad := range []PodSpec{
+		{Env: map[string]string{"1BAD": "x"}},
+		{Env: map[string]string{"A=B": "x"}},
+		{Secrets: []SecretRef{{Secret: "api", Env: "TOKEN"}}},
+		{Secrets: []SecretRef{{Secret: "api", Key: "k", Env: "TOKEN", MountPath: "/etc/api"}}},
+		{Secrets: []SecretRef{{Secret: "api", MountPath: "etc/api"}}},
+	} {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{}}}}
+		if err := applyEnv(pod, bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	secrets := []string{"s3cr3t-token", "s3cr3t", "abc", "multi\nline-key\n"}
+	output := "token=s3cr3t-token short=s3cr3t tiny=abc key=multi\nline-key"
+
+	got := Redact(output, secrets)
+	want := "token=[REDACTED] short=[REDACTED] tiny=abc key=[REDACTED]"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactTerminalOutput(t *testing.T) {
+	key := "-----BEGIN KEY-----\nMIIEvQIBADANBgkq\n-----END KEY-----\n"
+	output := "cat key.pem\r\n-----BEGIN KEY-----\r\nMIIEvQIBADANBgkq\r\n-----END KEY-----\r\ndone\r\n"
+
+	want := "cat key.pem\r\n[REDACTED]\r\ndone\r\n"
+	if got := Redact(output, []string{key}); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Written a byte at a time into a buffer too small to keep the key, the
+	// secret is redacted before the middle is dropped
+	buf := NewCappedBuffer(24)
+	r := NewRedactor(buf, []string{key})
+	for i := 0; i < len(output); i++ {
+		if _, err := r.Write([]byte{output[i]}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if !buf.Truncated() {
+		t.Fatal("expected the output to be truncated")
+	}
+	for _, part := range []string{"BEGIN", "MIIE", "Bgkq", "END KEY"} {
+		if strings.Contains(buf.String(), part) {
+			t.Fatalf("secret leaked in %q", buf.String())
+		}
+	}
+	if buf.Size() != int64(len(want)) {
+		t.Fatalf("expected %d bytes after redaction, got %d", len(want), buf.Size())
+	}
+}
+
+func TestRedactedErrorKeepsCause(t *testing.T) {
+	cause := errors.New("exec failed: token s3cr3t-token rejected")
+	err := &redactedError{msg: Redact(cause.Error(), []string{"s3cr3t-token"}), err: cause}
+
+	if strings.Contains(err.Error(), "s3cr3t-token") {
+		t.Fatalf("secret leaked in %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Fatal("expected the original error to stay reachable")
+	}
+}
+
+func TestSecretValue(t *testing.T) {
+	client := NewClientFromClientset(fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "sandboxes"},
+		Data:       map[string][]byte{"token": []byte("ghp_example")},
+	}), nil, "sandboxes")
+
+	value, err := client.SecretValue(context.Background(), "", "git", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "ghp_example" {
+		t.Fatalf("unexpected value %q", value)
+	}
+
+	if _, err := client.SecretValue(context.Background(), "", "git", "password"); err == nil {
+		t.Fatal("expected a missing key to be an error")
+	}
+	if _, err := client.SecretValue(context.Background(), "", "missing", "token"); err == nil {
+		t.Fatal("expected a missing secret to be an error")
+	}
+}
+
+func TestPodSecretValues(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-app", Namespace: "sandboxes"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "sandbox",
+				Env: []corev1.EnvVar{{Name: "API_KEY", ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "api"}, Key: "key"},
+				}}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "token", MountPath: serviceAccountMountPath}},
+			}},
+			// The legacy token secret is not readable, and must not be read
+			Volumes: []corev1.Volume{{Name: "token", VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "default-token-abcde"},
+			}}},
+		},
+	}
+	client := NewClientFromClientset(fake.NewSimpleClientset(pod, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "sandboxes"},
+		Data:       map[string][]byte{"key": []byte("sk-example"), "unused": []byte("other-value")},
+	}), nil, "sandboxes")
+
+	values, err := client.PodSecretValues(context.Background(), "sandboxed-app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0] != "sk-example" {
+		t.Fatalf("expected only the referenced key, got %q", values)
+	}
+
+	for _, ref := range []struct {
+		secret, key string
+		want        bool
+	}{
+		{"api", "key", true},
+		{"api", "unused", false},
+		{"default-token-abcde", "token", false},
+		{"other", "key", false},
+	} {
+		got, err := client.PodReferencesSecret(context.Background(), "sandboxed-app", "", ref.secret, ref.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != ref.want {
+			t.Errorf("expected %s/%s referenced to be %v", ref.secret, ref.key, ref.want)
+		}
+	}
+}
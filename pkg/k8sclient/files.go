@@ -0,0 +1,198 @@
+package k8sclient
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// File is a file to be delivered into a pod
+type File struct {
+	// Path is relative to the destination directory and uses forward slashes
+	Path    string
+	Content []byte
+	// Mode is the file permission bits; 0644 is used when zero
+	Mode int64
+}
+
+// BuildTar packs files into an uncompressed tar archive. Paths are validated
+// so that an archive can never write outside its destination directory.
+func BuildTar(files []File) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+
+	for _, f := range files {
+		name, err := cleanArchivePath(f.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := f.Mode
+		if mode == 0 {
+			mode = 0o644
+		}
+
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     mode,
+			Size:     int64(len(f.Content)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %v", f.Path, err)
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %v", f.Path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// cleanArchivePath normalises a relative path and rejects anything that
+// would escape the destination directory
+func cleanArchivePath(p string) (string, error) {
+	if p == "" || strings.ContainsRune(p, 0) {
+		return "", fmt.Errorf("invalid file path %q", p)
+	}
+	if strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("file path %q must be relative", p)
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("file path %q escapes the destination directory", p)
+	}
+	return cleaned, nil
+}
+
+// extractCommand is run in the pod to unpack an archive streamed on stdin.
+// The destination is passed as a positional argument, never interpolated.
+func extractCommand(dir string) []string {
+	return []string{"sh", "-c", `mkdir -p "$1" && tar -xf - -C "$1"`, "sh", dir}
+}
+
+// archiveCommand is run in the pod to write dir as a gzipped tar archive to
+// stdout; a missing dir yields an empty archive
+func archiveCommand(dir string) []string {
+	return []string{"sh", "-c", `mkdir -p "$1" && tar -czf - -C "$1" .`, "sh", dir}
+}
+
+// extractGzipCommand unpacks a gzipped tar archive streamed on stdin into dir
+func extractGzipCommand(dir string) []string {
+	return []string{"sh", "-c", `mkdir -p "$1" && tar -xzf - -C "$1"`, "sh", dir}
+}
+
+// CopyFilesToPod writes files into dir inside a pod by streaming a tar archive
+// over the exec stdin
+func (c *Client) CopyFilesToPod(podName, namespace, dir string, files []File) error {
+	return c.CopyFilesToPodContext(context.Background(), podName, namespace, dir, files)
+}
+
+// CopyFilesToPodContext is CopyFilesToPod with cancellation
+func (c *Client) CopyFilesToPodContext(ctx context.Context, podName, namespace, dir string, files []File) error {
+	if !strings.HasPrefix(dir, "/") {
+		return fmt.Errorf("destination directory %q must be absolute", dir)
+	}
+
+	archive, err := BuildTar(files)
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = c.ExecInPodContext(ctx, podName, namespace, ExecOptions{
+		Command: extractCommand(dir),
+		Stdin:   bytes.NewReader(archive),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy files to pod %s: %w, stderr: %s", podName, err, stderr.String())
+	}
+	return nil
+}
+
+// WriteFile writes content to an absolute path inside a pod
+func (c *Client) WriteFile(podName, namespace, filePath string, content []byte, mode int64) error {
+	return c.WriteFileContext(context.Background(), podName, namespace, filePath, content, mode)
+}
+
+// WriteFileContext is WriteFile with cancellation
+func (c *Client) WriteFileContext(ctx context.Context, podName, namespace, filePath string, content []byte, mode int64) error {
+	if !strings.HasPrefix(filePath, "/") {
+		return errors.New("file path must be absolute")
+	}
+
+	dir, name := path.Split(path.Clean(filePath))
+	return c.CopyFilesToPodContext(ctx, podName, namespace, dir, []File{{Path: name, Content: content, Mode: mode}})
+}
+
+// RemoveFromPod deletes an absolute path, and everything under it, inside a pod
+func (c *Client) RemoveFromPod(ctx context.Context, podName, namespace, target string) error {
+	if !strings.HasPrefix(target, "/") || path.Clean(target) == "/" {
+		return fmt.Errorf("path %q must be absolute and not the root", target)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := c.ExecInPodContext(ctx, podName, namespace, ExecOptions{
+		Command: []string{"rm", "-rf", "--", target},
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove %s in pod %s: %w, stderr: %s", target, podName, err, stderr.String())
+	}
+	return nil
+}
+
+// ArchiveDirFromPod writes the contents of dir inside a pod to w as a gzipped
+// tar archive
+func (c *Client) ArchiveDirFromPod(ctx context.Context, podName, namespace, dir string, w io.Writer) error {
+	if !strings.HasPrefix(dir, "/") {
+		return fmt.Errorf("directory %q must be absolute", dir)
+	}
+
+	var stderr bytes.Buffer
+	err := c.ExecInPodContext(ctx, podName, namespace, ExecOptions{
+		Command: archiveCommand(dir),
+		Stdout:  w,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive %s in pod %s: %w, stderr: %s", dir, podName, err, stderr.String())
+	}
+	return nil
+}
+
+// ExtractArchiveToPod unpacks a gzipped tar archive read from r into dir
+// inside a pod, as written by ArchiveDirFromPod
+func (c *Client) ExtractArchiveToPod(ctx context.Context, podName, namespace, dir string, r io.Reader) error {
+	if !strings.HasPrefix(dir, "/") {
+		return fmt.Errorf("destination directory %q must be absolute", dir)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := c.ExecInPodContext(ctx, podName, namespace, ExecOptions{
+		Command: extractGzipCommand(dir),
+		Stdin:   r,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extract archive in pod %s: %w, stderr: %s", podName, err, stderr.String())
+	}
+	return nil
+}
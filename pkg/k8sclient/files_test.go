@@ -0,0 +1,150 @@
+package k8sclient
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var deliverySeeds = []string{
+	"print('hello')",
+	`package main; import "fmt"; func main() { fmt.Println("it's") }`,
+	"'; rm -rf / #",
+	"EOF\n$(touch /tmp/pwned)\n`id`\nEOF",
+	"\x00\x01\xff\xfe binary",
+	"",
+}
+
+func FuzzBuildTarRoundTrip(f *testing.F) {
+	for _, seed := range deliverySeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		archive, err := BuildTar([]File{{Path: "main.go", Content: content}})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+
+		tr := tar.NewReader(bytes.NewReader(archive))
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		if hdr.Name != "main.go" {
+			t.Fatalf("unexpected entry name %q", hdr.Name)
+		}
+
+		got, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read entry: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("content changed in transit: got %q, want %q", got, content)
+		}
+	})
+}
+
+// FuzzExtractRoundTrip runs the exact command used inside pods against a
+// local shell, proving arbitrary bytes land on disk unchanged and are never
+// interpreted by the shell.
+func FuzzExtractRoundTrip(f *testing.F) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		f.Skip("tar not available")
+	}
+
+	for _, seed := range deliverySeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		dir := filepath.Join(t.TempDir(), "it's a \"dir\" $(x)")
+
+		archive, err := BuildTar([]File{{Path: "src/main.go", Content: content, Mode: 0o755}})
+		if err != nil {
+			t.Fatalf("failed to build archive: %v", err)
+		}
+
+		argv := extractCommand(dir)
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Stdin = bytes.NewReader(archive)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("extract failed: %v: %s", err, out)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dir, "src", "main.go"))
+		if err != nil {
+			t.Fatalf("failed to read extracted file: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("content changed in transit: got %q, want %q", got, content)
+		}
+	})
+}
+
+func TestBuildTarRejectsEscapingPaths(t *testing.T) {
+	for _, p := range []string{"", "/etc/passwd", "../outside", "a/../../outside", ".", "nul\x00byte"} {
+		if _, err := BuildTar([]File{{Path: p}}); err == nil {
+			t.Errorf("expected path %q to be rejected", p)
+		}
+	}
+
+	if _, err := BuildTar([]File{{Path: "pkg/./util/../main.py"}}); err != nil {
+		t.Errorf("expected a path that stays inside the directory to be accepted: %v", err)
+	}
+}
+
+func TestRemoveFromPodRejectsUnsafePaths(t *testing.T) {
+	c := &Client{}
+	for _, p := range []string{"", "tmp/exec", "/", "/tmp/.."} {
+		if err := c.RemoveFromPod(context.Background(), "pod", "default", p); err == nil {
+			t.Errorf("expected path %q to be rejected", p)
+		}
+	}
+}
+
+// TestArchiveRoundTrip runs the archive and extract commands used inside pods
+// against a local shell
+func TestArchiveRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not available")
+	}
+
+	src := filepath.Join(t.TempDir(), "it's a \"workspace\"")
+	if err := os.MkdirAll(filepath.Join(src, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "pkg", "main.py"), []byte("print('hi')"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	argv := archiveCommand(src)
+	archive, err := exec.Command(argv[0], argv[1:]...).Output()
+	if err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "$(restored)")
+	argv = extractGzipCommand(dst)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = bytes.NewReader(archive)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("extract failed: %v: %s", err, out)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dst, "pkg", "main.py"))
+	if err != nil || string(got) != "print('hi')" {
+		t.Fatalf("workspace not restored: %q, %v", got, err)
+	}
+
+	// A missing directory is archived as empty rather than failing
+	argv = archiveCommand(filepath.Join(t.TempDir(), "missing"))
+	if _, err := exec.Command(argv[0], argv[1:]...).Output(); err != nil {
+		t.Fatalf("archiving a missing directory failed: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package k8sclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// Limits applied to one-shot jobs unless the JobSpec sets its own
+const (
+	DefaultJobDeadline = 5 * time.Minute
+	DefaultJobTTL      = 10 * time.Minute
+)
+
+// ErrJobDeadline is returned when a job is killed for running past its deadline
+var ErrJobDeadline = errors.New("job exceeded its deadline")
+
+// jobNameLabel is set by the Job controller on the pods it creates
+const jobNameLabel = "job-name"
+
+// JobSpec describes a program run to completion as a batch/v1 Job. The
+// embedded PodSpec's Command is the program itself.
+type JobSpec struct {
+	PodSpec
+	// Files are mounted read-only under Dir from a ConfigMap owned by the Job
+	Dir   string
+	Files []File
+	// Deadline bounds the job's run time, image pull included;
+	// DefaultJobDeadline when zero
+	Deadline time.Duration
+	// TTLAfterFinished is how long a finished job and its pod are kept;
+	// DefaultJobTTL when zero
+	TTLAfterFinished time.Duration
+}
+
+// JobResult is the outcome of a finished job
+type JobResult struct {
+	PodName  string
+	Output   string
+	ExitCode int
+	// Truncated is set when the output was over the output limits
+	Truncated bool
+}
+
+// BuildJob turns a JobSpec into the Job RunJob would create. The job is
+// never retried, and the Job controller removes it once its TTL expires.
+func BuildJob(spec JobSpec) (*batchv1.Job, error) {
+	pod, err := BuildPod(spec.PodSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(spec.Files) > 0 {
+		items := make([]corev1.KeyToPath, len(spec.Files))
+		for i, f := range spec.Files {
+			p, err := cleanArchivePath(f.Path)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = corev1.KeyToPath{Key: fileKey(i), Path: p}
+		}
+
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "program",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: spec.Name},
+					Items:                items,
+				},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "program",
+			MountPath: spec.Dir,
+			ReadOnly:  true,
+		})
+	}
+
+	deadline := spec.Deadline
+	if deadline <= 0 {
+		deadline = DefaultJobDeadline
+	}
+	ttl := spec.TTLAfterFinished
+	if ttl <= 0 {
+		ttl = DefaultJobTTL
+	}
+
+	activeDeadline := int64(deadline.Seconds())
+	backoffLimit := int32(0)
+	ttlSeconds := int32(ttl.Seconds())
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        spec.Name,
+			Namespace:   spec.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: batchv1.JobSpec{
+			ActiveDeadlineSeconds:   &activeDeadline,
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttlSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+				},
+				Spec: pod.Spec,
+			},
+		},
+	}, nil
+}
+
+// fileKey is the ConfigMap key holding the i-th file; paths with slashes
+// are not valid keys
+func fileKey(i int) string {
+	return fmt.Sprintf("file-%d", i)
+}
+
+// RunJob runs a program as a Job and waits for it to finish. The output is
+// read from the pod's logs and the exit code from its container's terminated
+// state; a non-zero exit is returned as an error ExitCode understands. When
+// ctx is done before the job finishes, the job is deleted.
+func (c *Client) RunJob(ctx context.Context, spec JobSpec) (*JobResult, error) {
+	if spec.Namespace == "" {
+		spec.Namespace = c.namespace
+	}
+
+	job, err := BuildJob(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := c.clientset.BatchV1().Jobs(spec.Namespace)
+	job, err = jobs.Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	finished := false
+	defer func() {
+		if !finished {
+			c.deleteJob(job)
+		}
+	}()
+
+	// The ConfigMap is owned by the job so both are removed together; the
+	// pod waits for it before starting
+	if len(spec.Files) > 0 {
+		if err := c.createJobFiles(ctx, job, spec.Files); err != nil {
+			return nil, err
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(*job.Spec.ActiveDeadlineSeconds)*time.Second+time.Minute)
+	defer cancel()
+
+	var pod *corev1.Pod
+	pulling := make(map[string]time.Time)
+	err = wait.PollUntilContextCancel(waitCtx, time.Second, true, func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range current.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue && cond.Reason == batchv1.JobReasonDeadlineExceeded {
+				return false, ErrJobDeadline
+			}
+		}
+
+		pods, err := c.clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: jobNameLabel + "=" + job.Name,
+		})
+		if err != nil {
+			return false, err
+		}
+		for i := range pods.Items {
+			p := &pods.Items[i]
+			if reason := startFailure(p, pulling, time.Now()); reason != "" {
+				return false, fmt.Errorf("job %s cannot start: %s", job.Name, reason)
+			}
+			if terminated(p) != nil {
+				pod = p
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrJobDeadline) {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("job %s: %w", job.Name, ErrJobDeadline)
+		}
+		return nil, fmt.Errorf("failed waiting for job %s: %w", job.Name, err)
+	}
+	finished = true
+
+	result := &JobResult{
+		PodName:  pod.Name,
+		ExitCode: int(terminated(pod).ExitCode),
+	}
+	logs, err := c.GetPodLogsOutputContext(ctx, pod.Name, pod.Namespace)
+	if logs != nil {
+		result.Output, result.Truncated = logs.Text, logs.Truncated
+	}
+	if err != nil {
+		return result, err
+	}
+	if result.ExitCode != 0 {
+		return result, utilexec.CodeExitError{
+			Err:  fmt.Errorf("job %s exited with code %d", job.Name, result.ExitCode),
+			Code: result.ExitCode,
+		}
+	}
+	return result, nil
+}
+
+// createJobFiles stores files in a ConfigMap owned by job
+func (c *Client) createJobFiles(ctx context.Context, job *batchv1.Job, files []File) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+			Labels:    job.Labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		BinaryData: make(map[string][]byte, len(files)),
+	}
+	for i, f := range files {
+		cm.BinaryData[fileKey(i)] = f.Content
+	}
+
+	if _, err := c.clientset.CoreV1().ConfigMaps(job.Namespace).Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to deliver files: %w", err)
+	}
+	return nil
+}
+
+// deleteJob removes an unfinished job and its pod. It runs after the
+// caller's context may be done, so it uses its own.
+func (c *Client) deleteJob(job *batchv1.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	propagation := metav1.DeletePropagationBackground
+	_ = c.clientset.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+}
+
+// terminated returns the program container's terminated state, or nil while
+// it has not finished
+func terminated(pod *corev1.Pod) *corev1.ContainerStateTerminated {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil {
+			return status.State.Terminated
+		}
+	}
+	return nil
+}
+
+// imagePullGrace is how long a job's pod may fail to pull its image before
+// the job fails; pulls often recover from registry hiccups
+const imagePullGrace = 2 * time.Minute
+
+// startFailure reports why a pod's container can never start, such as an
+// invalid image name. Image pull failures only count once the pod has kept
+// failing to pull for imagePullGrace; pulling records when each pod started
+// failing.
+func startFailure(pod *corev1.Pod, pulling map[string]time.Time, now time.Time) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		w := status.State.Waiting
+		if w == nil {
+			continue
+		}
+		switch w.Reason {
+		case "InvalidImageName", "CreateContainerConfigError":
+			return fmt.Sprintf("%s: %s", w.Reason, w.Message)
+		case "ErrImagePull", "ImagePullBackOff":
+			since, ok := pulling[pod.Name]
+			if !ok {
+				pulling[pod.Name] = now
+				return ""
+			}
+			if w.Reason == "ImagePullBackOff" && now.Sub(since) >= imagePullGrace {
+				return fmt.Sprintf("%s: %s", w.Reason, w.Message)
+			}
+			return ""
+		}
+	}
+	delete(pulling, pod.Name)
+	return ""
+}
@@ -0,0 +1,165 @@
+package k8sclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestBuildJob(t *testing.T) {
+	job, err := BuildJob(JobSpec{
+		PodSpec: PodSpec{
+			Name:    "run-1",
+			Image:   "python:3.9-slim",
+			Command: []string{"python", "/tmp/program/main.py"},
+		},
+		Dir:   "/tmp/program",
+		Files: []File{{Path: "main.py", Content: []byte("print(1)")}, {Path: "lib/util.py"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to build job: %v", err)
+	}
+
+	if *job.Spec.BackoffLimit != 0 || *job.Spec.ActiveDeadlineSeconds != 300 || *job.Spec.TTLSecondsAfterFinished != 600 {
+		t.Fatalf("unexpected job limits: %+v", job.Spec)
+	}
+
+	pod := job.Spec.Template.Spec
+	if pod.RestartPolicy != corev1.RestartPolicyNever {
+		t.Fatalf("expected restart policy Never, got %s", pod.RestartPolicy)
+	}
+	if got := pod.Containers[0].Command; len(got) != 2 || got[1] != "/tmp/program/main.py" {
+		t.Fatalf("expected the program as the command, got %v", got)
+	}
+
+	cm := pod.Volumes[len(pod.Volumes)-1].ConfigMap
+	if cm == nil || cm.Name != "run-1" || len(cm.Items) != 2 || cm.Items[1].Key != "file-1" || cm.Items[1].Path != "lib/util.py" {
+		t.Fatalf("expected files mounted from the job's ConfigMap, got %+v", pod.Volumes)
+	}
+	if m := pod.Containers[0].VolumeMounts; len(m) != 1 || m[0].MountPath != "/tmp/program" || !m[0].ReadOnly {
+		t.Fatalf("unexpected mounts: %+v", m)
+	}
+
+	if _, err := BuildJob(JobSpec{PodSpec: PodSpec{Name: "run-2"}, Dir: "/tmp", Files: []File{{Path: "../escape"}}}); err == nil {
+		t.Fatal("expected escaping file path to be rejected")
+	}
+}
+
+// finishedPod is a job pod whose container exited with code
+func finishedPod(job string, code int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job + "-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{jobNameLabel: job},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code}},
+			}},
+		},
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	clientset := fake.NewSimpleClientset(finishedPod("run-1", 0), finishedPod("run-2", 3))
+	client := NewClientFromClientset(clientset, nil, "default")
+
+	result, err := client.RunJob(context.Background(), JobSpec{
+		PodSpec: PodSpec{Name: "run-1", Image: "python:3.9-slim", Command: []string{"python", "/tmp/program/main.py"}},
+		Dir:     "/tmp/program",
+		Files:   []File{{Path: "main.py", Content: []byte("print(1)")}},
+	})
+	if err != nil {
+		t.Fatalf("failed to run job: %v", err)
+	}
+	if result.PodName != "run-1-abcde" || result.ExitCode != 0 || result.Output != "fake logs" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("default").Get(context.Background(), "run-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the program in a ConfigMap: %v", err)
+	}
+	if string(cm.BinaryData["file-0"]) != "print(1)" || len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].Kind != "Job" {
+		t.Fatalf("unexpected ConfigMap: %+v", cm)
+	}
+
+	// A finished job is left for its TTL to remove
+	if _, err := clientset.BatchV1().Jobs("default").Get(context.Background(), "run-1", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected finished job to be kept: %v", err)
+	}
+
+	result, err = client.RunJob(context.Background(), JobSpec{PodSpec: PodSpec{Name: "run-2", Image: "alpine"}})
+	if code, ok := ExitCode(err); !ok || code != 3 || result.ExitCode != 3 {
+		t.Fatalf("expected exit code 3, got %d (%v)", code, err)
+	}
+}
+
+func TestRunJobDeadline(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	// Stand in for the Job controller killing the job
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:   batchv1.JobFailed,
+			Status: corev1.ConditionTrue,
+			Reason: batchv1.JobReasonDeadlineExceeded,
+		}}
+		return false, nil, nil
+	})
+	client := NewClientFromClientset(clientset, nil, "default")
+
+	_, err := client.RunJob(context.Background(), JobSpec{PodSpec: PodSpec{Name: "run-1", Image: "alpine"}})
+	if !errors.Is(err, ErrJobDeadline) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	// An unfinished job is deleted
+	if _, err := clientset.BatchV1().Jobs("default").Get(context.Background(), "run-1", metav1.GetOptions{}); err == nil {
+		t.Fatal("expected the job to be deleted")
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	waiting := func(reason string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "run-1"}}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "failed"}},
+		}}
+		return pod
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if reason := startFailure(waiting("InvalidImageName"), map[string]time.Time{}, start); reason == "" {
+		t.Error("expected an invalid image name to fail at once")
+	}
+
+	// Pull failures are retried until the pod has backed off for the grace period
+	pulling := map[string]time.Time{}
+	if reason := startFailure(waiting("ErrImagePull"), pulling, start); reason != "" {
+		t.Errorf("expected a single pull error to be retried, got %q", reason)
+	}
+	if reason := startFailure(waiting("ImagePullBackOff"), pulling, start.Add(time.Minute)); reason != "" {
+		t.Errorf("expected a short back-off to be retried, got %q", reason)
+	}
+	if reason := startFailure(waiting("ErrImagePull"), pulling, start.Add(imagePullGrace)); reason != "" {
+		t.Errorf("expected a pull error to be retried, got %q", reason)
+	}
+	if reason := startFailure(waiting("ImagePullBackOff"), pulling, start.Add(imagePullGrace)); reason == "" {
+		t.Error("expected a sustained back-off to fail")
+	}
+
+	// A pod that pulls its image starts the grace period over
+	if reason := startFailure(waiting("ContainerCreating"), pulling, start.Add(imagePullGrace)); reason != "" || len(pulling) != 0 {
+		t.Errorf("expected the back-off to be forgotten, got %q %v", reason, pulling)
+	}
+}
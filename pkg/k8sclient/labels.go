@@ -0,0 +1,26 @@
+package k8sclient
+
+// Labels and annotations identifying sandboxes, so that any process can
+// discover and reattach to a sandbox created by another one.
+const (
+	// LabelManaged marks pods created as sandboxes
+	LabelManaged = "sandboxed.io/managed"
+	// LabelName holds the user-facing sandbox name
+	LabelName = "sandboxed.io/name"
+	// LabelLanguage holds the sandbox language key
+	LabelLanguage = "sandboxed.io/language"
+	// LabelTemplate holds the environment template the sandbox was created from
+	LabelTemplate = "sandboxed.io/template"
+	// LabelCluster holds the name of the cluster a multi-cluster server placed
+	// the sandbox on
+	LabelCluster = "sandboxed.io/cluster"
+
+	// AnnotationOwner records who created the sandbox
+	AnnotationOwner = "sandboxed.io/owner"
+	// AnnotationCreatedAt records when the sandbox was registered (RFC 3339)
+	AnnotationCreatedAt = "sandboxed.io/created-at"
+	// AnnotationUpdatedAt records when the sandbox record last changed (RFC 3339)
+	AnnotationUpdatedAt = "sandboxed.io/updated-at"
+	// AnnotationPackages records the packages installed into a sandbox as a JSON list
+	AnnotationPackages = "sandboxed.io/packages"
+)
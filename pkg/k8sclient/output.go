@@ -0,0 +1,273 @@
+package k8sclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxOutput is how much of an execution's output or a pod's logs is
+// kept when OutputLimits sets no limit
+const DefaultMaxOutput = 1 << 20
+
+// OutputLimits bounds the output kept in memory for each execution and pod
+// log read, so that a command printing without end cannot exhaust the
+// server's memory
+type OutputLimits struct {
+	// MaxBytes is how much output is kept; DefaultMaxOutput when zero. The
+	// head and tail are kept and the middle is replaced by a marker.
+	MaxBytes int
+	// SpillDir is a directory in the sandbox where the full output of a
+	// truncated command is saved, so it can be downloaded; nothing is saved
+	// when empty
+	SpillDir string
+}
+
+// Validate rejects a negative limit and a relative spill directory
+func (l OutputLimits) Validate() error {
+	if l.MaxBytes < 0 {
+		return fmt.Errorf("output limit must not be negative, got %d", l.MaxBytes)
+	}
+	if l.SpillDir != "" && !path.IsAbs(l.SpillDir) {
+		return fmt.Errorf("output spill directory must be absolute, got %q", l.SpillDir)
+	}
+	return nil
+}
+
+// Limit is the number of bytes of output kept
+func (l OutputLimits) Limit() int {
+	if l.MaxBytes <= 0 {
+		return DefaultMaxOutput
+	}
+	return l.MaxBytes
+}
+
+var (
+	outputLimitsMu sync.RWMutex
+	outputLimits   OutputLimits
+)
+
+// SetOutputLimits replaces the limits applied by every client
+func SetOutputLimits(limits OutputLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	outputLimitsMu.Lock()
+	defer outputLimitsMu.Unlock()
+	outputLimits = limits
+	return nil
+}
+
+// CurrentOutputLimits returns the limits set by SetOutputLimits
+func CurrentOutputLimits() OutputLimits {
+	outputLimitsMu.RLock()
+	defer outputLimitsMu.RUnlock()
+	return outputLimits
+}
+
+// Output is the output of a command or a pod, within the output limits
+type Output struct {
+	Text string
+	// Truncated is set when the middle of the output was dropped
+	Truncated bool
+	// Size is the length of the full output in bytes
+	Size int64
+	// SpillFile is the file in the pod holding the full output, when it was
+	// truncated and the limits set a SpillDir
+	SpillFile string
+}
+
+// CappedBuffer keeps the first and last bytes written to it, up to a limit,
+// and counts the rest. Writes never fail, so streams are drained in full.
+type CappedBuffer struct {
+	limit int
+	head  []byte
+	// tail is a ring buffer of the last bytes written once head is full
+	tail    []byte
+	tailPos int
+	size    int64
+}
+
+// NewCappedBuffer returns a buffer that keeps at most limit bytes
+func NewCappedBuffer(limit int) *CappedBuffer {
+	if limit < 2 {
+		limit = 2
+	}
+	return &CappedBuffer{limit: limit}
+}
+
+func (b *CappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.size += int64(n)
+
+	headCap := b.limit / 2
+	if room := headCap - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+
+	tailCap := b.limit - headCap
+	if len(p) >= tailCap {
+		b.tail = append(b.tail[:0], p[len(p)-tailCap:]...)
+		b.tailPos = 0
+		return n, nil
+	}
+	for len(p) > 0 {
+		if len(b.tail) < tailCap {
+			room := tailCap - len(b.tail)
+			if room > len(p) {
+				room = len(p)
+			}
+			b.tail = append(b.tail, p[:room]...)
+			p = p[room:]
+			continue
+		}
+		copied := copy(b.tail[b.tailPos:], p)
+		b.tailPos = (b.tailPos + copied) % tailCap
+		p = p[copied:]
+	}
+	return n, nil
+}
+
+// Truncated reports whether more was written than the buffer keeps
+func (b *CappedBuffer) Truncated() bool {
+	return b.size > int64(b.limit)
+}
+
+// Size is the number of bytes written
+func (b *CappedBuffer) Size() int64 {
+	return b.size
+}
+
+// String returns what was written, with the middle replaced by a marker
+// when it did not fit. Characters cut in two at the edges are dropped.
+func (b *CappedBuffer) String() string {
+	tail := append(append([]byte(nil), b.tail[b.tailPos:]...), b.tail[:b.tailPos]...)
+	if !b.Truncated() {
+		return string(b.head) + string(tail)
+	}
+
+	head := b.head
+	for cut := 0; cut < utf8.UTFMax && len(head) > 0; cut++ {
+		if r, size := utf8.DecodeLastRune(head); r != utf8.RuneError || size != 1 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+	for cut := 0; cut < utf8.UTFMax && len(tail) > 0 && !utf8.RuneStart(tail[0]); cut++ {
+		tail = tail[1:]
+	}
+	dropped := b.size - int64(len(head)) - int64(len(tail))
+	return string(head) + fmt.Sprintf("\n[... %d bytes truncated ...]\n", dropped) + string(tail)
+}
+
+// output returns the buffer's content as an Output
+func (b *CappedBuffer) output() *Output {
+	return &Output{Text: b.String(), Truncated: b.Truncated(), Size: b.size}
+}
+
+// spillScript runs "$@" with its output copied to file $1, which is kept
+// only when the output is over $2 bytes as the client receives it: a
+// terminal sends each newline as two bytes. The command runs as is when the
+// file's directory cannot be created.
+const spillScript = `f=$1 max=$2; shift 2
+mkdir -p "${f%/*}" 2>/dev/null || exec "$@"
+{ "$@"; echo $? >"$f.code"; } 2>&1 | tee "$f"
+code=$(cat "$f.code" 2>/dev/null || echo 1)
+rm -f "$f.code"
+size=$(($(wc -c <"$f" 2>/dev/null || echo 0) + $(wc -l <"$f" 2>/dev/null || echo 0)))
+if [ "$size" -le "$max" ]; then rm -f "$f"; fi
+exit "$code"`
+
+// spillCommand wraps command to save its full output to file
+func spillCommand(file string, limit int, command []string) []string {
+	return append([]string{"sh", "-c", spillScript, "sh", file, strconv.Itoa(limit)}, command...)
+}
+
+// ExecCommandOutputContext runs a command like ExecCommandContext and
+// returns its output within the output limits. When the limits set a
+// SpillDir, the full output of a truncated command is saved to a file there.
+func (c *Client) ExecCommandOutputContext(ctx context.Context, podName, namespace string, command []string) (*Output, error) {
+	return c.ExecCommandOutputSecretsContext(ctx, podName, namespace, command, nil)
+}
+
+// ExecCommandOutputSecretsContext is ExecCommandOutputContext with the
+// secret values redacted from the output as it is received, before it is
+// truncated, and from the error
+func (c *Client) ExecCommandOutputSecretsContext(ctx context.Context, podName, namespace string, command []string, secrets []string) (*Output, error) {
+	limits := CurrentOutputLimits()
+	spillFile := ""
+	if limits.SpillDir != "" {
+		spillFile = path.Join(limits.SpillDir, fmt.Sprintf("output-%d.log", time.Now().UnixNano()))
+		command = spillCommand(spillFile, limits.Limit(), command)
+	}
+
+	output, err := c.execCapped(ctx, podName, namespace, command, limits.Limit(), secrets)
+	if output.Truncated {
+		output.SpillFile = spillFile
+	}
+	return output, RedactError(err, secrets)
+}
+
+// execCapped runs a command with a terminal, keeping limit bytes of output
+// with the secret values redacted
+func (c *Client) execCapped(ctx context.Context, podName, namespace string, command []string, limit int, secrets []string) (*Output, error) {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	stdout, stderr := NewCappedBuffer(limit), NewCappedBuffer(limit)
+	stdoutRedactor, stderrRedactor := NewRedactor(stdout, secrets), NewRedactor(stderr, secrets)
+	err := c.ExecInPodContext(ctx, podName, namespace, ExecOptions{
+		Command: command,
+		Stdout:  stdoutRedactor,
+		Stderr:  stderrRedactor,
+		TTY:     true,
+	})
+	_ = stdoutRedactor.Flush()
+	_ = stderrRedactor.Flush()
+	if err != nil {
+		return stdout.output(), fmt.Errorf("exec failed: %w, stderr: %s", err, stderr.String())
+	}
+	return stdout.output(), nil
+}
+
+// GetPodLogsOutputContext reads a pod's logs within the output limits
+func (c *Client) GetPodLogsOutputContext(ctx context.Context, name, namespace string) (*Output, error) {
+	podLogs, err := c.StreamPodLogs(ctx, name, namespace, LogOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer podLogs.Close()
+
+	logs := NewCappedBuffer(CurrentOutputLimits().Limit())
+	if _, err := io.Copy(logs, podLogs); err != nil {
+		return logs.output(), fmt.Errorf("failed to read logs for pod %s: %v", name, err)
+	}
+	return logs.output(), nil
+}
+
+// CopyFileFromPod writes the content of a file in a pod to w
+func (c *Client) CopyFileFromPod(ctx context.Context, podName, namespace, file string, w io.Writer) error {
+	if !path.IsAbs(file) {
+		return errors.New("file path must be absolute")
+	}
+	stderr := NewCappedBuffer(4096)
+	if err := c.ExecInPodContext(ctx, podName, namespace, ExecOptions{
+		Command: []string{"cat", "--", file},
+		Stdout:  w,
+		Stderr:  stderr,
+	}); err != nil {
+		return fmt.Errorf("failed to read %s: %w, stderr: %s", file, err, stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package k8sclient
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCappedBuffer(t *testing.T) {
+	b := NewCappedBuffer(10)
+	b.Write([]byte("hello"))
+	b.Write([]byte("world"))
+	if b.Truncated() || b.String() != "helloworld" {
+		t.Fatalf("expected output within the limit unchanged, got %q", b.String())
+	}
+
+	// Small writes wrap around the tail
+	b = NewCappedBuffer(10)
+	for _, c := range "abcdefghijklmnopqrstuvwxyz" {
+		b.Write([]byte(string(c)))
+	}
+	if !b.Truncated() || b.Size() != 26 {
+		t.Fatalf("expected 26 bytes to be truncated, got %v %d", b.Truncated(), b.Size())
+	}
+	if want := "abcde\n[... 16 bytes truncated ...]\nvwxyz"; b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+
+	// A single large write keeps its own tail
+	b = NewCappedBuffer(6)
+	b.Write([]byte("ab"))
+	b.Write([]byte(strings.Repeat("x", 100) + "end"))
+	if want := "abx\n[... 99 bytes truncated ...]\nend"; b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+}
+
+func TestCappedBufferTrimsSplitCharacters(t *testing.T) {
+	b := NewCappedBuffer(8)
+	// "é" is two bytes: the head and tail each cut one in half
+	b.Write([]byte("abcé" + strings.Repeat("-", 10) + "éxyz"))
+	want := "abc\n[... 14 bytes truncated ...]\nxyz"
+	if b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+}
+
+func TestOutputLimitsValidate(t *testing.T) {
+	if err := (OutputLimits{MaxBytes: 10, SpillDir: "/tmp/out"}).Validate(); err != nil {
+		t.Fatalf("expected valid limits, got %v", err)
+	}
+	for _, l := range []OutputLimits{{MaxBytes: -1}, {SpillDir: "out"}} {
+		if err := l.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", l)
+		}
+	}
+	if got := (OutputLimits{}).Limit(); got != DefaultMaxOutput {
+		t.Errorf("expected the default limit, got %d", got)
+	}
+}
+
+func TestSpillCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	run := func(file string, limit int, script string) (string, int) {
+		argv := spillCommand(file, limit, []string{"sh", "-c", script})
+		out, err := exec.Command(argv[0], argv[1:]...).CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("command failed: %v", err)
+		}
+		return string(out), 0
+	}
+
+	small := filepath.Join(dir, "out", "small.log")
+	out, code := run(small, 100, "echo hi; echo err >&2; exit 3")
+	if out != "hi\nerr\n" || code != 3 {
+		t.Fatalf("expected the output and exit code passed through, got %q %d", out, code)
+	}
+	if _, err := os.Stat(small); !os.IsNotExist(err) {
+		t.Fatalf("expected no file for output within the limit, got %v", err)
+	}
+
+	large := filepath.Join(dir, "out", "large.log")
+	if _, code := run(large, 10, "seq 1 100"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	data, err := os.ReadFile(large)
+	if err != nil {
+		t.Fatalf("expected the full output to be kept: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "1\n2\n") || !strings.HasSuffix(string(data), "100\n") {
+		t.Fatalf("unexpected full output %q", data)
+	}
+	if _, err := os.Stat(large + ".code"); !os.IsNotExist(err) {
+		t.Fatalf("expected the exit code file to be removed")
+	}
+}
@@ -0,0 +1,117 @@
+package k8sclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForward forwards connections on a local address to a port of a pod
+type PortForward struct {
+	// Addr is the local host:port accepting connections
+	Addr string
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+// Close stops forwarding and waits for the listener to shut down
+func (p *PortForward) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+}
+
+// Done is closed once forwarding stops, whether closed or because the
+// connection to the pod was lost
+func (p *PortForward) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err reports why forwarding stopped; nil while it runs or after Close
+func (p *PortForward) Err() error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// PortForward forwards a free local port on 127.0.0.1 to port in a pod. It
+// returns once the listener is ready; forwarding stops when ctx is done, the
+// forward is closed, or the pod goes away.
+func (c *Client) PortForward(ctx context.Context, podName, namespace string, port int) (*PortForward, error) {
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	if c.config == nil {
+		return nil, errors.New("port forwarding requires a REST config")
+	}
+	if namespace == "" {
+		namespace = c.namespace
+	}
+
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create port forward transport: %v", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	p := &PortForward{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	ready := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"0:" + strconv.Itoa(port)}, p.stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward port %d: %v", port, err)
+	}
+
+	go func() {
+		defer close(p.done)
+		if err := fw.ForwardPorts(); err != nil {
+			p.err = fmt.Errorf("port forward to %s:%d stopped: %w", podName, port, err)
+		}
+	}()
+
+	select {
+	case <-ready:
+	case <-p.done:
+		return nil, p.err
+	case <-ctx.Done():
+		p.Close()
+		return nil, ctx.Err()
+	}
+
+	ports, err := fw.GetPorts()
+	if err != nil || len(ports) == 0 {
+		p.Close()
+		return nil, fmt.Errorf("failed to forward port %d: %v", port, err)
+	}
+	p.Addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(int(ports[0].Local)))
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Close()
+		case <-p.done:
+		}
+	}()
+	return p, nil
+}
@@ -0,0 +1,41 @@
+package k8sclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestPortForwardRejectsInvalidRequests(t *testing.T) {
+	client := NewClientFromClientset(fake.NewSimpleClientset(), nil, "default")
+
+	if _, err := client.PortForward(context.Background(), "sandbox-1", "", 0); err == nil {
+		t.Fatal("expected invalid port to be rejected")
+	}
+	if _, err := client.PortForward(context.Background(), "sandbox-1", "", 8080); err == nil {
+		t.Fatal("expected an error without a REST config")
+	}
+}
+
+func TestPortForwardFailsWhenUpgradeRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "pods \"sandbox-1\" not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	config := &rest.Config{Host: server.URL}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientFromClientset(clientset, config, "default")
+
+	if _, err := client.PortForward(context.Background(), "sandbox-1", "", 8080); err == nil {
+		t.Fatal("expected forwarding to a missing pod to fail")
+	}
+}
@@ -0,0 +1,54 @@
+package k8sclient
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Resources is a container's compute resource profile, keyed by resource
+// name such as "cpu" and "memory" with Kubernetes quantities as values
+type Resources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// Validate reports whether every quantity parses
+func (r Resources) Validate() error {
+	if _, err := resourceList(r.Requests); err != nil {
+		return fmt.Errorf("resource requests: %v", err)
+	}
+	if _, err := resourceList(r.Limits); err != nil {
+		return fmt.Errorf("resource limits: %v", err)
+	}
+	return nil
+}
+
+func (r Resources) requirements() (corev1.ResourceRequirements, error) {
+	var req corev1.ResourceRequirements
+	var err error
+	if req.Requests, err = resourceList(r.Requests); err != nil {
+		return req, fmt.Errorf("resource requests: %v", err)
+	}
+	if req.Limits, err = resourceList(r.Limits); err != nil {
+		return req, fmt.Errorf("resource limits: %v", err)
+	}
+	return req, nil
+}
+
+func resourceList(quantities map[string]string) (corev1.ResourceList, error) {
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+
+	list := corev1.ResourceList{}
+	for name, value := range quantities {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s quantity %q: %v", name, value, err)
+		}
+		list[corev1.ResourceName(name)] = q
+	}
+	return list, nil
+}
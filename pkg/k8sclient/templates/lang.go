@@ -12,6 +12,7 @@ func LanguageLookup(lang string) (string, error) {
 		"ruby":   "ruby:2.7",
 		"php":    "php:8.0",
 		"rust":   "rust:1.56",
+		"bash":   "alpine:latest",
 	}
 
 	if file, exists := languages[lang]; exists {
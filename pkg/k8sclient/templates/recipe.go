@@ -0,0 +1,106 @@
+package templates
+
+import "errors"
+
+// Recipe describes how to build and run a multi-file project. Script is run by
+// sh from the project root with the entrypoint as "$1".
+type Recipe struct {
+	// DefaultEntrypoint is used when the caller does not name one
+	DefaultEntrypoint string
+	Script            string
+
+	// Install adds packages with the language's package manager. It is run
+	// from the project root with the package names as "$@"; empty when the
+	// language has no package manager.
+	Install string
+	// Manifests are dependency files whose presence triggers ManifestInstall
+	Manifests []string
+	// ManifestInstall installs the dependencies declared by Manifests
+	ManifestInstall string
+	// CacheDir is where the package manager keeps downloads in the
+	// language's image, and where shared cache volumes are mounted
+	CacheDir string
+}
+
+var recipes = map[string]Recipe{
+	"python": {
+		DefaultEntrypoint: "main.py",
+		// The project root is importable so packages can import each other
+		Script:          `PYTHONPATH="$PWD${PYTHONPATH:+:$PYTHONPATH}" exec python3 "$1"`,
+		Install:         `exec pip install --disable-pip-version-check "$@"`,
+		Manifests:       []string{"requirements.txt"},
+		ManifestInstall: `exec pip install --disable-pip-version-check -r requirements.txt`,
+		CacheDir:        "/root/.cache/pip",
+	},
+	"go": {
+		DefaultEntrypoint: ".",
+		Script:            `[ -f go.mod ] || go mod init sandbox >/dev/null 2>&1; exec go run "$1"`,
+		Install:           `[ -f go.mod ] || go mod init sandbox >/dev/null 2>&1; exec go get "$@"`,
+		Manifests:         []string{"go.mod"},
+		ManifestInstall:   `exec go mod download`,
+		CacheDir:          "/go/pkg/mod",
+	},
+	"node": {
+		DefaultEntrypoint: "index.js",
+		Script:            `exec node "$1"`,
+		Install:           `exec npm install --no-audit --no-fund "$@"`,
+		Manifests:         []string{"package.json"},
+		ManifestInstall:   `exec npm install --no-audit --no-fund`,
+		CacheDir:          "/root/.npm",
+	},
+	"java": {
+		// The entrypoint is the fully qualified main class
+		DefaultEntrypoint: "Main",
+		Script: `if [ -f pom.xml ]; then
+  exec mvn -q -B compile exec:java -Dexec.mainClass="$1"
+elif [ -f build.gradle ] || [ -f build.gradle.kts ]; then
+  if [ -x ./gradlew ]; then exec ./gradlew -q run; else exec gradle -q run; fi
+else
+  mkdir -p /tmp/project-classes && find . -name '*.java' > /tmp/project-sources.txt &&
+  javac -d /tmp/project-classes @/tmp/project-sources.txt && exec java -cp /tmp/project-classes "$1"
+fi`,
+		Manifests:       []string{"pom.xml"},
+		ManifestInstall: `exec mvn -q -B dependency:resolve`,
+		CacheDir:        "/root/.m2/repository",
+	},
+	"ruby": {
+		DefaultEntrypoint: "main.rb",
+		Script:            `exec ruby -I . "$1"`,
+		Install:           `exec gem install --no-document "$@"`,
+		Manifests:         []string{"Gemfile"},
+		ManifestInstall:   `exec bundle install`,
+		CacheDir:          "/usr/local/bundle/cache",
+	},
+	"php": {
+		DefaultEntrypoint: "index.php",
+		Script:            `exec php "$1"`,
+		Install:           `exec composer require --no-interaction "$@"`,
+		Manifests:         []string{"composer.json"},
+		ManifestInstall:   `exec composer install --no-interaction`,
+		CacheDir:          "/root/.composer/cache",
+	},
+	"rust": {
+		DefaultEntrypoint: "src/main.rs",
+		Script: `if [ -f Cargo.toml ]; then
+  exec cargo run -q
+else
+  rustc -o /tmp/project-bin "$1" && exec /tmp/project-bin
+fi`,
+		Install:         `[ -f Cargo.toml ] || cargo init -q --name sandbox .; exec cargo add "$@"`,
+		Manifests:       []string{"Cargo.toml"},
+		ManifestInstall: `exec cargo fetch`,
+		CacheDir:        "/usr/local/cargo/registry",
+	},
+	"bash": {
+		DefaultEntrypoint: "main.sh",
+		Script:            `exec sh "$1"`,
+	},
+}
+
+// RecipeLookup returns the build-and-run recipe for a given programming language.
+func RecipeLookup(lang string) (Recipe, error) {
+	if recipe, exists := recipes[lang]; exists {
+		return recipe, nil
+	}
+	return Recipe{}, errors.New("unsupported language: " + lang)
+}
@@ -0,0 +1,139 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// Template is a named sandbox environment: a language with an optional custom
+// image, packages installed and setup commands run when a sandbox is created
+type Template struct {
+	Name     string `json:"-"`
+	Language string `json:"language"`
+	// Image overrides the language's default image
+	Image     string              `json:"image,omitempty"`
+	Packages  []string            `json:"packages,omitempty"`
+	Env       map[string]string   `json:"env,omitempty"`
+	Resources k8sclient.Resources `json:"resources,omitempty"`
+	// Setup commands run with sh, in order, after packages are installed
+	Setup   []string `json:"setup,omitempty"`
+	WorkDir string   `json:"workdir,omitempty"`
+}
+
+var (
+	templatesMu sync.RWMutex
+	registered  = map[string]Template{}
+)
+
+// Validate reports whether a sandbox can be created from the template
+func (t Template) Validate() error {
+	if t.Name == "" {
+		return errors.New("template needs a name")
+	}
+	if _, err := LanguageLookup(t.Language); err != nil {
+		return fmt.Errorf("template %s: %v", t.Name, err)
+	}
+	if len(t.Packages) > 0 {
+		if err := ValidatePackages(t.Packages); err != nil {
+			return fmt.Errorf("template %s: %v", t.Name, err)
+		}
+		if recipe, err := RecipeLookup(t.Language); err != nil || recipe.Install == "" {
+			return fmt.Errorf("template %s: no package manager configured for %s", t.Name, t.Language)
+		}
+	}
+	if err := k8sclient.ValidateEnv(t.Env); err != nil {
+		return fmt.Errorf("template %s: %v", t.Name, err)
+	}
+	if err := t.Resources.Validate(); err != nil {
+		return fmt.Errorf("template %s: %v", t.Name, err)
+	}
+	if t.WorkDir != "" && !strings.HasPrefix(t.WorkDir, "/") {
+		return fmt.Errorf("template %s: workdir %q must be absolute", t.Name, t.WorkDir)
+	}
+	return nil
+}
+
+// Apply configures a pod spec from the template. Environment variables
+// already on the spec take precedence over the template's.
+func (t Template) Apply(spec *k8sclient.PodSpec) {
+	if t.Image != "" {
+		spec.Image = t.Image
+	}
+
+	env := make(map[string]string, len(t.Env)+len(spec.Env))
+	for k, v := range t.Env {
+		env[k] = v
+	}
+	for k, v := range spec.Env {
+		env[k] = v
+	}
+	if len(env) > 0 {
+		spec.Env = env
+	}
+
+	spec.Resources = t.Resources
+	if t.WorkDir != "" {
+		spec.WorkingDir = t.WorkDir
+	}
+
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	spec.Labels[k8sclient.LabelTemplate] = t.Name
+}
+
+// RegisterTemplate validates a template and makes it available by name,
+// replacing any template registered under the same name
+func RegisterTemplate(t Template) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	registered[t.Name] = t
+	return nil
+}
+
+// TemplateLookup returns the registered template with the given name
+func TemplateLookup(name string) (Template, error) {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+
+	if t, exists := registered[name]; exists {
+		return t, nil
+	}
+	return Template{}, errors.New("unknown template: " + name)
+}
+
+// TemplateNames returns the names of the registered templates, sorted
+func TemplateNames() []string {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidatePackages rejects empty package names and names that a package
+// manager would parse as options
+func ValidatePackages(pkgs []string) error {
+	if len(pkgs) == 0 {
+		return errors.New("no packages given")
+	}
+	for _, name := range pkgs {
+		if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, "\x00\n\r") {
+			return fmt.Errorf("invalid package name %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package templates_test
+
+import (
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+)
+
+func TestValidatePackages(t *testing.T) {
+	valid := []string{"requests==2.31.0", "lodash@4", "github.com/google/uuid@latest", "serde"}
+	if err := templates.ValidatePackages(valid); err != nil {
+		t.Fatalf("expected %v to be accepted: %v", valid, err)
+	}
+
+	for _, pkgs := range [][]string{nil, {""}, {"--index-url=http://evil"}, {"-r", "requirements.txt"}, {"ok\nrm -rf /"}} {
+		if err := templates.ValidatePackages(pkgs); err == nil {
+			t.Errorf("expected %q to be rejected", pkgs)
+		}
+	}
+}
+
+func TestRegisterTemplate(t *testing.T) {
+	tpl := templates.Template{
+		Name:      "data-science",
+		Language:  "python",
+		Image:     "registry.example.com/data-science:1.4",
+		Packages:  []string{"pandas"},
+		Env:       map[string]string{"MPLBACKEND": "Agg", "MODE": "template"},
+		Resources: k8sclient.Resources{Limits: map[string]string{"cpu": "2", "memory": "4Gi"}},
+		WorkDir:   "/srv/work",
+	}
+	if err := templates.RegisterTemplate(tpl); err != nil {
+		t.Fatalf("failed to register template: %v", err)
+	}
+
+	got, err := templates.TemplateLookup("data-science")
+	if err != nil {
+		t.Fatalf("failed to look up template: %v", err)
+	}
+
+	spec := k8sclient.PodSpec{Image: "python:3.9", Env: map[string]string{"MODE": "request"}}
+	got.Apply(&spec)
+	if spec.Image != tpl.Image || spec.WorkingDir != "/srv/work" || spec.Labels[k8sclient.LabelTemplate] != "data-science" {
+		t.Fatalf("template not applied: %+v", spec)
+	}
+	if spec.Env["MPLBACKEND"] != "Agg" || spec.Env["MODE"] != "request" {
+		t.Fatalf("expected request env to override template env, got %v", spec.Env)
+	}
+
+	if _, err := templates.TemplateLookup("missing"); err == nil {
+		t.Fatal("expected an unknown template to be rejected")
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	invalid := []templates.Template{
+		{Language: "python"},
+		{Name: "t", Language: "cobol"},
+		{Name: "t", Language: "python", Packages: []string{"--pre"}},
+		{Name: "t", Language: "python", Env: map[string]string{"BAD NAME": "x"}},
+		{Name: "t", Language: "python", Resources: k8sclient.Resources{Limits: map[string]string{"memory": "lots"}}},
+		{Name: "t", Language: "python", WorkDir: "relative"},
+		{Name: "t", Language: "java", Packages: []string{"junit"}},
+	}
+	for _, tpl := range invalid {
+		if err := tpl.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", tpl)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package k8sclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Volume mounts a persistent volume claim or host directory into a pod,
+// typically to share package manager caches between sandboxes
+type Volume struct {
+	// MountPath is the absolute path inside the container
+	MountPath string
+	// ClaimName names a PersistentVolumeClaim; exactly one of ClaimName and
+	// HostPath is set
+	ClaimName string
+	HostPath  string
+	// ReadOnly mounts the source read-only
+	ReadOnly bool
+	// CopyOnWrite seeds a pod-local directory from the source before the
+	// container starts, so writes never reach the shared volume
+	CopyOnWrite bool
+}
+
+// Validate reports whether the volume can be mounted
+func (v Volume) Validate() error {
+	if !strings.HasPrefix(v.MountPath, "/") {
+		return fmt.Errorf("volume mount path %q must be absolute", v.MountPath)
+	}
+	if (v.ClaimName == "") == (v.HostPath == "") {
+		return fmt.Errorf("volume at %s needs exactly one of a claim name or a host path", v.MountPath)
+	}
+	if v.HostPath != "" && !strings.HasPrefix(v.HostPath, "/") {
+		return fmt.Errorf("host path %q must be absolute", v.HostPath)
+	}
+	if v.ReadOnly && v.CopyOnWrite {
+		return errors.New("volume cannot be both read-only and copy-on-write")
+	}
+	return nil
+}
+
+func (v Volume) source(name string) corev1.Volume {
+	if v.ClaimName != "" {
+		return corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: v.ClaimName,
+					ReadOnly:  v.ReadOnly || v.CopyOnWrite,
+				},
+			},
+		}
+	}
+
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: v.HostPath, Type: &hostPathType},
+		},
+	}
+}
+
+// seedCommand copies a volume's contents into a pod-local directory. Paths
+// are passed as positional arguments, never interpolated.
+func seedCommand(src, dst string) []string {
+	return []string{"sh", "-c", `cp -a "$1"/. "$2"/`, "sh", src, dst}
+}
+
+// applyVolumes adds the spec's volumes to the pod. Copy-on-write volumes are
+// mounted as emptyDirs seeded by an init container running the sandbox image.
+func applyVolumes(pod *corev1.Pod, spec PodSpec) error {
+	for i, v := range spec.Volumes {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("volume-%d", i)
+		if !v.CopyOnWrite {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, v.source(name))
+			pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+				Name:      name,
+				MountPath: v.MountPath,
+				ReadOnly:  v.ReadOnly,
+			})
+			continue
+		}
+
+		srcName := name + "-source"
+		const srcPath, dstPath = "/sandboxed/source", "/sandboxed/target"
+		pod.Spec.Volumes = append(pod.Spec.Volumes,
+			v.source(srcName),
+			corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		)
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{
+			Name:    "seed-" + name,
+			Image:   spec.Image,
+			Command: seedCommand(srcPath, dstPath),
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: srcName, MountPath: srcPath, ReadOnly: true},
+				{Name: name, MountPath: dstPath},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: v.MountPath,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package k8sclient
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyVolumes(t *testing.T) {
+	spec := PodSpec{
+		Image: "python:3.12",
+		Volumes: []Volume{
+			{MountPath: "/root/.cache/pip", ClaimName: "pip-cache", ReadOnly: true},
+			{MountPath: "/root/.npm", HostPath: "/var/cache/npm", CopyOnWrite: true},
+		},
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "sandbox"}}}}
+
+	if err := applyVolumes(pod, spec); err != nil {
+		t.Fatalf("failed to apply volumes: %v", err)
+	}
+
+	mounts := pod.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 2 || !mounts[0].ReadOnly || mounts[0].MountPath != "/root/.cache/pip" || mounts[1].ReadOnly {
+		t.Fatalf("unexpected container mounts: %+v", mounts)
+	}
+	if claim := pod.Spec.Volumes[0].PersistentVolumeClaim; claim == nil || claim.ClaimName != "pip-cache" || !claim.ReadOnly {
+		t.Fatalf("expected a read-only claim, got %+v", pod.Spec.Volumes[0])
+	}
+
+	// The copy-on-write volume is a pod-local emptyDir seeded from the host path
+	if len(pod.Spec.Volumes) != 3 || pod.Spec.Volumes[1].HostPath == nil || pod.Spec.Volumes[2].EmptyDir == nil {
+		t.Fatalf("unexpected pod volumes: %+v", pod.Spec.Volumes)
+	}
+	if mounts[1].Name != pod.Spec.Volumes[2].Name {
+		t.Fatalf("container should mount the emptyDir, got %s", mounts[1].Name)
+	}
+	if len(pod.Spec.InitContainers) != 1 || pod.Spec.InitContainers[0].Image != "python:3.12" {
+		t.Fatalf("expected one seeding init container, got %+v", pod.Spec.InitContainers)
+	}
+}
+
+func TestVolumeValidate(t *testing.T) {
+	invalid := []Volume{
+		{MountPath: "relative", ClaimName: "c"},
+		{MountPath: "/cache"},
+		{MountPath: "/cache", ClaimName: "c", HostPath: "/var/cache"},
+		{MountPath: "/cache", HostPath: "var/cache"},
+		{MountPath: "/cache", ClaimName: "c", ReadOnly: true, CopyOnWrite: true},
+	}
+	for _, v := range invalid {
+		if err := v.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", v)
+		}
+	}
+}
+
+// TestSeedCommand runs the init container's command against a local shell
+func TestSeedCommand(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "it's a $(source)")
+	dst := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "wheels"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "wheels", "requests.whl"), []byte("wheel"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, ".hidden"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	argv := seedCommand(src, dst)
+	if out, err := exec.Command(argv[0], argv[1:]...).CombinedOutput(); err != nil {
+		t.Fatalf("seed failed: %v: %s", err, out)
+	}
+
+	for _, name := range []string{"wheels/requests.whl", ".hidden"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("expected %s to be copied: %v", name, err)
+		}
+	}
+}
@@ -2,33 +2,198 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"github.com/system32-ai/sandboxed/pkg/registry"
 	"github.com/system32-ai/sandboxed/pkg/sdk"
+	"github.com/system32-ai/sandboxed/pkg/snapshot"
+	"github.com/system32-ai/sandboxed/pkg/testrun"
 )
 
 // SandboxManager manages the state of all active sandboxes
 type SandboxManager struct {
 	mu        sync.RWMutex
 	sandboxes map[string]sdk.Sandboxed
+	registry  registry.Registry
+	owner     string
+	config    *config.Config
+	client    *k8sclient.Client
+	operator  bool
+	snapshots snapshot.Store
 }
 
-// NewSandboxManager creates a new sandbox manager
+// NewSandboxManager creates a new sandbox manager backed by an in-memory registry
 func NewSandboxManager() *SandboxManager {
 	return &SandboxManager{
 		sandboxes: make(map[string]sdk.Sandboxed),
+		registry:  registry.NewMemory(),
 	}
 }
 
-// AddSandbox adds a sandbox to the manager
-func (sm *SandboxManager) AddSandbox(name string, sandbox sdk.Sandboxed) {
+// SetConfig applies operator configuration, such as cache volumes, to the
+// sandboxes created from now on
+func (sm *SandboxManager) SetConfig(cfg *config.Config) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.config = cfg
+}
+
+// SetClient makes sandboxes created from now on use client instead of the
+// SDK's shared default client
+func (sm *SandboxManager) SetClient(client *k8sclient.Client) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.client = client
+}
+
+// SetOperator makes sandboxes created from now on Sandbox resources that
+// 'sandboxed operator' builds and provisions
+func (sm *SandboxManager) SetOperator(enabled bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.operator = enabled
+}
+
+// SetSnapshotStore makes snapshot_sandbox store snapshots in store, and lets
+// create_sandbox seed new sandboxes from them
+func (sm *SandboxManager) SetSnapshotStore(store snapshot.Store) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.snapshots = store
+}
+
+// snapshotStore returns the configured snapshot store, or nil
+func (sm *SandboxManager) snapshotStore() snapshot.Store {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.snapshots
+}
+
+// allowedGitSecrets returns the secrets clone_repo may use besides the ones a
+// sandbox references
+func (sm *SandboxManager) allowedGitSecrets() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.config == nil {
+		return nil
+	}
+	return sm.config.GitSecrets
+}
+
+// sandboxOptions returns the configured options for new sandboxes of lang
+func (sm *SandboxManager) sandboxOptions(lang sdk.Language) ([]sdk.SandboxOption, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var opts []sdk.SandboxOption
+	if sm.client != nil {
+		opts = append(opts, sdk.WithClient(sm.client))
+	}
+	// The operator mounts the caches from its own config
+	if sm.operator {
+		return append(opts, sdk.WithOperator()), nil
+	}
+
+	volumes, err := sm.config.CacheVolumes(string(lang))
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) > 0 {
+		opts = append(opts, sdk.WithVolumes(volumes...))
+	}
+	return opts, nil
+}
+
+// NewSandboxManagerWithRegistry creates a sandbox manager that persists its
+// sandboxes in reg and rehydrates handles for the ones already recorded there.
+// When owner is set, only sandboxes recorded with that owner are rehydrated.
+// Records whose pod no longer exists are removed from reg. Sandboxes use
+// client, or the SDK's shared default client when it is nil.
+func NewSandboxManagerWithRegistry(reg registry.Registry, owner string, client *k8sclient.Client) (*SandboxManager, error) {
+	sm := &SandboxManager{
+		sandboxes: make(map[string]sdk.Sandboxed),
+		registry:  reg,
+		owner:     owner,
+		client:    client,
+	}
+
+	var opts []sdk.SandboxOption
+	if client != nil {
+		opts = append(opts, sdk.WithClient(client))
+	}
+
+	records, err := reg.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sandbox registry: %v", err)
+	}
+
+	for _, rec := range records {
+		if owner != "" && rec.Owner != owner {
+			continue
+		}
+
+		info := sdk.SandboxInfo{
+			ID:        rec.ID,
+			Name:      rec.Name,
+			Language:  sdk.Language(rec.Language),
+			Namespace: rec.Namespace,
+		}
+
+		// Records whose pod is gone are pruned; when the cluster cannot be
+		// reached they are kept, as the pod may still be there
+		live, err := sdk.Exists(info, opts...)
+		if err != nil {
+			log.Printf("Could not check sandbox '%s' from registry, keeping it: %v", rec.Name, err)
+		} else if !live {
+			log.Printf("Pruning sandbox '%s' from registry: pod %s no longer exists", rec.Name, rec.ID)
+			if err := reg.Delete(rec.Name); err != nil {
+				log.Printf("Failed to prune sandbox '%s': %v", rec.Name, err)
+			}
+			continue
+		}
+
+		sandbox, err := sdk.Reattach(info, opts...)
+		if err != nil {
+			log.Printf("Skipping sandbox '%s' from registry: %v", rec.Name, err)
+			continue
+		}
+		sm.sandboxes[rec.Name] = sandbox
+	}
+
+	if len(sm.sandboxes) > 0 {
+		log.Printf("Rehydrated %d sandbox(es) from registry", len(sm.sandboxes))
+	}
+
+	return sm, nil
+}
+
+// AddSandbox adds a sandbox to the manager and records it in the registry
+func (sm *SandboxManager) AddSandbox(name string, sandbox sdk.Sandboxed) error {
+	info := sandbox.Info()
+	if err := sm.registry.Put(registry.Record{
+		Name:      name,
+		ID:        info.ID,
+		Language:  string(info.Language),
+		Namespace: info.Namespace,
+		Owner:     sm.owner,
+	}); err != nil {
+		return fmt.Errorf("failed to record sandbox '%s': %v", name, err)
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.sandboxes[name] = sandbox
+	return nil
 }
 
 // GetSandbox retrieves a sandbox by name
@@ -39,11 +204,14 @@ func (sm *SandboxManager) GetSandbox(name string) (sdk.Sandboxed, bool) {
 	return sandbox, exists
 }
 
-// RemoveSandbox removes a sandbox from the manager
+// RemoveSandbox removes a sandbox from the manager and the registry
 func (sm *SandboxManager) RemoveSandbox(name string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	delete(sm.sandboxes, name)
+	if err := sm.registry.Delete(name); err != nil {
+		log.Printf("Failed to remove sandbox '%s' from registry: %v", name, err)
+	}
 }
 
 // ListSandboxes returns all sandbox names
@@ -54,20 +222,29 @@ func (sm *SandboxManager) ListSandboxes() []string {
 	for name := range sm.sandboxes {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
+// Close releases the registry
+func (sm *SandboxManager) Close() error {
+	return sm.registry.Close()
+}
+
 // NewServer creates a new MCP server with sandbox tools
 func NewServer() *mcp.Server {
+	// Create sandbox manager for state tracking
+	return NewServerWithManager(NewSandboxManager())
+}
+
+// NewServerWithManager creates a new MCP server whose tools operate on sandboxManager
+func NewServerWithManager(sandboxManager *SandboxManager) *mcp.Server {
 	// Create MCP server with proper Implementation struct
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "sandboxed",
 		Version: "1.0.0",
 	}, nil)
 
-	// Create sandbox manager for state tracking
-	sandboxManager := NewSandboxManager()
-
 	// Register sandbox tools
 	registerSandboxTools(server, sandboxManager)
 
@@ -78,10 +255,17 @@ func NewServer() *mcp.Server {
 func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 	// Register create_sandbox tool
 	type CreateSandboxArgs struct {
-		Name      string            `json:"name"`
-		Language  string            `json:"language"`
+		Name     string `json:"name"`
+		Language string `json:"language,omitempty"`
+		// Template names an environment template from the server config
+		Template  string            `json:"template,omitempty"`
 		Namespace string            `json:"namespace,omitempty"`
 		Labels    map[string]string `json:"labels,omitempty"`
+		Env       map[string]string `json:"env,omitempty"`
+		// Secrets are resolved in the cluster; their values never reach the client
+		Secrets []k8sclient.SecretRef `json:"secrets,omitempty"`
+		// Snapshot seeds the workspace from a stored snapshot
+		Snapshot string `json:"snapshot,omitempty"`
 	}
 
 	type CreateSandboxResult struct {
@@ -91,7 +275,7 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "create_sandbox",
-		Description: "Creates a new sandbox environment for code execution",
+		Description: "Creates a new sandbox environment for code execution, from a language or a named environment template",
 	}, func(ctx context.Context, request *mcp.CallToolRequest, args CreateSandboxArgs) (*mcp.CallToolResult, CreateSandboxResult, error) {
 		// Check if sandbox already exists
 		if _, exists := sandboxManager.GetSandbox(args.Name); exists {
@@ -105,13 +289,60 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 		// Prepare sandbox options
 		var opts []sdk.SandboxOption
 		if args.Namespace != "" {
-			opts = append(opts, sdk.SandboxOption{Name: "namespace", Value: args.Namespace})
+			opts = append(opts, sdk.WithNamespace(args.Namespace))
 		}
 		if args.Labels != nil {
-			opts = append(opts, sdk.SandboxOption{Name: "labels", Value: args.Labels})
+			opts = append(opts, sdk.WithLabels(args.Labels))
+		}
+		if args.Env != nil {
+			opts = append(opts, sdk.WithEnv(args.Env))
+		}
+		if args.Secrets != nil {
+			opts = append(opts, sdk.WithSecrets(args.Secrets...))
+		}
+
+		// A template supplies the language when none is given
+		language := args.Language
+		if args.Template != "" {
+			tpl, err := templates.TemplateLookup(args.Template)
+			if err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("Invalid template: %v", err)},
+					},
+				}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+			}
+			if language == "" {
+				language = tpl.Language
+			}
+			opts = append(opts, sdk.WithTemplate(tpl.Name))
+		}
+
+		// So does a snapshot, which must come from the configured store
+		if args.Snapshot != "" {
+			store := sandboxManager.snapshotStore()
+			if store == nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: "No snapshot store configured"},
+					},
+				}, CreateSandboxResult{Success: false, Message: "No snapshot store configured"}, nil
+			}
+			info, archive, err := snapshot.Load(ctx, store, args.Snapshot)
+			if err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("Failed to load snapshot '%s': %v", args.Snapshot, err)},
+					},
+				}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+			}
+			if language == "" {
+				language = info.Language
+			}
+			opts = append(opts, sdk.WithSnapshot(archive))
 		}
 
-		lang, err := sdk.ToLanguage(args.Language)
+		lang, err := sdk.ToLanguage(language)
 		if err != nil {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -120,6 +351,16 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 			}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
 		}
 
+		configured, err := sandboxManager.sandboxOptions(lang)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Invalid sandbox configuration: %v", err)},
+				},
+			}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+		}
+		opts = append(opts, configured...)
+
 		// Create sandbox
 		sandbox, err := sdk.CreateSandbox(args.Name, lang, opts...)
 		if err != nil {
@@ -131,26 +372,39 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 		}
 
 		// Add to manager
-		sandboxManager.AddSandbox(args.Name, sandbox)
+		if err := sandboxManager.AddSandbox(args.Name, sandbox); err != nil {
+			// Don't leave behind a sandbox nobody can reach by name
+			_ = sandbox.Destroy()
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to register sandbox '%s': %v", args.Name, err)},
+				},
+			}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+		}
 
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("Successfully created sandbox '%s' with language '%s'", args.Name, args.Language)},
+				&mcp.TextContent{Text: fmt.Sprintf("Successfully created sandbox '%s' with language '%s'", args.Name, lang)},
 			},
 		}, CreateSandboxResult{Success: true, Message: "Sandbox created successfully"}, nil
 	})
 
 	// Register run_code tool
 	type RunCodeArgs struct {
-		SandboxName string `json:"sandbox_name"`
-		Code        string `json:"code"`
+		SandboxName string            `json:"sandbox_name"`
+		Code        string            `json:"code"`
+		Env         map[string]string `json:"env,omitempty"`
 	}
 
 	type RunCodeResult struct {
-		Success  bool   `json:"success"`
-		Output   string `json:"output,omitempty"`
-		ExitCode int    `json:"exit_code,omitempty"`
-		Error    string `json:"error,omitempty"`
+		Success bool   `json:"success"`
+		Output  string `json:"output,omitempty"`
+		// Truncated is set when the middle of the output was dropped
+		Truncated bool `json:"truncated,omitempty"`
+		// OutputFile holds the full output of a truncated run, if kept
+		OutputFile string `json:"output_file,omitempty"`
+		ExitCode   int    `json:"exit_code,omitempty"`
+		Error      string `json:"error,omitempty"`
 	}
 
 	mcp.AddTool(server, &mcp.Tool{
@@ -168,7 +422,7 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 		}
 
 		// Run code
-		output, err := sandbox.Run(args.Code)
+		output, err := sandbox.RunWithEnv(args.Code, args.Env)
 		if err != nil {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -179,10 +433,112 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("Code executed successfully in sandbox '%s':\n\nOutput:\n%s\n\nExit Code: %d",
-					args.SandboxName, output.Result, output.ExitCode)},
+				&mcp.TextContent{Text: fmt.Sprintf("Code run in sandbox '%s':\n\nOutput:\n%s\n\nExit Code: %d%s",
+					args.SandboxName, output.Result, output.ExitCode, truncationNote(output))},
+			},
+		}, RunCodeResult{
+			Success:    output.ExitCode == 0,
+			Output:     output.Result,
+			Truncated:  output.Truncated,
+			OutputFile: output.OutputFile,
+			ExitCode:   output.ExitCode,
+			Error:      output.Error,
+		}, nil
+	})
+
+	// Register run_project tool
+	type RunProjectArgs struct {
+		SandboxName string            `json:"sandbox_name"`
+		Files       map[string]string `json:"files"`
+		Entrypoint  string            `json:"entrypoint,omitempty"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "run_project",
+		Description: "Lays out a multi-file project (paths mapped to contents) in a sandbox workspace and runs the language's build-and-run recipe",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args RunProjectArgs) (*mcp.CallToolResult, RunCodeResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, RunCodeResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		files := make(map[string][]byte, len(args.Files))
+		for path, content := range args.Files {
+			files[path] = []byte(content)
+		}
+
+		// Run project
+		output, err := sandbox.RunProject(sdk.Project{Files: files, Entrypoint: args.Entrypoint})
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to run project in sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, RunCodeResult{Success: false, Error: err.Error()}, nil
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Project run in sandbox '%s':\n\nOutput:\n%s\n\nExit Code: %d%s",
+					args.SandboxName, output.Result, output.ExitCode, truncationNote(output))},
 			},
-		}, RunCodeResult{Success: true, Output: output.Result, ExitCode: output.ExitCode}, nil
+		}, RunCodeResult{
+			Success:    output.ExitCode == 0,
+			Output:     output.Result,
+			Truncated:  output.Truncated,
+			OutputFile: output.OutputFile,
+			ExitCode:   output.ExitCode,
+			Error:      output.Error,
+		}, nil
+	})
+
+	// Register install_packages tool
+	type InstallPackagesArgs struct {
+		SandboxName string   `json:"sandbox_name"`
+		Language    string   `json:"language,omitempty"`
+		Packages    []string `json:"packages"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "install_packages",
+		Description: "Installs packages in a sandbox with the language's package manager (pip, npm, go get, gem, composer or cargo); the language defaults to the sandbox's own",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args InstallPackagesArgs) (*mcp.CallToolResult, RunCodeResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, RunCodeResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		// Install packages
+		result, err := sandbox.InstallPackages(sdk.Language(args.Language), args.Packages)
+		if err != nil && result == nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to install packages in sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, RunCodeResult{Success: false, Error: err.Error()}, nil
+		}
+
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Installing %s in sandbox '%s':\n\nOutput:\n%s\n\nExit Code: %d",
+					strings.Join(result.Packages, ", "), args.SandboxName, result.Output, result.ExitCode)},
+			},
+		}, RunCodeResult{Success: result.Success, Output: result.Output, ExitCode: result.ExitCode, Error: errMsg}, nil
 	})
 
 	// Register destroy_sandbox tool
@@ -228,6 +584,319 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 		}, DestroySandboxResult{Success: true, Message: "Sandbox destroyed successfully"}, nil
 	})
 
+	// Register clone_repo tool
+	type CloneRepoArgs struct {
+		SandboxName string `json:"sandbox_name"`
+		URL         string `json:"url"`
+		Ref         string `json:"ref,omitempty"`
+		Path        string `json:"path,omitempty"`
+		Depth       int    `json:"depth,omitempty"`
+		// Credentials name a Kubernetes Secret key; the value never reaches the
+		// client. Only secrets the sandbox references or the config's
+		// gitSecrets lists are accepted.
+		Credentials *sdk.GitCredentials `json:"credentials,omitempty"`
+	}
+
+	type GitResult struct {
+		Success bool   `json:"success"`
+		Commit  string `json:"commit,omitempty"`
+		Diff    string `json:"diff,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "clone_repo",
+		Description: "Clones a git repository into a sandbox workspace at a branch, tag or commit, optionally shallow and with credentials from a Kubernetes Secret",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args CloneRepoArgs) (*mcp.CallToolResult, GitResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, GitResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		var opts []sdk.CloneOption
+		if args.Depth > 0 {
+			opts = append(opts, sdk.WithCloneDepth(args.Depth))
+		}
+		if args.Credentials != nil {
+			opts = append(opts, sdk.WithGitCredentials(*args.Credentials),
+				sdk.WithAllowedGitSecrets(sandboxManager.allowedGitSecrets()...))
+		}
+
+		commit, err := sandbox.CloneRepo(args.URL, args.Ref, args.Path, opts...)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to clone %s in sandbox '%s': %v", args.URL, args.SandboxName, err)},
+				},
+			}, GitResult{Success: false, Error: err.Error()}, nil
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Cloned %s at %s into sandbox '%s'", args.URL, commit, args.SandboxName)},
+			},
+		}, GitResult{Success: true, Commit: commit}, nil
+	})
+
+	// Register apply_patch tool
+	type ApplyPatchArgs struct {
+		SandboxName string `json:"sandbox_name"`
+		Path        string `json:"path,omitempty"`
+		Patch       string `json:"patch"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "apply_patch",
+		Description: "Applies a unified diff to a repository cloned with clone_repo; nothing is applied when any hunk fails",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args ApplyPatchArgs) (*mcp.CallToolResult, GitResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, GitResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		if err := sandbox.ApplyPatch(args.Path, args.Patch); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to apply patch in sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, GitResult{Success: false, Error: err.Error()}, nil
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Applied patch in sandbox '%s'", args.SandboxName)},
+			},
+		}, GitResult{Success: true}, nil
+	})
+
+	// Register git_diff tool
+	type GitDiffArgs struct {
+		SandboxName string `json:"sandbox_name"`
+		Path        string `json:"path,omitempty"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "git_diff",
+		Description: "Returns the changes to a repository cloned with clone_repo since checkout, new files included, as a unified diff",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args GitDiffArgs) (*mcp.CallToolResult, GitResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, GitResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		diff, err := sandbox.Diff(args.Path)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to diff in sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, GitResult{Success: false, Error: err.Error()}, nil
+		}
+
+		text := diff
+		if text == "" {
+			text = "No changes since checkout"
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: text},
+			},
+		}, GitResult{Success: true, Diff: diff}, nil
+	})
+
+	// Register run_tests tool
+	type RunTestsArgs struct {
+		SandboxName string   `json:"sandbox_name"`
+		Framework   string   `json:"framework,omitempty"`
+		Path        string   `json:"path,omitempty"`
+		Args        []string `json:"args,omitempty"`
+	}
+
+	type RunTestsResult struct {
+		Success bool            `json:"success"`
+		Result  *testrun.Result `json:"result,omitempty"`
+		Error   string          `json:"error,omitempty"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "run_tests",
+		Description: "Runs a project's tests and reports each test's name, status, duration and failure message. The framework (pytest, go, jest, rspec, cargo or junit) is detected from the project's files when not given",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args RunTestsArgs) (*mcp.CallToolResult, RunTestsResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, RunTestsResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		opts := sdk.TestOptions{Path: args.Path, Args: args.Args}
+		if args.Framework != "" {
+			framework, err := testrun.ParseFramework(args.Framework)
+			if err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: err.Error()},
+					},
+				}, RunTestsResult{Success: false, Error: err.Error()}, nil
+			}
+			opts.Framework = framework
+		}
+
+		result, err := sandbox.RunTests(opts)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to run tests in sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, RunTestsResult{Success: false, Error: err.Error()}, nil
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: testSummary(result)},
+			},
+		}, RunTestsResult{Success: result.Success, Result: result}, nil
+	})
+
+	// Register fork_sandbox tool
+	type ForkSandboxArgs struct {
+		SandboxName string `json:"sandbox_name"`
+		Name        string `json:"name"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "fork_sandbox",
+		Description: "Creates a new sandbox from the same template as an existing one, with a copy of its workspace and installed packages, to explore an alternative from the same starting point",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args ForkSandboxArgs) (*mcp.CallToolResult, CreateSandboxResult, error) {
+		// Get sandbox
+		source, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, CreateSandboxResult{Success: false, Message: "Sandbox not found"}, nil
+		}
+		if _, exists := sandboxManager.GetSandbox(args.Name); exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' already exists", args.Name)},
+				},
+			}, CreateSandboxResult{Success: false, Message: "Sandbox already exists"}, nil
+		}
+
+		opts, err := sandboxManager.sandboxOptions(source.Info().Language)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Invalid sandbox configuration: %v", err)},
+				},
+			}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+		}
+
+		fork, err := sdk.Fork(source, args.Name, opts...)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to fork sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+		}
+
+		if err := sandboxManager.AddSandbox(args.Name, fork); err != nil {
+			// Don't leave behind a sandbox nobody can reach by name
+			_ = fork.Destroy()
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to register sandbox '%s': %v", args.Name, err)},
+				},
+			}, CreateSandboxResult{Success: false, Message: err.Error()}, nil
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Successfully forked sandbox '%s' into '%s'", args.SandboxName, args.Name)},
+			},
+		}, CreateSandboxResult{Success: true, Message: "Sandbox forked successfully"}, nil
+	})
+
+	// Register snapshot_sandbox tool
+	type SnapshotSandboxArgs struct {
+		SandboxName string `json:"sandbox_name"`
+	}
+
+	type SnapshotSandboxResult struct {
+		Success bool   `json:"success"`
+		ID      string `json:"id,omitempty"`
+		// Archive is the base64-encoded tar.gz, returned when no store is configured
+		Archive string `json:"archive,omitempty"`
+		Size    int64  `json:"size,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "snapshot_sandbox",
+		Description: "Captures a sandbox's workspace; returns a snapshot ID to pass to create_sandbox when a snapshot store is configured, otherwise the base64-encoded tar.gz",
+	}, func(ctx context.Context, request *mcp.CallToolRequest, args SnapshotSandboxArgs) (*mcp.CallToolResult, SnapshotSandboxResult, error) {
+		// Get sandbox
+		sandbox, exists := sandboxManager.GetSandbox(args.SandboxName)
+		if !exists {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Sandbox '%s' not found. Use create_sandbox first.", args.SandboxName)},
+				},
+			}, SnapshotSandboxResult{Success: false, Error: "Sandbox not found"}, nil
+		}
+
+		if store := sandboxManager.snapshotStore(); store != nil {
+			info, err := sdk.SaveSnapshot(store, sandbox)
+			if err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("Failed to snapshot sandbox '%s': %v", args.SandboxName, err)},
+					},
+				}, SnapshotSandboxResult{Success: false, Error: err.Error()}, nil
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Stored snapshot '%s' of sandbox '%s' (%d bytes)", info.ID, args.SandboxName, info.Size)},
+				},
+			}, SnapshotSandboxResult{Success: true, ID: info.ID, Size: info.Size}, nil
+		}
+
+		archive, err := sandbox.Snapshot()
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Failed to snapshot sandbox '%s': %v", args.SandboxName, err)},
+				},
+			}, SnapshotSandboxResult{Success: false, Error: err.Error()}, nil
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Captured sandbox '%s' (%d bytes); no snapshot store is configured, so the archive is returned base64-encoded", args.SandboxName, len(archive))},
+			},
+		}, SnapshotSandboxResult{Success: true, Archive: base64.StdEncoding.EncodeToString(archive), Size: int64(len(archive))}, nil
+	})
+
 	// Register list_sandboxes tool
 	type ListSandboxesArgs struct{}
 
@@ -263,6 +932,45 @@ func registerSandboxTools(server *mcp.Server, sandboxManager *SandboxManager) {
 	})
 }
 
+// truncationNote tells the model that output was cut, and where the full
+// output is when it was kept
+func truncationNote(output *sdk.Output) string {
+	switch {
+	case !output.Truncated:
+		return ""
+	case output.OutputFile != "":
+		return fmt.Sprintf("\n\nThe output was truncated; the full output is in %s in the sandbox.", output.OutputFile)
+	default:
+		return "\n\nThe output was truncated."
+	}
+}
+
+// testSummary describes a test run: the counts, then each failure. The
+// runner's output is included when no test was reported, as it then holds
+// the reason.
+func testSummary(result *testrun.Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d passed, %d failed, %d skipped (exit code %d)\n",
+		result.Framework, result.Passed, result.Failed, result.Skipped, result.ExitCode)
+	for _, t := range result.Tests {
+		if t.Status != testrun.StatusFailed {
+			continue
+		}
+		name := t.Name
+		if t.Suite != "" && t.Suite != t.Name {
+			name = t.Suite + " " + t.Name
+		}
+		fmt.Fprintf(&b, "\nFAIL %s\n", name)
+		if t.Message != "" {
+			b.WriteString(t.Message + "\n")
+		}
+	}
+	if len(result.Tests) == 0 && result.Output != "" {
+		b.WriteString("\n" + result.Output)
+	}
+	return b.String()
+}
+
 // Run starts the MCP server on stdio transport
 func RunServer(server *mcp.Server) error {
 	log.Println("Starting MCP server for sandboxed code execution...")
@@ -341,6 +1049,14 @@ func RunServerSSE(server *mcp.Server, port int) error {
     <ul>
         <li><strong>create_sandbox</strong> - Create a new sandbox environment</li>
         <li><strong>run_code</strong> - Execute code in an existing sandbox</li>
+        <li><strong>run_project</strong> - Run a multi-file project in an existing sandbox</li>
+        <li><strong>install_packages</strong> - Install packages in an existing sandbox</li>
+        <li><strong>snapshot_sandbox</strong> - Capture a sandbox's workspace as a snapshot</li>
+        <li><strong>fork_sandbox</strong> - Create a new sandbox with a copy of an existing sandbox's workspace</li>
+        <li><strong>clone_repo</strong> - Clone a git repository into a sandbox workspace</li>
+        <li><strong>apply_patch</strong> - Apply a unified diff to a cloned repository</li>
+        <li><strong>git_diff</strong> - Show the changes to a cloned repository since checkout</li>
+        <li><strong>run_tests</strong> - Run a project's tests and report each result</li>
         <li><strong>destroy_sandbox</strong> - Destroy a sandbox and clean up resources</li>
         <li><strong>list_sandboxes</strong> - List all active sandboxes</li>
     </ul>
@@ -0,0 +1,92 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+// Create submits a Sandbox resource for the operator to reconcile
+func Create(ctx context.Context, client dynamic.Interface, sandbox *Sandbox) error {
+	if err := sandbox.Spec.Validate(); err != nil {
+		return err
+	}
+
+	u, err := sandbox.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	if _, err := client.Resource(SandboxGVR).Namespace(sandbox.Namespace).Create(ctx, u, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create sandbox %s: %w", sandbox.Name, err)
+	}
+	return nil
+}
+
+// Get reads a Sandbox resource
+func Get(ctx context.Context, client dynamic.Interface, namespace, name string) (*Sandbox, error) {
+	u, err := client.Resource(SandboxGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox %s: %w", name, err)
+	}
+	return FromUnstructured(u)
+}
+
+// WaitReady polls a sandbox until the operator reports it ready, returning an
+// error as soon as it fails
+func WaitReady(ctx context.Context, client dynamic.Interface, namespace, name string, timeout time.Duration) (*Sandbox, error) {
+	var sandbox *Sandbox
+	err := wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		sandbox, err = Get(ctx, client, namespace, name)
+		if err != nil {
+			return false, err
+		}
+
+		switch sandbox.Status.Phase {
+		case PhaseReady:
+			return true, nil
+		case PhaseFailed:
+			reason := "unknown reason"
+			if c := meta.FindStatusCondition(sandbox.Status.Conditions, ConditionReady); c != nil {
+				reason = c.Message
+			}
+			return false, fmt.Errorf("sandbox %s failed: %s", name, reason)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sandbox, nil
+}
+
+// Delete removes a Sandbox resource; its pod and policy go with it
+func Delete(ctx context.Context, client dynamic.Interface, namespace, name string) error {
+	if err := client.Resource(SandboxGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete sandbox %s: %w", name, err)
+	}
+	return nil
+}
+
+// DestroyPod deletes a sandbox pod. A pod owned by a Sandbox resource would
+// be recreated by the operator, so the resource is deleted instead.
+func DestroyPod(ctx context.Context, client *k8sclient.Client, podName, namespace string, force bool) error {
+	pod, err := client.GetPodContext(ctx, podName, namespace)
+	if err == nil {
+		if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == Kind && ref.APIVersion == Group+"/"+Version {
+			dyn, err := client.Dynamic()
+			if err != nil {
+				return err
+			}
+			return Delete(ctx, dyn, pod.Namespace, ref.Name)
+		}
+	}
+
+	return client.DeletePodWithOptions(podName, namespace, force)
+}
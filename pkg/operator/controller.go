@@ -0,0 +1,138 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Controller watches Sandbox resources and the pods they own, and runs the
+// reconciler whenever either changes
+type Controller struct {
+	Reconciler *Reconciler
+	// Namespace limits the controller to one namespace; all when empty
+	Namespace string
+	// Workers is the number of sandboxes reconciled concurrently
+	Workers int
+	// Resync reconciles every sandbox periodically, catching missed events
+	Resync time.Duration
+}
+
+// Run reconciles sandboxes until ctx is cancelled
+func (c *Controller) Run(ctx context.Context) error {
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer queue.ShutDown()
+	// Provisioning finishes in the background and reports back through the queue
+	c.Reconciler.Requeue = func(namespace, name string) {
+		queue.Add(namespace + "/" + name)
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.Reconciler.Client, c.Resync, c.Namespace, nil)
+	// Only sandbox pods and policies are watched, not every pod in the cluster
+	owned := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.Reconciler.Client, c.Resync, c.Namespace, func(opts *metav1.ListOptions) {
+		opts.LabelSelector = k8sclient.LabelManaged + "=true"
+	})
+	enqueue := func(obj interface{}) {
+		if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+			queue.Add(key)
+		}
+	}
+	// Pod and policy changes are reported against the owning sandbox
+	enqueueOwner := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		o, ok := obj.(metav1.Object)
+		if !ok {
+			return
+		}
+		if ref := metav1.GetControllerOf(o); ref != nil && ref.Kind == Kind {
+			queue.Add(o.GetNamespace() + "/" + ref.Name)
+		}
+	}
+
+	handlers := []struct {
+		informer cache.SharedIndexInformer
+		handler  func(interface{})
+	}{
+		{factory.ForResource(SandboxGVR).Informer(), enqueue},
+		{owned.ForResource(podGVR).Informer(), enqueueOwner},
+		{owned.ForResource(networkPolicyGVR).Informer(), enqueueOwner},
+	}
+	for _, h := range handlers {
+		_, err := h.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.handler,
+			UpdateFunc: func(_, obj interface{}) { h.handler(obj) },
+			DeleteFunc: h.handler,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range []dynamicinformer.DynamicSharedInformerFactory{factory, owned} {
+		f.Start(ctx.Done())
+		for gvr, synced := range f.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return fmt.Errorf("failed to sync %s cache", gvr.Resource)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNext(ctx, queue) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+// processNext reconciles one queued sandbox, returning false once the queue
+// shuts down
+func (c *Controller) processNext(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string]) bool {
+	key, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(key)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		queue.Forget(key)
+		return true
+	}
+
+	result, err := c.Reconciler.Reconcile(ctx, namespace, name)
+	if err != nil {
+		log.Printf("Failed to reconcile sandbox %s: %v", key, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+
+	queue.Forget(key)
+	if result.RequeueAfter > 0 {
+		queue.AddAfter(key, result.RequeueAfter)
+	}
+	return true
+}
@@ -0,0 +1,435 @@
+package operator
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/config"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+//go:embed crd.yaml
+var crd []byte
+
+// CRD returns the CustomResourceDefinition manifest for Sandbox
+func CRD() []byte {
+	return crd
+}
+
+var (
+	podGVR           = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	networkPolicyGVR = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+)
+
+// Reconciler drives a Sandbox resource towards its spec. Every cluster call
+// goes through the dynamic client, so a fake one is enough to test it.
+type Reconciler struct {
+	Client dynamic.Interface
+	// Config supplies the cache volumes mounted into sandboxes; may be nil
+	Config *config.Config
+	// Provision installs a template's packages and runs its setup commands
+	// once the sandbox pod is running. It runs in the background, once per
+	// pod. Templates are not provisioned when nil.
+	Provision func(ctx context.Context, sandbox *Sandbox, tpl templates.Template) error
+	// Requeue asks for a sandbox to be reconciled again once its provisioning
+	// finishes; the controller sets it
+	Requeue func(namespace, name string)
+	// Now is the clock, time.Now when nil
+	Now func() time.Time
+
+	mu   sync.Mutex
+	runs map[string]*provisionRun
+}
+
+// provisionRun is a template being applied to one pod
+type provisionRun struct {
+	pod  types.UID
+	done bool
+	err  error
+}
+
+// Result tells the caller when to reconcile the sandbox again
+type Result struct {
+	// RequeueAfter is non-zero while a TTL is running
+	RequeueAfter time.Duration
+}
+
+func (r *Reconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// Reconcile brings the named sandbox's pod, network policy and status in line
+// with its spec, and deletes it once its TTL has run out
+func (r *Reconciler) Reconcile(ctx context.Context, namespace, name string) (Result, error) {
+	u, err := r.Client.Resource(SandboxGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Owned pods and policies are garbage collected with the sandbox
+		return Result{}, nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if u.GetDeletionTimestamp() != nil {
+		return Result{}, nil
+	}
+
+	sandbox, err := FromUnstructured(u)
+	if err != nil {
+		return Result{}, err
+	}
+	status := sandbox.Status
+	status.Conditions = append([]metav1.Condition(nil), sandbox.Status.Conditions...)
+	status.PodName = PodName(sandbox.Name)
+
+	// Invalid specs are reported rather than retried
+	spec, tpl, err := r.podSpec(sandbox)
+	if err != nil {
+		r.setFailed(&status, "InvalidSpec", err.Error())
+		return Result{}, r.updateStatus(ctx, u, sandbox.Status, status)
+	}
+
+	var result Result
+	ttl, _ := sandbox.Spec.ttl()
+	if ttl > 0 {
+		expiresAt := sandbox.CreationTimestamp.Add(ttl)
+		if !r.now().Before(expiresAt) {
+			err := r.Client.Resource(SandboxGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return Result{}, fmt.Errorf("failed to delete expired sandbox %s: %v", name, err)
+			}
+			return Result{}, nil
+		}
+		status.ExpiresAt = &metav1.Time{Time: expiresAt}
+		result.RequeueAfter = expiresAt.Sub(r.now())
+	} else {
+		status.ExpiresAt = nil
+	}
+
+	if err := r.reconcileNetworkPolicy(ctx, sandbox); err != nil {
+		return Result{}, err
+	}
+
+	pod, err := r.reconcilePod(ctx, sandbox, spec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch {
+	case pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed:
+		r.setFailed(&status, "PodTerminated", fmt.Sprintf("pod %s is %s", pod.Name, pod.Status.Phase))
+	case !podReady(pod):
+		status.Phase = PhasePending
+		r.setCondition(&status, ConditionReady, metav1.ConditionFalse, "PodStarting", "waiting for pod "+pod.Name)
+	default:
+		if tpl != nil && r.Provision != nil && status.ProvisionedPod != string(pod.UID) {
+			done, err := r.provision(ctx, sandbox, *tpl, pod.UID)
+			if !done {
+				status.Phase = PhasePending
+				r.setCondition(&status, ConditionProvisioned, metav1.ConditionFalse, "Provisioning", "applying template "+tpl.Name)
+				r.setCondition(&status, ConditionReady, metav1.ConditionFalse, "Provisioning", "applying template "+tpl.Name+" to pod "+pod.Name)
+				return result, r.updateStatus(ctx, u, sandbox.Status, status)
+			}
+			status.ProvisionedPod = string(pod.UID)
+			if err != nil {
+				r.setCondition(&status, ConditionProvisioned, metav1.ConditionFalse, "ProvisioningFailed", err.Error())
+			} else {
+				r.setCondition(&status, ConditionProvisioned, metav1.ConditionTrue, "Provisioned", "template "+tpl.Name+" applied")
+			}
+		}
+		// A pod the template failed on stays failed; deleting it retries
+		if c := meta.FindStatusCondition(status.Conditions, ConditionProvisioned); tpl != nil && c != nil && c.Reason == "ProvisioningFailed" {
+			r.setFailed(&status, "ProvisioningFailed", c.Message)
+			break
+		}
+		status.Phase = PhaseReady
+		r.setCondition(&status, ConditionReady, metav1.ConditionTrue, "PodReady", "pod "+pod.Name+" is ready")
+	}
+
+	return result, r.updateStatus(ctx, u, sandbox.Status, status)
+}
+
+// provision applies tpl to the sandbox's pod in the background, so package
+// installs do not hold up a reconcile worker. It reports whether the run for
+// the pod has finished, and with what error.
+func (r *Reconciler) provision(ctx context.Context, sandbox *Sandbox, tpl templates.Template, pod types.UID) (bool, error) {
+	key := sandbox.Namespace + "/" + sandbox.Name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run, ok := r.runs[key]; ok && run.pod == pod {
+		if !run.done {
+			return false, nil
+		}
+		delete(r.runs, key)
+		return true, run.err
+	}
+
+	// A run for a replaced pod is abandoned
+	if r.runs == nil {
+		r.runs = make(map[string]*provisionRun)
+	}
+	run := &provisionRun{pod: pod}
+	r.runs[key] = run
+	go func() {
+		err := r.Provision(ctx, sandbox, tpl)
+		r.mu.Lock()
+		run.done, run.err = true, err
+		r.mu.Unlock()
+		if r.Requeue != nil {
+			r.Requeue(sandbox.Namespace, sandbox.Name)
+		}
+	}()
+	return false, nil
+}
+
+// podSpec resolves the sandbox's template and language into a pod spec
+func (r *Reconciler) podSpec(sandbox *Sandbox) (k8sclient.PodSpec, *templates.Template, error) {
+	s := sandbox.Spec
+	if err := s.Validate(); err != nil {
+		return k8sclient.PodSpec{}, nil, err
+	}
+
+	var tpl *templates.Template
+	lang := s.Language
+	if s.Template != "" {
+		t, err := templates.TemplateLookup(s.Template)
+		if err != nil {
+			return k8sclient.PodSpec{}, nil, err
+		}
+		if lang != "" && lang != t.Language {
+			return k8sclient.PodSpec{}, nil, fmt.Errorf("template %s is for %s, not %s", t.Name, t.Language, lang)
+		}
+		lang = t.Language
+		tpl = &t
+	}
+
+	image, err := templates.LanguageLookup(lang)
+	if err != nil {
+		return k8sclient.PodSpec{}, nil, err
+	}
+	volumes, err := r.Config.CacheVolumes(lang)
+	if err != nil {
+		return k8sclient.PodSpec{}, nil, err
+	}
+
+	spec := k8sclient.PodSpec{
+		Name:      PodName(sandbox.Name),
+		Namespace: sandbox.Namespace,
+		Image:     image,
+		Command:   []string{"sh", "-c", "tail -f /dev/null"},
+		Labels:    make(map[string]string, len(sandbox.Labels)+3),
+		Env:       s.Env,
+		Secrets:   s.Secrets,
+		Volumes:   volumes,
+	}
+	// The sandbox's own labels carry over, except reserved ones
+	for k, v := range sandbox.Labels {
+		if !strings.HasPrefix(k, "sandboxed.io/") {
+			spec.Labels[k] = v
+		}
+	}
+	spec.Labels[k8sclient.LabelManaged] = "true"
+	spec.Labels[k8sclient.LabelName] = sandbox.Name
+	spec.Labels[k8sclient.LabelLanguage] = lang
+
+	if tpl != nil {
+		tpl.Apply(&spec)
+	}
+	if s.Image != "" {
+		spec.Image = s.Image
+	}
+	if len(s.Resources.Requests) > 0 || len(s.Resources.Limits) > 0 {
+		spec.Resources = s.Resources
+	}
+	spec.RuntimeClassName = s.RuntimeClassName
+
+	return spec, tpl, nil
+}
+
+// reconcilePod returns the sandbox's pod, creating it when missing. A running
+// pod is left alone: spec changes apply to the next pod.
+func (r *Reconciler) reconcilePod(ctx context.Context, sandbox *Sandbox, spec k8sclient.PodSpec) (*corev1.Pod, error) {
+	pods := r.Client.Resource(podGVR).Namespace(sandbox.Namespace)
+
+	u, err := pods.Get(ctx, spec.Name, metav1.GetOptions{})
+	if err == nil {
+		var pod corev1.Pod
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &pod); err != nil {
+			return nil, err
+		}
+		if !metav1.IsControlledBy(&pod, sandbox) {
+			return nil, fmt.Errorf("pod %s exists and is not owned by sandbox %s", pod.Name, sandbox.Name)
+		}
+		return &pod, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	pod, err := k8sclient.BuildPod(spec)
+	if err != nil {
+		return nil, err
+	}
+	pod.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+	pod.OwnerReferences = []metav1.OwnerReference{ownerReference(sandbox)}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pods.Create(ctx, &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create pod for sandbox %s: %v", sandbox.Name, err)
+	}
+	return pod, nil
+}
+
+// reconcileNetworkPolicy creates, replaces or removes the sandbox's policy
+func (r *Reconciler) reconcileNetworkPolicy(ctx context.Context, sandbox *Sandbox) error {
+	policies := r.Client.Resource(networkPolicyGVR).Namespace(sandbox.Namespace)
+	name := PodName(sandbox.Name)
+
+	existing, err := policies.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if sandbox.Spec.Network == "" {
+		if found {
+			err := policies.Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to remove network policy %s: %v", name, err)
+			}
+		}
+		return nil
+	}
+
+	policy := networkPolicy(sandbox)
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(policy)
+	if err != nil {
+		return err
+	}
+	desired := &unstructured.Unstructured{Object: obj}
+
+	if !found {
+		if _, err := policies.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create network policy %s: %v", name, err)
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	desired.SetResourceVersion(existing.GetResourceVersion())
+	if _, err := policies.Update(ctx, desired, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update network policy %s: %v", name, err)
+	}
+	return nil
+}
+
+// networkPolicy denies all ingress to the sandbox pod, and all egress too
+// when the sandbox is isolated
+func networkPolicy(sandbox *Sandbox) *networkingv1.NetworkPolicy {
+	types := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if sandbox.Spec.Network == NetworkIsolated {
+		types = append(types, networkingv1.PolicyTypeEgress)
+	}
+
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            PodName(sandbox.Name),
+			Namespace:       sandbox.Namespace,
+			Labels:          map[string]string{k8sclient.LabelManaged: "true", k8sclient.LabelName: sandbox.Name},
+			OwnerReferences: []metav1.OwnerReference{ownerReference(sandbox)},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{
+				k8sclient.LabelManaged: "true",
+				k8sclient.LabelName:    sandbox.Name,
+			}},
+			PolicyTypes: types,
+		},
+	}
+}
+
+// ownerReference makes the sandbox the controller of an object, so the
+// object is garbage collected with it
+func ownerReference(sandbox *Sandbox) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion:         Group + "/" + Version,
+		Kind:               Kind,
+		Name:               sandbox.Name,
+		UID:                sandbox.UID,
+		Controller:         &controller,
+		BlockOwnerDeletion: &controller,
+	}
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (r *Reconciler) setCondition(status *SandboxStatus, condition string, value metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               condition,
+		Status:             value,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.NewTime(r.now()),
+	})
+}
+
+func (r *Reconciler) setFailed(status *SandboxStatus, reason, message string) {
+	status.Phase = PhaseFailed
+	r.setCondition(status, ConditionReady, metav1.ConditionFalse, reason, message)
+}
+
+// updateStatus writes the status subresource when it changed
+func (r *Reconciler) updateStatus(ctx context.Context, u *unstructured.Unstructured, old, status SandboxStatus) error {
+	if reflect.DeepEqual(old, status) {
+		return nil
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	u = u.DeepCopy()
+	u.Object["status"] = obj
+
+	_, err = r.Client.Resource(SandboxGVR).Namespace(u.GetNamespace()).UpdateStatus(ctx, u, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update status of sandbox %s: %v", u.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newFakeClient(t *testing.T, objects ...interface{}) *dynamicfake.FakeDynamicClient {
+	t.Helper()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		SandboxGVR:       "SandboxList",
+		podGVR:           "PodList",
+		networkPolicyGVR: "NetworkPolicyList",
+	})
+
+	// Objects are added by resource, since the tracker would guess the
+	// plural of Sandbox as "sandboxs"
+	for _, obj := range objects {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gvr := podGVR
+		if _, ok := obj.(*Sandbox); ok {
+			gvr = SandboxGVR
+		}
+		o := &unstructured.Unstructured{Object: u}
+		if err := client.Tracker().Create(gvr, o, o.GetNamespace()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client
+}
+
+func newSandbox(name string, spec SandboxSpec) *Sandbox {
+	sandbox := New(name, "sandboxes", spec)
+	sandbox.UID = types.UID("uid-" + sandbox.Name)
+	sandbox.CreationTimestamp = metav1.NewTime(now.Add(-10 * time.Minute))
+	return sandbox
+}
+
+func getSandbox(t *testing.T, client *dynamicfake.FakeDynamicClient, name string) *Sandbox {
+	t.Helper()
+	sandbox, err := Get(context.Background(), client, "sandboxes", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sandbox
+}
+
+func getObject(t *testing.T, client *dynamicfake.FakeDynamicClient, gvr schema.GroupVersionResource, name string, into interface{}) error {
+	t.Helper()
+	u, err := client.Resource(gvr).Namespace("sandboxes").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, into)
+}
+
+// runningPod returns a ready pod owned by sandbox
+func runningPod(sandbox *Sandbox) *corev1.Pod {
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            PodName(sandbox.Name),
+			Namespace:       sandbox.Namespace,
+			Labels:          map[string]string{k8sclient.LabelManaged: "true"},
+			OwnerReferences: []metav1.OwnerReference{ownerReference(sandbox)},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func TestReconcileCreatesPodAndPolicy(t *testing.T) {
+	sandbox := newSandbox("analysis", SandboxSpec{Language: "python", TTL: "1h", Network: NetworkIsolated, Env: map[string]string{"MODE": "test"}})
+	sandbox.Labels = map[string]string{"team": "ml", "sandboxed.io/name": "spoofed"}
+	client := newFakeClient(t, sandbox)
+	r := &Reconciler{Client: client, Now: func() time.Time { return now }}
+
+	result, err := r.Reconcile(context.Background(), "sandboxes", "analysis")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter != 50*time.Minute {
+		t.Errorf("expected a requeue when the TTL runs out, got %s", result.RequeueAfter)
+	}
+
+	var pod corev1.Pod
+	if err := getObject(t, client, podGVR, "sandboxed-analysis", &pod); err != nil {
+		t.Fatalf("expected a pod: %v", err)
+	}
+	if !metav1.IsControlledBy(&pod, sandbox) {
+		t.Error("expected the pod to be owned by the sandbox")
+	}
+	if pod.Labels["team"] != "ml" || pod.Labels[k8sclient.LabelName] != "analysis" || pod.Labels[k8sclient.LabelLanguage] != "python" {
+		t.Errorf("unexpected pod labels %v", pod.Labels)
+	}
+	if pod.Spec.Containers[0].Image != "python:3.9" {
+		t.Errorf("expected the language image, got %s", pod.Spec.Containers[0].Image)
+	}
+	if env := pod.Spec.Containers[0].Env; len(env) != 1 || env[0].Name != "MODE" {
+		t.Errorf("unexpected env %v", env)
+	}
+
+	var policy networkingv1.NetworkPolicy
+	if err := getObject(t, client, networkPolicyGVR, "sandboxed-analysis", &policy); err != nil {
+		t.Fatalf("expected a network policy: %v", err)
+	}
+	if len(policy.Spec.PolicyTypes) != 2 || len(policy.Spec.Ingress) != 0 || len(policy.Spec.Egress) != 0 {
+		t.Errorf("expected all traffic to be denied, got %+v", policy.Spec)
+	}
+	if policy.Spec.PodSelector.MatchLabels[k8sclient.LabelName] != "analysis" {
+		t.Errorf("unexpected pod selector %v", policy.Spec.PodSelector)
+	}
+
+	got := getSandbox(t, client, "analysis")
+	if got.Status.Phase != PhasePending || got.Status.PodName != "sandboxed-analysis" {
+		t.Errorf("unexpected status %+v", got.Status)
+	}
+	if got.Status.ExpiresAt == nil || !got.Status.ExpiresAt.Time.Equal(now.Add(50*time.Minute)) {
+		t.Errorf("unexpected expiry %v", got.Status.ExpiresAt)
+	}
+}
+
+// waitRequeue waits for background provisioning to ask for a requeue
+func waitRequeue(t *testing.T, requeued <-chan string) {
+	t.Helper()
+	select {
+	case <-requeued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for provisioning to finish")
+	}
+}
+
+func TestReconcileProvisionsTemplateOnce(t *testing.T) {
+	if err := templates.RegisterTemplate(templates.Template{Name: "operator-ml", Language: "python", Packages: []string{"pandas"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := newSandbox("ml", SandboxSpec{Template: "operator-ml"})
+	pod := runningPod(sandbox)
+	pod.UID = "pod-1"
+	client := newFakeClient(t, sandbox, pod)
+
+	var calls atomic.Int32
+	requeued := make(chan string, 1)
+	r := &Reconciler{Client: client, Now: func() time.Time { return now }, Provision: func(ctx context.Context, s *Sandbox, tpl templates.Template) error {
+		calls.Add(1)
+		if s.Name != "ml" || tpl.Name != "operator-ml" {
+			t.Errorf("unexpected provisioning of %s with %s", s.Name, tpl.Name)
+		}
+		return nil
+	}, Requeue: func(_, name string) { requeued <- name }}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "ml"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	got := getSandbox(t, client, "ml")
+	if c := meta.FindStatusCondition(got.Status.Conditions, ConditionProvisioned); got.Status.Phase != PhasePending || c == nil || c.Reason != "Provisioning" {
+		t.Errorf("expected the sandbox to be provisioning, got %+v", got.Status)
+	}
+	waitRequeue(t, requeued)
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), "sandboxes", "ml"); err != nil {
+			t.Fatalf("reconcile failed: %v", err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the template to be provisioned once, got %d", calls.Load())
+	}
+
+	got = getSandbox(t, client, "ml")
+	if got.Status.Phase != PhaseReady || got.Status.ProvisionedPod != "pod-1" {
+		t.Errorf("expected the sandbox to be ready, got %+v", got.Status)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, ConditionReady) || !meta.IsStatusConditionTrue(got.Status.Conditions, ConditionProvisioned) {
+		t.Errorf("unexpected conditions %+v", got.Status.Conditions)
+	}
+}
+
+func TestReconcileProvisionsRecreatedPod(t *testing.T) {
+	if err := templates.RegisterTemplate(templates.Template{Name: "operator-recreated", Language: "python", Packages: []string{"pandas"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := newSandbox("recreated", SandboxSpec{Template: "operator-recreated"})
+	sandbox.Status.ProvisionedPod = "pod-1"
+	sandbox.Status.Conditions = []metav1.Condition{{Type: ConditionProvisioned, Status: metav1.ConditionTrue, Reason: "Provisioned"}}
+	pod := runningPod(sandbox)
+	pod.UID = "pod-2"
+	client := newFakeClient(t, sandbox, pod)
+
+	var calls atomic.Int32
+	requeued := make(chan string, 1)
+	r := &Reconciler{Client: client, Provision: func(context.Context, *Sandbox, templates.Template) error {
+		calls.Add(1)
+		return nil
+	}, Requeue: func(_, name string) { requeued <- name }}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "recreated"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	waitRequeue(t, requeued)
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "recreated"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	got := getSandbox(t, client, "recreated")
+	if calls.Load() != 1 || got.Status.ProvisionedPod != "pod-2" || got.Status.Phase != PhaseReady {
+		t.Errorf("expected the new pod to be provisioned, got %d call(s) and %+v", calls.Load(), got.Status)
+	}
+}
+
+func TestReconcileProvisioningFailure(t *testing.T) {
+	if err := templates.RegisterTemplate(templates.Template{Name: "operator-broken", Language: "python", Setup: []string{"false"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := newSandbox("broken", SandboxSpec{Template: "operator-broken"})
+	pod := runningPod(sandbox)
+	pod.UID = "pod-1"
+	client := newFakeClient(t, sandbox, pod)
+	var calls atomic.Int32
+	requeued := make(chan string, 1)
+	r := &Reconciler{Client: client, Provision: func(context.Context, *Sandbox, templates.Template) error {
+		calls.Add(1)
+		return errors.New("setup command failed")
+	}, Requeue: func(_, name string) { requeued <- name }}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "broken"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	waitRequeue(t, requeued)
+
+	// The failure sticks to the pod rather than being retried every reconcile
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), "sandboxes", "broken"); err != nil {
+			t.Fatalf("reconcile failed: %v", err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected one provisioning attempt, got %d", calls.Load())
+	}
+
+	got := getSandbox(t, client, "broken")
+	c := meta.FindStatusCondition(got.Status.Conditions, ConditionReady)
+	if got.Status.Phase != PhaseFailed || c == nil || c.Reason != "ProvisioningFailed" {
+		t.Errorf("expected a provisioning failure, got %+v", got.Status)
+	}
+}
+
+func TestReconcileDeletesExpiredSandbox(t *testing.T) {
+	sandbox := newSandbox("old", SandboxSpec{Language: "python", TTL: "5m"})
+	client := newFakeClient(t, sandbox)
+	r := &Reconciler{Client: client, Now: func() time.Time { return now }}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "old"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if _, err := Get(context.Background(), client, "sandboxes", "old"); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the expired sandbox to be deleted, got %v", err)
+	}
+}
+
+func TestReconcileReportsInvalidSpec(t *testing.T) {
+	sandbox := newSandbox("bad", SandboxSpec{Language: "python", Network: "open"})
+	client := newFakeClient(t, sandbox)
+	r := &Reconciler{Client: client}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "bad"); err != nil {
+		t.Fatalf("expected an invalid spec to be reported, not retried: %v", err)
+	}
+
+	got := getSandbox(t, client, "bad")
+	c := meta.FindStatusCondition(got.Status.Conditions, ConditionReady)
+	if got.Status.Phase != PhaseFailed || c == nil || c.Reason != "InvalidSpec" {
+		t.Errorf("unexpected status %+v", got.Status)
+	}
+	var pod corev1.Pod
+	if err := getObject(t, client, podGVR, "sandboxed-bad", &pod); !apierrors.IsNotFound(err) {
+		t.Errorf("expected no pod for an invalid sandbox, got %v", err)
+	}
+}
+
+func TestReconcileRemovesPolicyWhenNetworkCleared(t *testing.T) {
+	sandbox := newSandbox("open", SandboxSpec{Language: "python", Network: NetworkEgress})
+	client := newFakeClient(t, sandbox)
+	r := &Reconciler{Client: client}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "open"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	var policy networkingv1.NetworkPolicy
+	if err := getObject(t, client, networkPolicyGVR, "sandboxed-open", &policy); err != nil {
+		t.Fatalf("expected a network policy: %v", err)
+	}
+	if len(policy.Spec.PolicyTypes) != 1 || policy.Spec.PolicyTypes[0] != networkingv1.PolicyTypeIngress {
+		t.Errorf("expected only ingress to be denied, got %v", policy.Spec.PolicyTypes)
+	}
+
+	u, err := client.Resource(SandboxGVR).Namespace("sandboxes").Get(context.Background(), "open", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstructured.RemoveNestedField(u.Object, "spec", "network")
+	if _, err := client.Resource(SandboxGVR).Namespace("sandboxes").Update(context.Background(), u, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "open"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if err := getObject(t, client, networkPolicyGVR, "sandboxed-open", &policy); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the policy to be removed, got %v", err)
+	}
+}
+
+func TestReconcileRefusesForeignPod(t *testing.T) {
+	sandbox := newSandbox("taken", SandboxSpec{Language: "python"})
+	foreign := runningPod(sandbox)
+	foreign.OwnerReferences = nil
+	client := newFakeClient(t, sandbox, foreign)
+	r := &Reconciler{Client: client}
+
+	if _, err := r.Reconcile(context.Background(), "sandboxes", "taken"); err == nil {
+		t.Fatal("expected a pod the sandbox does not own to be left alone")
+	}
+}
+
+func TestDestroyPodDeletesOwningSandbox(t *testing.T) {
+	sandbox := newSandbox("owned", SandboxSpec{Language: "python"})
+	pod := runningPod(sandbox)
+	plain := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-plain", Namespace: "sandboxes"}}
+
+	dyn := newFakeClient(t, sandbox)
+	client := k8sclient.NewClientFromClientset(fake.NewSimpleClientset(pod, plain), nil, "sandboxes")
+	client.SetDynamic(dyn)
+
+	if err := DestroyPod(context.Background(), client, pod.Name, "sandboxes", false); err != nil {
+		t.Fatalf("destroy failed: %v", err)
+	}
+	if _, err := Get(context.Background(), dyn, "sandboxes", "owned"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the owning sandbox to be deleted, got %v", err)
+	}
+
+	if err := DestroyPod(context.Background(), client, plain.Name, "sandboxes", false); err != nil {
+		t.Fatalf("destroy failed: %v", err)
+	}
+	if _, err := client.GetPod(plain.Name, "sandboxes"); err == nil {
+		t.Error("expected a pod without a sandbox resource to be deleted directly")
+	}
+}
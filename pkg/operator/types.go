@@ -0,0 +1,163 @@
+// Package operator declares sandboxes as Sandbox custom resources and
+// reconciles them into pods, network policies and TTL-based cleanup
+package operator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// API group, version and kind of the Sandbox custom resource
+const (
+	Group   = "sandboxed.io"
+	Version = "v1alpha1"
+	Kind    = "Sandbox"
+)
+
+// SandboxGVR identifies the Sandbox resource for dynamic clients
+var SandboxGVR = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "sandboxes"}
+
+// Phases reported in SandboxStatus.Phase
+const (
+	PhasePending = "Pending"
+	PhaseReady   = "Ready"
+	PhaseFailed  = "Failed"
+)
+
+// Condition types reported in SandboxStatus.Conditions
+const (
+	// ConditionReady is true once the pod runs and the template is provisioned
+	ConditionReady = "Ready"
+	// ConditionProvisioned is true once the template's packages are
+	// installed and its setup commands have run
+	ConditionProvisioned = "Provisioned"
+)
+
+// NetworkMode restricts a sandbox's network traffic with a NetworkPolicy
+type NetworkMode string
+
+// Network modes. Without a mode no NetworkPolicy is created.
+const (
+	// NetworkIsolated blocks all ingress and egress traffic
+	NetworkIsolated NetworkMode = "isolated"
+	// NetworkEgress blocks ingress traffic and allows egress
+	NetworkEgress NetworkMode = "egress"
+)
+
+// Sandbox is a declaratively managed sandbox
+type Sandbox struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SandboxSpec   `json:"spec"`
+	Status SandboxStatus `json:"status,omitempty"`
+}
+
+// SandboxSpec is the desired state of a sandbox
+type SandboxSpec struct {
+	// Language selects the image; it may be omitted when Template is set
+	Language string `json:"language,omitempty"`
+	// Template names an environment template registered with the operator
+	Template string `json:"template,omitempty"`
+	// Image replaces the language's or template's image
+	Image            string                `json:"image,omitempty"`
+	Resources        k8sclient.Resources   `json:"resources,omitempty"`
+	Env              map[string]string     `json:"env,omitempty"`
+	Secrets          []k8sclient.SecretRef `json:"secrets,omitempty"`
+	RuntimeClassName string                `json:"runtimeClassName,omitempty"`
+	// TTL is a Go duration after which the sandbox is deleted, counted from
+	// its creation; it lives until deleted when empty
+	TTL string `json:"ttl,omitempty"`
+	// Network is isolated or egress; traffic is unrestricted when empty
+	Network NetworkMode `json:"network,omitempty"`
+}
+
+// SandboxStatus is the observed state of a sandbox
+type SandboxStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	PodName string `json:"podName,omitempty"`
+	// ExpiresAt is when the TTL runs out
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ProvisionedPod is the UID of the pod the template was last applied to,
+	// so a recreated pod is provisioned again
+	ProvisionedPod string             `json:"provisionedPod,omitempty"`
+	Conditions     []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Validate checks the spec can be reconciled. Template and language lookups
+// happen during reconciliation, against the operator's registry.
+func (s SandboxSpec) Validate() error {
+	if s.Language == "" && s.Template == "" {
+		return errors.New("language or template is required")
+	}
+	if _, err := s.ttl(); err != nil {
+		return err
+	}
+	switch s.Network {
+	case "", NetworkIsolated, NetworkEgress:
+	default:
+		return fmt.Errorf("unknown network mode %q (expected %s or %s)", s.Network, NetworkIsolated, NetworkEgress)
+	}
+	if err := k8sclient.ValidateEnv(s.Env); err != nil {
+		return err
+	}
+	for _, ref := range s.Secrets {
+		if err := ref.Validate(); err != nil {
+			return err
+		}
+	}
+	return s.Resources.Validate()
+}
+
+func (s SandboxSpec) ttl() (time.Duration, error) {
+	if s.TTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(s.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl %q: %v", s.TTL, err)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl must be positive, got %s", s.TTL)
+	}
+	return ttl, nil
+}
+
+// PodName is the name of the pod backing a sandbox, matching the SDK's naming
+func PodName(sandbox string) string {
+	return "sandboxed-" + sandbox
+}
+
+// New returns a Sandbox resource ready to be created
+func New(name, namespace string, spec SandboxSpec) *Sandbox {
+	return &Sandbox{
+		TypeMeta:   metav1.TypeMeta{APIVersion: Group + "/" + Version, Kind: Kind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       spec,
+	}
+}
+
+// FromUnstructured converts a dynamic client object to a Sandbox
+func FromUnstructured(u *unstructured.Unstructured) (*Sandbox, error) {
+	var sandbox Sandbox
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &sandbox); err != nil {
+		return nil, fmt.Errorf("invalid sandbox %s: %v", u.GetName(), err)
+	}
+	return &sandbox, nil
+}
+
+// ToUnstructured converts a Sandbox for the dynamic client
+func (s *Sandbox) ToUnstructured() (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(s)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var sandboxesBucket = []byte("sandboxes")
+
+// Bolt is a registry persisted in an embedded BoltDB file
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBolt opens (creating if needed) a BoltDB registry at path
+func NewBolt(path string) (*Bolt, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sandboxesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise registry %s: %v", path, err)
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+// Put creates or replaces the record for rec.Name
+func (b *Bolt) Put(rec Record) error {
+	if err := validate(rec); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sandboxesBucket)
+
+		var existing *Record
+		if data := bucket.Get([]byte(rec.Name)); data != nil {
+			var old Record
+			if err := json.Unmarshal(data, &old); err == nil {
+				existing = &old
+			}
+		}
+
+		data, err := json.Marshal(stamp(rec, existing))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(rec.Name), data)
+	})
+}
+
+// Get returns the record for name
+func (b *Bolt) Get(name string) (Record, error) {
+	var rec Record
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sandboxesBucket).Get([]byte(name))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &rec)
+	})
+	return rec, err
+}
+
+// Delete removes the record for name
+func (b *Bolt) Delete(name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sandboxesBucket).Delete([]byte(name))
+	})
+}
+
+// List returns every record, sorted by name
+func (b *Bolt) List() ([]Record, error) {
+	records := []Record{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sandboxesBucket).ForEach(func(k, v []byte) error {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("corrupt registry record %q: %v", k, err)
+			}
+			records = append(records, rec)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Close closes the underlying database file
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Kubernetes is a registry backed by the sandbox pods themselves. Records are
+// stored as labels and annotations on each pod, so they survive any process
+// restart and disappear together with the pod.
+type Kubernetes struct {
+	client    *k8sclient.Client
+	namespace string
+}
+
+// NewKubernetes creates a registry that discovers sandboxes by label across
+// all namespaces. Records without a namespace are stored in namespace.
+func NewKubernetes(client *k8sclient.Client, namespace string) *Kubernetes {
+	return &Kubernetes{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// Put labels and annotates the pod named rec.ID with the record
+func (k *Kubernetes) Put(rec Record) error {
+	if err := validate(rec); err != nil {
+		return err
+	}
+	if rec.Namespace == "" {
+		rec.Namespace = k.namespace
+	}
+
+	var existing *Record
+	if old, err := k.Get(rec.Name); err == nil {
+		existing = &old
+	}
+	rec = stamp(rec, existing)
+
+	labels := map[string]string{
+		k8sclient.LabelManaged:  "true",
+		k8sclient.LabelName:     rec.Name,
+		k8sclient.LabelLanguage: rec.Language,
+	}
+	annotations := map[string]string{
+		k8sclient.AnnotationOwner:     rec.Owner,
+		k8sclient.AnnotationCreatedAt: rec.CreatedAt.Format(time.RFC3339),
+		k8sclient.AnnotationUpdatedAt: rec.UpdatedAt.Format(time.RFC3339),
+	}
+
+	return k.client.PatchPodMetadata(rec.ID, rec.Namespace, labels, annotations)
+}
+
+// Get returns the record for the pod labelled with name, in any namespace
+func (k *Kubernetes) Get(name string) (Record, error) {
+	pods, err := k.client.ListPodsInAllNamespaces(fmt.Sprintf("%s=true,%s=%s", k8sclient.LabelManaged, k8sclient.LabelName, name))
+	if err != nil {
+		return Record{}, err
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			return recordFromPod(&pod), nil
+		}
+	}
+	return Record{}, ErrNotFound
+}
+
+// Delete is a no-op: a record is removed when its pod is deleted
+func (k *Kubernetes) Delete(name string) error {
+	return nil
+}
+
+// List returns a record for every live sandbox pod in any namespace, sorted by name
+func (k *Kubernetes) List() ([]Record, error) {
+	pods, err := k.client.ListPodsInAllNamespaces(k8sclient.LabelManaged + "=true")
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(pods.Items))
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Labels[k8sclient.LabelName] == "" {
+			continue
+		}
+		records = append(records, recordFromPod(pod))
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records, nil
+}
+
+// Close is a no-op for the Kubernetes registry
+func (k *Kubernetes) Close() error {
+	return nil
+}
+
+func recordFromPod(pod *corev1.Pod) Record {
+	rec := Record{
+		Name:      pod.Labels[k8sclient.LabelName],
+		ID:        pod.Name,
+		Language:  pod.Labels[k8sclient.LabelLanguage],
+		Namespace: pod.Namespace,
+		Owner:     pod.Annotations[k8sclient.AnnotationOwner],
+		CreatedAt: pod.CreationTimestamp.Time,
+	}
+	if t, err := time.Parse(time.RFC3339, pod.Annotations[k8sclient.AnnotationCreatedAt]); err == nil {
+		rec.CreatedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, pod.Annotations[k8sclient.AnnotationUpdatedAt]); err == nil {
+		rec.UpdatedAt = t
+	}
+	return rec
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory is a registry that lives only as long as the process
+type Memory struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+// NewMemory creates an empty in-memory registry
+func NewMemory() *Memory {
+	return &Memory{
+		records: make(map[string]Record),
+	}
+}
+
+// Put creates or replaces the record for rec.Name
+func (m *Memory) Put(rec Record) error {
+	if err := validate(rec); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var existing *Record
+	if old, ok := m.records[rec.Name]; ok {
+		existing = &old
+	}
+	m.records[rec.Name] = stamp(rec, existing)
+	return nil
+}
+
+// Get returns the record for name
+func (m *Memory) Get(name string) (Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rec, ok := m.records[name]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Delete removes the record for name
+func (m *Memory) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, name)
+	return nil
+}
+
+// List returns every record, sorted by name
+func (m *Memory) List() ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([]Record, 0, len(m.records))
+	for _, rec := range m.records {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records, nil
+}
+
+// Close is a no-op for the in-memory registry
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when no record exists for a sandbox name
+var ErrNotFound = errors.New("sandbox not found in registry")
+
+// Record describes a sandbox well enough to reattach to it from another process
+type Record struct {
+	Name      string    `json:"name"`
+	ID        string    `json:"id"`
+	Language  string    `json:"language"`
+	Namespace string    `json:"namespace"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Registry stores sandbox records by name
+type Registry interface {
+	// Put creates or replaces the record for rec.Name
+	Put(rec Record) error
+	// Get returns the record for name, or ErrNotFound
+	Get(name string) (Record, error)
+	// Delete removes the record for name. Deleting a missing record is not an error.
+	Delete(name string) error
+	// List returns every record
+	List() ([]Record, error)
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// stamp fills in the timestamps of a record being stored
+func stamp(rec Record, existing *Record) Record {
+	now := time.Now().UTC()
+	if existing != nil && rec.CreatedAt.IsZero() {
+		rec.CreatedAt = existing.CreatedAt
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	rec.UpdatedAt = now
+	return rec
+}
+
+func validate(rec Record) error {
+	if rec.Name == "" {
+		return errors.New("registry record requires a name")
+	}
+	if rec.ID == "" {
+		return fmt.Errorf("registry record %q requires an ID", rec.Name)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package registry_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func exerciseRegistry(t *testing.T, reg registry.Registry) {
+	t.Helper()
+
+	rec := registry.Record{
+		Name:      "scratch",
+		ID:        "sandboxed-scratch",
+		Language:  "python",
+		Namespace: "default",
+		Owner:     "alice",
+	}
+	if err := reg.Put(rec); err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+
+	got, err := reg.Get("scratch")
+	if err != nil {
+		t.Fatalf("failed to get record: %v", err)
+	}
+	if got.ID != rec.ID || got.Language != rec.Language || got.Owner != rec.Owner {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+		t.Fatalf("expected timestamps to be set: %+v", got)
+	}
+
+	// Updating keeps the original creation time
+	rec.Language = "go"
+	if err := reg.Put(rec); err != nil {
+		t.Fatalf("failed to update record: %v", err)
+	}
+	updated, _ := reg.Get("scratch")
+	if !updated.CreatedAt.Equal(got.CreatedAt) || updated.Language != "go" {
+		t.Fatalf("unexpected updated record: %+v", updated)
+	}
+
+	if err := reg.Put(registry.Record{Name: "missing-id"}); err == nil {
+		t.Fatal("expected a record without an ID to be rejected")
+	}
+
+	if err := reg.Delete("scratch"); err != nil {
+		t.Fatalf("failed to delete record: %v", err)
+	}
+	if _, err := reg.Get("scratch"); !errors.Is(err, registry.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	exerciseRegistry(t, registry.NewMemory())
+}
+
+func TestBoltRegistry(t *testing.T) {
+	reg, err := registry.NewBolt(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+	defer reg.Close()
+
+	exerciseRegistry(t, reg)
+}
+
+func TestBoltRegistrySurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.db")
+
+	reg, err := registry.NewBolt(path)
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+	if err := reg.Put(registry.Record{Name: "kept", ID: "sandboxed-kept", Language: "node"}); err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+	reg.Close()
+
+	reg, err = registry.NewBolt(path)
+	if err != nil {
+		t.Fatalf("failed to reopen registry: %v", err)
+	}
+	defer reg.Close()
+
+	records, err := reg.List()
+	if err != nil {
+		t.Fatalf("failed to list records: %v", err)
+	}
+	if len(records) != 1 || records[0].Name != "kept" || records[0].Language != "node" {
+		t.Fatalf("unexpected records after reopen: %+v", records)
+	}
+}
+
+func TestKubernetesRegistry(t *testing.T) {
+	pod := func(name, namespace string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	clientset := fake.NewSimpleClientset(pod("sandboxed-scratch", "sandboxes"), pod("sandboxed-other", "sandboxes"), pod("unrelated", "sandboxes"), pod("sandboxed-team", "team-b"))
+	reg := registry.NewKubernetes(k8sclient.NewClientFromClientset(clientset, nil, "sandboxes"), "sandboxes")
+
+	rec := registry.Record{Name: "scratch", ID: "sandboxed-scratch", Language: "python", Owner: "alice"}
+	if err := reg.Put(rec); err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+	if err := reg.Put(registry.Record{Name: "other", ID: "sandboxed-other", Language: "go"}); err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+
+	got, err := reg.Get("scratch")
+	if err != nil {
+		t.Fatalf("failed to get record: %v", err)
+	}
+	if got.ID != rec.ID || got.Language != "python" || got.Owner != "alice" || got.Namespace != "sandboxes" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+		t.Fatalf("expected timestamps to be set: %+v", got)
+	}
+
+	// Updating keeps the original creation time
+	rec.Language = "node"
+	if err := reg.Put(rec); err != nil {
+		t.Fatalf("failed to update record: %v", err)
+	}
+	updated, _ := reg.Get("scratch")
+	if !updated.CreatedAt.Equal(got.CreatedAt) || updated.Language != "node" {
+		t.Fatalf("unexpected updated record: %+v", updated)
+	}
+
+	records, err := reg.List()
+	if err != nil {
+		t.Fatalf("failed to list records: %v", err)
+	}
+	if len(records) != 2 || records[0].Name != "other" || records[1].Name != "scratch" {
+		t.Fatalf("expected the two labelled pods sorted by name, got %+v", records)
+	}
+
+	// Records in another namespace are found as well
+	if err := reg.Put(registry.Record{Name: "team", ID: "sandboxed-team", Language: "go", Namespace: "team-b"}); err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+	team, err := reg.Get("team")
+	if err != nil || team.Namespace != "team-b" {
+		t.Fatalf("expected the record in team-b, got %+v (%v)", team, err)
+	}
+	if records, _ := reg.List(); len(records) != 3 {
+		t.Fatalf("expected records from both namespaces, got %+v", records)
+	}
+
+	if err := reg.Put(registry.Record{Name: "missing", ID: "sandboxed-missing", Language: "go"}); err == nil {
+		t.Fatal("expected a record for a missing pod to be rejected")
+	}
+	if _, err := reg.Get("missing"); !errors.Is(err, registry.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
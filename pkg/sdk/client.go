@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+var (
+	defaultClientMu sync.Mutex
+	defaultClient   *k8sclient.Client
+)
+
+// SetDefaultClient replaces the client shared by sandboxes created without
+// WithClient. Pass nil to go back to one built from the local kubeconfig or
+// in-cluster config on first use.
+func SetDefaultClient(client *k8sclient.Client) {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+	defaultClient = client
+}
+
+// sharedClient returns the process-wide client, creating it on first use.
+// A failed attempt is not cached, so a cluster that comes up later is found.
+func sharedClient() (*k8sclient.Client, error) {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+
+	if defaultClient == nil {
+		client, err := k8sclient.NewClient(DefaultNamespace)
+		if err != nil {
+			return nil, err
+		}
+		defaultClient = client
+	}
+	return defaultClient, nil
+}
+
+// kubeClient returns the WithClient client, the one built from
+// WithClientOptions, or the shared one. A client that fails to build is
+// retried on the next call.
+func (c *sandboxConfig) kubeClient() (*k8sclient.Client, error) {
+	if c == nil {
+		return sharedClient()
+	}
+
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	if c.client == nil && c.clientOptions != nil {
+		client, err := k8sclient.NewClientWithOptions(*c.clientOptions)
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+	if c.client != nil {
+		return c.client, nil
+	}
+	return sharedClient()
+}
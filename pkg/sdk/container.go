@@ -13,4 +13,10 @@ type Output struct {
 	Result string
 	Error  string
 	ExitCode int
+	// Truncated is set when Result holds only the head and tail of output
+	// over the output limits
+	Truncated bool
+	// OutputFile is the file in the sandbox holding the full output of a
+	// truncated run, when spilling is configured
+	OutputFile string
 }
\ No newline at end of file
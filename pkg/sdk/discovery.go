@@ -0,0 +1,166 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ListFilter narrows the sandboxes returned by List. Empty fields match everything.
+type ListFilter struct {
+	Language Language
+	Owner    string
+	Labels   map[string]string
+}
+
+// Lookup finds the sandbox created with the given name and reattaches to it
+func Lookup(name string, opts ...SandboxOption) (Sandboxed, error) {
+	cfg, err := newSandboxConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	namespace := cfg.namespace
+
+	client, err := cfg.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := client.ListPodsWithSelector(namespace, fmt.Sprintf("%s=true,%s=%s", k8sclient.LabelManaged, k8sclient.LabelName, name))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		info, err := infoFromPod(pod)
+		if err != nil {
+			return nil, err
+		}
+		return Reattach(info, opts...)
+	}
+
+	return nil, fmt.Errorf("sandbox %q not found in namespace %s", name, namespace)
+}
+
+// List returns the sandboxes in the namespace option that match filter
+func List(filter ListFilter, opts ...SandboxOption) ([]SandboxInfo, error) {
+	cfg, err := newSandboxConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	namespace := cfg.namespace
+
+	client, err := cfg.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	selector := []string{k8sclient.LabelManaged + "=true"}
+	if filter.Language != "" {
+		selector = append(selector, k8sclient.LabelLanguage+"="+string(filter.Language))
+	}
+	for k, v := range filter.Labels {
+		selector = append(selector, k+"="+v)
+	}
+
+	pods, err := client.ListPodsWithSelector(namespace, strings.Join(selector, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []SandboxInfo{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		info, err := infoFromPod(pod)
+		if err != nil {
+			continue
+		}
+		if filter.Owner != "" && info.Owner != filter.Owner {
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Exists reports whether the pod of a sandbox is still running, so that
+// stale records can be dropped instead of reattached
+func Exists(info SandboxInfo, opts ...SandboxOption) (bool, error) {
+	cfg, err := newSandboxConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if info.Namespace != "" {
+		cfg.namespace = info.Namespace
+	}
+
+	client, err := cfg.kubeClient()
+	if err != nil {
+		return false, err
+	}
+
+	pod, err := client.GetPod(info.ID, cfg.namespace)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return pod.DeletionTimestamp == nil, nil
+}
+
+// infoFromPod reads sandbox metadata back from a pod's labels and annotations
+func infoFromPod(pod *corev1.Pod) (SandboxInfo, error) {
+	langLabel := pod.Labels[k8sclient.LabelLanguage]
+	if langLabel == "" {
+		// Pods created before sandboxes were labelled only carry the plain label
+		langLabel = pod.Labels["language"]
+	}
+
+	lang, err := ToLanguage(langLabel)
+	if err != nil {
+		return SandboxInfo{}, fmt.Errorf("pod %s is not a recognised sandbox: %v", pod.Name, err)
+	}
+
+	name := pod.Labels[k8sclient.LabelName]
+	if name == "" {
+		name = strings.TrimPrefix(pod.Name, "sandboxed-")
+	}
+
+	info := SandboxInfo{
+		ID:        pod.Name,
+		Name:      name,
+		Language:  lang,
+		Namespace: pod.Namespace,
+		Owner:     pod.Annotations[k8sclient.AnnotationOwner],
+		Labels:    pod.Labels,
+		CreatedAt: pod.CreationTimestamp.Time,
+		Template:  pod.Labels[k8sclient.LabelTemplate],
+	}
+	if t, err := time.Parse(time.RFC3339, pod.Annotations[k8sclient.AnnotationCreatedAt]); err == nil {
+		info.CreatedAt = t
+	}
+	if data := pod.Annotations[k8sclient.AnnotationPackages]; data != "" {
+		// A malformed record only loses the package history, not the sandbox
+		_ = json.Unmarshal([]byte(data), &info.Packages)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,167 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInfoFromPod(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sandboxed-analysis",
+			Namespace: "team-a",
+			Labels: map[string]string{
+				k8sclient.LabelManaged:  "true",
+				k8sclient.LabelName:     "analysis",
+				k8sclient.LabelLanguage: "python",
+				k8sclient.LabelTemplate: "data-science",
+			},
+			Annotations: map[string]string{
+				k8sclient.AnnotationOwner:     "alice",
+				k8sclient.AnnotationCreatedAt: "2026-01-02T03:04:05Z",
+				k8sclient.AnnotationPackages:  `[{"language":"python","name":"requests","installed_at":"2026-01-02T03:05:00Z"}]`,
+			},
+		},
+	}
+
+	info, err := infoFromPod(pod)
+	if err != nil {
+		t.Fatalf("failed to read sandbox info: %v", err)
+	}
+
+	if info.ID != "sandboxed-analysis" || info.Name != "analysis" || info.Language != Python || info.Namespace != "team-a" || info.Owner != "alice" || info.Template != "data-science" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if info.CreatedAt.Year() != 2026 {
+		t.Fatalf("expected creation time from annotation, got %v", info.CreatedAt)
+	}
+	if len(info.Packages) != 1 || info.Packages[0].Name != "requests" || info.Packages[0].Language != Python {
+		t.Fatalf("expected installed packages from annotation, got %+v", info.Packages)
+	}
+
+	s, err := Reattach(info)
+	if err != nil {
+		t.Fatalf("failed to reattach: %v", err)
+	}
+	if got := s.Info(); got.ID != info.ID || got.Namespace != "team-a" || got.Language != Python || len(got.Packages) != 1 {
+		t.Fatalf("reattached handle lost its identity: %+v", got)
+	}
+}
+
+func TestInfoFromPodRejectsUnknownLanguage(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "api-exec-1",
+			Labels: map[string]string{"language": "cobol"},
+		},
+	}
+
+	if _, err := infoFromPod(pod); err == nil {
+		t.Fatal("expected a pod without a supported language to be rejected")
+	}
+}
+
+func TestLookupUsesClient(t *testing.T) {
+	client := k8sclient.NewClientFromClientset(fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sandboxed-analysis",
+			Namespace: "team-a",
+			Labels: map[string]string{
+				k8sclient.LabelManaged:  "true",
+				k8sclient.LabelName:     "analysis",
+				k8sclient.LabelLanguage: "python",
+			},
+		},
+	}), nil, "team-a")
+
+	sandbox, err := Lookup("analysis", WithNamespace("team-a"), WithClient(client))
+	if err != nil {
+		t.Fatalf("failed to look up sandbox: %v", err)
+	}
+	if sandbox.Info().ID != "sandboxed-analysis" {
+		t.Fatalf("unexpected sandbox: %+v", sandbox.Info())
+	}
+
+	// Later operations reuse the client rather than creating their own
+	got, err := sandbox.(*sandboxedImpl).newClient()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != client {
+		t.Fatal("expected the sandbox to keep the client it was looked up with")
+	}
+
+	infos, err := List(ListFilter{Language: Python}, WithNamespace("team-a"), WithClient(client))
+	if err != nil {
+		t.Fatalf("failed to list sandboxes: %v", err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected one sandbox, got %d", len(infos))
+	}
+}
+
+func TestExists(t *testing.T) {
+	client := k8sclient.NewClientFromClientset(fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-analysis", Namespace: "team-a"},
+	}), nil, "default")
+
+	live, err := Exists(SandboxInfo{ID: "sandboxed-analysis", Namespace: "team-a"}, WithClient(client))
+	if err != nil || !live {
+		t.Fatalf("expected the sandbox to exist, got %v, %v", live, err)
+	}
+	live, err = Exists(SandboxInfo{ID: "sandboxed-gone", Namespace: "team-a"}, WithClient(client))
+	if err != nil || live {
+		t.Fatalf("expected a missing pod to be reported as gone, got %v, %v", live, err)
+	}
+}
+
+func TestInfoFromPodAcceptsBash(t *testing.T) {
+	// The REST API labels shell sandboxes with the plain language label
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "sandbox-1718000000",
+			Labels: map[string]string{"language": "bash"},
+		},
+	}
+
+	info, err := infoFromPod(pod)
+	if err != nil {
+		t.Fatalf("expected a bash sandbox to be recognised: %v", err)
+	}
+	if _, err := Reattach(info); err != nil || info.Language != Bash {
+		t.Fatalf("failed to reattach bash sandbox %+v: %v", info, err)
+	}
+}
+
+func TestSecretValuesAreCached(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-app", Namespace: "team-a"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "secret-0", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "api"},
+		}}}},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "team-a"},
+		Data:       map[string][]byte{"key": []byte("sk-example")},
+	})
+	client := k8sclient.NewClientFromClientset(clientset, nil, "team-a")
+
+	sandbox, err := Reattach(SandboxInfo{ID: "sandboxed-app", Language: Python, Namespace: "team-a"}, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	impl := sandbox.(*sandboxedImpl)
+	for i := 0; i < 3; i++ {
+		values, err := impl.secretValues(context.Background(), client)
+		if err != nil || len(values) != 1 || values[0] != "sk-example" {
+			t.Fatalf("unexpected secret values %q, %v", values, err)
+		}
+	}
+	if reads := len(clientset.Actions()); reads != 2 {
+		t.Fatalf("expected one pod and one secret read, got %d", reads)
+	}
+}
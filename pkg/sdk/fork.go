@@ -0,0 +1,148 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+)
+
+// Fork creates a sandbox named name from the same language and template as
+// source, reinstalls the packages installed into source and copies its
+// workspace, so that several approaches can be explored from one starting
+// point. The fork is created in source's namespace with source's labels;
+// opts are applied after them. Packages live outside the workspace, so they
+// are installed again from source's package record rather than copied.
+func Fork(source Sandboxed, name string, opts ...SandboxOption) (Sandboxed, error) {
+	info := source.Info()
+
+	archive, err := source.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %w", info.ID, err)
+	}
+
+	var base []SandboxOption
+	if impl, ok := source.(*sandboxedImpl); ok && impl.cfg != nil && impl.cfg.client != nil {
+		base = append(base, WithClient(impl.cfg.client))
+	}
+	if info.Namespace != "" {
+		base = append(base, WithNamespace(info.Namespace))
+	}
+	if labels := userLabels(info.Labels); len(labels) > 0 {
+		base = append(base, WithLabels(labels))
+	}
+	if info.Template != "" {
+		base = append(base, WithTemplate(info.Template))
+	}
+
+	forked, err := CreateSandbox(name, info.Language, append(base, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	// Restored first, so that manifests are in place to install from
+	if err := forked.Restore(archive); err != nil {
+		_ = forked.Destroy()
+		return nil, err
+	}
+	if err := reinstallPackages(forked, info.Packages); err != nil {
+		_ = forked.Destroy()
+		return nil, err
+	}
+	return forked, nil
+}
+
+// userLabels drops the labels a sandbox sets for itself, which cannot be
+// passed to WithLabels
+func userLabels(labels map[string]string) map[string]string {
+	user := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if strings.HasPrefix(k, "sandboxed.io/") || k == "language" {
+			continue
+		}
+		user[k] = v
+	}
+	return user
+}
+
+// pendingPackages returns the packages in history that are not yet in
+// installed, such as ones a template already installed, in order
+func pendingPackages(history, installed []Package) []Package {
+	type key struct {
+		lang     Language
+		name     string
+		manifest bool
+	}
+	seen := make(map[key]bool, len(installed))
+	for _, p := range installed {
+		seen[key{p.Language, p.Name, p.Manifest}] = true
+	}
+
+	var pending []Package
+	for _, p := range history {
+		k := key{p.Language, p.Name, p.Manifest}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		pending = append(pending, p)
+	}
+	return pending
+}
+
+// reinstallPackages installs the packages of history that s does not have
+// yet. Consecutive packages of one language are installed together.
+func reinstallPackages(s Sandboxed, history []Package) error {
+	pending := pendingPackages(history, s.Info().Packages)
+
+	for i := 0; i < len(pending); {
+		p := pending[i]
+		if p.Manifest {
+			if err := reinstallManifest(s, p); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+
+		var names []string
+		for ; i < len(pending) && !pending[i].Manifest && pending[i].Language == p.Language; i++ {
+			names = append(names, pending[i].Name)
+		}
+		result, err := s.InstallPackages(p.Language, names)
+		if err != nil {
+			return err
+		}
+		if !result.Success {
+			return fmt.Errorf("reinstalling %s packages failed with exit code %d: %s", p.Language, result.ExitCode, result.Output)
+		}
+	}
+	return nil
+}
+
+// reinstallManifest installs the dependencies of a manifest restored into the
+// workspace
+func reinstallManifest(s Sandboxed, p Package) error {
+	impl, ok := s.(*sandboxedImpl)
+	if !ok {
+		return fmt.Errorf("cannot install from %s in this sandbox", p.Name)
+	}
+
+	recipe, err := templates.RecipeLookup(string(p.Language))
+	if err != nil {
+		return err
+	}
+	client, err := impl.newClient()
+	if err != nil {
+		return err
+	}
+
+	output, err := impl.installManifest(context.Background(), client, recipe, p.Name)
+	if err != nil {
+		return err
+	}
+	if output != nil {
+		return fmt.Errorf("%s: %s", output.Error, output.Result)
+	}
+	return nil
+}
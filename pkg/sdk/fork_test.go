@@ -0,0 +1,47 @@
+package sdk
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+func TestPendingPackages(t *testing.T) {
+	history := []Package{
+		{Language: Python, Name: "pandas"},
+		{Language: Python, Name: "requests"},
+		{Language: Python, Name: "requirements.txt", Manifest: true},
+		{Language: Python, Name: "requests"},
+		{Language: Node, Name: "left-pad"},
+	}
+	// Installed by the template the fork was created from
+	installed := []Package{{Language: Python, Name: "pandas"}}
+
+	got := pendingPackages(history, installed)
+	want := []Package{
+		{Language: Python, Name: "requests"},
+		{Language: Python, Name: "requirements.txt", Manifest: true},
+		{Language: Node, Name: "left-pad"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestUserLabels(t *testing.T) {
+	labels := userLabels(map[string]string{
+		k8sclient.LabelManaged:  "true",
+		k8sclient.LabelName:     "analysis",
+		k8sclient.LabelLanguage: "python",
+		k8sclient.LabelTemplate: "internal-ml",
+		"language":              "python",
+		"team":                  "data",
+	})
+	if want := map[string]string{"team": "data"}; !reflect.DeepEqual(labels, want) {
+		t.Fatalf("expected %v, got %v", want, labels)
+	}
+	if _, err := newSandboxConfig([]SandboxOption{WithLabels(labels)}); err != nil {
+		t.Fatalf("labels should be accepted by WithLabels: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// CheckoutRef records the commit a repository was checked out at, so that
+// Diff reports the changes made since, including any commits
+const CheckoutRef = "refs/sandboxed/checkout"
+
+// commitPattern matches abbreviated and full commit IDs, which git clone
+// cannot check out directly
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// gitWrapper runs git with the credentials read from stdin when $creds is
+// set. They are kept in a private temporary file while the script runs, so
+// they never appear in a command line, a process environment or the
+// repository.
+const gitWrapper = `if [ -n "$creds" ]; then
+	SANDBOXED_GIT_CREDENTIALS=$(mktemp)
+	export SANDBOXED_GIT_CREDENTIALS
+	trap 'rm -f "$SANDBOXED_GIT_CREDENTIALS"' EXIT
+	cat > "$SANDBOXED_GIT_CREDENTIALS"
+fi
+git() {
+	if [ -n "$creds" ]; then
+		command git -c advice.detachedHead=false -c credential.helper= -c credential.helper='!f() { if [ "$1" = get ]; then cat "$SANDBOXED_GIT_CREDENTIALS"; fi; }; f' "$@"
+	else
+		command git -c advice.detachedHead=false "$@"
+	fi
+}
+`
+
+// cloneScript clones $1 at ref $2 into $3 with history depth $4 (all when 0).
+// Branches and tags are cloned directly; a commit ($5 set) is checked out
+// from a clone, or fetched when the clone is too shallow to contain it. With
+// $6 set, credentials for git's credential helper are read from stdin.
+const cloneScript = `set -e
+url=$1 ref=$2 dir=$3 depth=$4 commit=$5 creds=$6
+set --
+` + gitWrapper + `if [ "$depth" -gt 0 ]; then set -- --depth "$depth"; fi
+if [ -z "$commit" ]; then
+	if [ -n "$ref" ]; then set -- "$@" --branch "$ref"; fi
+	git clone -q "$@" -- "$url" "$dir"
+	cd "$dir"
+else
+	git clone -q --no-checkout "$@" -- "$url" "$dir"
+	cd "$dir"
+	if ! git checkout -q --detach "$ref" 2>/dev/null; then
+		git fetch -q "$@" origin "$ref"
+		git checkout -q --detach FETCH_HEAD
+	fi
+fi
+git update-ref ` + CheckoutRef + ` HEAD
+git rev-parse HEAD
+`
+
+// diffScript prints the changes in repository $1 since checkout, new files
+// included. A scratch index picks up new files without staging them.
+const diffScript = `set -e
+cd "$1"
+index=$(mktemp)
+trap 'rm -f "$index"' EXIT
+cp "$(git rev-parse --git-path index)" "$index" 2>/dev/null || true
+GIT_INDEX_FILE=$index git add -A
+GIT_INDEX_FILE=$index git diff --cached --binary ` + CheckoutRef + `
+`
+
+// applyScript applies the patch on stdin to the working tree of repository $1
+const applyScript = `cd "$1" && git apply --whitespace=nowarn -
+`
+
+// GitCredentials names a Kubernetes Secret key holding a password or token
+// for cloning over HTTPS. The secret is read from the sandbox's namespace and
+// its value is redacted from any output.
+type GitCredentials struct {
+	Secret string `json:"secret"`
+	Key    string `json:"key"`
+	// Username defaults to "git"; hosts that authenticate by token generally
+	// accept any username
+	Username string `json:"username,omitempty"`
+}
+
+// CloneOption configures CloneRepo
+type CloneOption struct {
+	apply func(*cloneConfig) error
+}
+
+type cloneConfig struct {
+	depth       int
+	credentials *GitCredentials
+	// allowedSecrets is set by WithAllowedGitSecrets
+	allowedSecrets map[string]bool
+}
+
+// WithCloneDepth makes a shallow clone with depth commits of history
+func WithCloneDepth(depth int) CloneOption {
+	return CloneOption{apply: func(c *cloneConfig) error {
+		if depth <= 0 {
+			return fmt.Errorf("clone depth must be positive, got %d", depth)
+		}
+		c.depth = depth
+		return nil
+	}}
+}
+
+// WithGitCredentials authenticates the clone with a secret
+func WithGitCredentials(creds GitCredentials) CloneOption {
+	return CloneOption{apply: func(c *cloneConfig) error {
+		if creds.Secret == "" || creds.Key == "" {
+			return errors.New("git credentials need a secret and a key")
+		}
+		c.credentials = &creds
+		return nil
+	}}
+}
+
+// WithAllowedGitSecrets limits credentials to secrets the sandbox already
+// references and the secrets named. It is for callers passing on credentials
+// chosen by someone else, who should not be able to read other secrets in
+// the namespace.
+func WithAllowedGitSecrets(names ...string) CloneOption {
+	return CloneOption{apply: func(c *cloneConfig) error {
+		c.allowedSecrets = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.allowedSecrets[name] = true
+		}
+		return nil
+	}}
+}
+
+// CloneRepo clones the repository at url into path, relative to the
+// workspace, and returns the commit checked out. ref is a branch, tag or
+// commit; the remote's default branch is used when empty. The sandbox image
+// must have git installed.
+func (s *sandboxedImpl) CloneRepo(url, ref, path string, opts ...CloneOption) (string, error) {
+	var cfg cloneConfig
+	for _, opt := range opts {
+		if err := opt.apply(&cfg); err != nil {
+			return "", err
+		}
+	}
+	if url == "" {
+		return "", errors.New("repository URL is required")
+	}
+	if strings.HasPrefix(url, "-") || strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid repository %q at %q", url, ref)
+	}
+
+	client, err := s.newClient()
+	if err != nil {
+		return "", err
+	}
+
+	// Fail rather than wait for a password nobody can type
+	env := map[string]string{"GIT_TERMINAL_PROMPT": "0"}
+	var stdin io.Reader
+	var credentials []string
+	hasCredentials := ""
+	if creds := cfg.credentials; creds != nil {
+		password, err := s.gitPassword(client, *creds, url, cfg.allowedSecrets)
+		if err != nil {
+			return "", err
+		}
+		username := creds.Username
+		if username == "" {
+			username = "git"
+		}
+		if strings.ContainsAny(username+password, "\n\x00") {
+			return "", errors.New("git credentials must not contain newlines")
+		}
+		stdin = strings.NewReader("username=" + username + "\npassword=" + password + "\n")
+		credentials = []string{password}
+		hasCredentials = "true"
+	}
+
+	commit := ""
+	if commitPattern.MatchString(ref) {
+		commit = "true"
+	}
+	output, err := s.runGit(client, stdin, env, credentials, cloneScript,
+		url, ref, repoDir(path), strconv.Itoa(cfg.depth), commit, hasCredentials)
+	if err != nil {
+		return "", fmt.Errorf("clone failed: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1], nil
+}
+
+// gitPassword reads the secret key named by creds, for cloning url. With
+// allowed set, the secret must be referenced by the sandbox or allowed.
+func (s *sandboxedImpl) gitPassword(client *k8sclient.Client, creds GitCredentials, url string, allowed map[string]bool) (string, error) {
+	ctx := context.Background()
+	if !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("credentials are only sent over HTTPS, not to %q", url)
+	}
+	if allowed != nil && !allowed[creds.Secret] {
+		referenced, err := client.PodReferencesSecret(ctx, s.id, s.namespace(), creds.Secret, creds.Key)
+		if err != nil {
+			return "", err
+		}
+		if !referenced {
+			return "", fmt.Errorf("secret %s is not available to sandbox %s for git credentials", creds.Secret, s.id)
+		}
+	}
+	return client.SecretValue(ctx, s.namespace(), creds.Secret, creds.Key)
+}
+
+// ApplyPatch applies a unified diff, such as one returned by Diff, to the
+// working tree of the repository at path. Nothing is applied when any hunk
+// fails.
+func (s *sandboxedImpl) ApplyPatch(path, patch string) error {
+	if strings.TrimSpace(patch) == "" {
+		return errors.New("patch is empty")
+	}
+
+	client, err := s.newClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.runGit(client, strings.NewReader(patch), nil, nil, applyScript, repoDir(path)); err != nil {
+		return fmt.Errorf("patch does not apply: %w", err)
+	}
+	return nil
+}
+
+// Diff returns the changes to the repository at path since CloneRepo checked
+// it out, as a unified diff that ApplyPatch accepts. Committed and
+// uncommitted changes and new files are included.
+func (s *sandboxedImpl) Diff(path string) (string, error) {
+	client, err := s.newClient()
+	if err != nil {
+		return "", err
+	}
+
+	return s.runGit(client, nil, nil, nil, diffScript, repoDir(path))
+}
+
+// runGit runs a git script from the workspace and returns its output. No
+// terminal is attached, so patches pass through byte for byte. Values of the
+// sandbox's secrets and of credentials are redacted from the output and
+// errors.
+func (s *sandboxedImpl) runGit(client *k8sclient.Client, stdin io.Reader, env map[string]string, credentials []string, script string, args ...string) (string, error) {
+	ctx := context.Background()
+
+	var stdout, stderr bytes.Buffer
+	execErr := client.ExecInPodContext(ctx, s.id, s.namespace(), k8sclient.ExecOptions{
+		Command: k8sclient.WithEnv(env, workspaceCommand(WorkspaceDir, script, args...)),
+		Stdin:   stdin,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+
+	secrets, err := s.secretValues(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	secrets = append(secrets, credentials...)
+
+	if execErr != nil {
+		msg := strings.TrimSpace(k8sclient.Redact(stderr.String(), secrets))
+		if exitCode, ok := k8sclient.ExitCode(execErr); ok {
+			return "", fmt.Errorf("git exited with code %d: %s", exitCode, msg)
+		}
+		return "", fmt.Errorf("exec failed: %s, stderr: %s", k8sclient.Redact(execErr.Error(), secrets), msg)
+	}
+	return k8sclient.Redact(stdout.String(), secrets), nil
+}
+
+// repoDir returns the repository directory for a path relative to the
+// workspace, the workspace itself when empty
+func repoDir(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
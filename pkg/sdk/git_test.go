@@ -0,0 +1,296 @@
+package sdk
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// runScript runs a git script as the sandbox would, from workspace
+func runScript(t *testing.T, workspace string, env []string, stdin string, script string, args ...string) (string, error) {
+	t.Helper()
+
+	argv := workspaceCommand(workspace, script, args...)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(gitEnv(t), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return string(out), err
+}
+
+// gitEnv isolates git from the user's configuration
+func gitEnv(t *testing.T) []string {
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + t.TempDir(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = gitEnv(t)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// bareRepo creates a bare repository whose main branch has three commits,
+// the second tagged v2, and a feature branch, and returns its path and
+// commit IDs oldest first
+func bareRepo(t *testing.T) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "origin.git")
+	work := filepath.Join(root, "work")
+	git(t, root, "init", "-q", "--bare", "--initial-branch=main", bare)
+	git(t, root, "init", "-q", "--initial-branch=main", work)
+
+	var commits []string
+	for i, content := range []string{"one\n", "one\ntwo\n", "one\ntwo\nthree\n"} {
+		if err := os.WriteFile(filepath.Join(work, "a.txt"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git(t, work, "add", "-A")
+		git(t, work, "commit", "-q", "-m", content)
+		commits = append(commits, git(t, work, "rev-parse", "HEAD"))
+		if i == 1 {
+			git(t, work, "tag", "v2")
+		}
+	}
+	git(t, work, "checkout", "-q", "-b", "feature")
+	if err := os.WriteFile(filepath.Join(work, "feature.txt"), []byte("feature\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, work, "add", "-A")
+	git(t, work, "commit", "-q", "-m", "feature")
+	git(t, work, "push", "-q", bare, "main", "feature", "v2")
+
+	return bare, commits
+}
+
+func TestCloneScript(t *testing.T) {
+	bare, commits := bareRepo(t)
+	url := "file://" + bare
+
+	for name, tc := range map[string]struct {
+		ref    string
+		depth  string
+		commit string
+		want   string
+		count  string
+	}{
+		"default branch":            {depth: "0", want: commits[2], count: "3"},
+		"shallow branch":            {ref: "main", depth: "1", want: commits[2], count: "1"},
+		"shallow tag":               {ref: "v2", depth: "1", want: commits[1], count: "1"},
+		"abbreviated commit":        {ref: commits[0][:7], depth: "0", commit: "true", want: commits[0], count: "1"},
+		"commit outside of shallow": {ref: commits[1], depth: "1", commit: "true", want: commits[1], count: "1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			workspace := t.TempDir()
+			out, err := runScript(t, workspace, nil, "", cloneScript, url, tc.ref, "repo", tc.depth, tc.commit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(out); got != tc.want {
+				t.Fatalf("expected commit %s, got %q", tc.want, got)
+			}
+
+			repo := filepath.Join(workspace, "repo")
+			if got := git(t, repo, "rev-parse", CheckoutRef); got != tc.want {
+				t.Fatalf("expected %s to record %s, got %s", CheckoutRef, tc.want, got)
+			}
+			if got := git(t, repo, "rev-list", "--count", "HEAD"); got != tc.count {
+				t.Fatalf("expected %s commits of history, got %s", tc.count, got)
+			}
+		})
+	}
+
+	if _, err := runScript(t, t.TempDir(), nil, "", cloneScript, url, "missing", "repo", "0", ""); err == nil {
+		t.Fatal("expected an unknown branch to fail")
+	}
+}
+
+func TestDiffAndApplyScripts(t *testing.T) {
+	bare, _ := bareRepo(t)
+	workspace := t.TempDir()
+	for _, dir := range []string{"source", "target"} {
+		if _, err := runScript(t, workspace, nil, "", cloneScript, "file://"+bare, "", dir, "0", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := filepath.Join(workspace, "source")
+
+	// A commit, an uncommitted change, a new text file and a new binary file
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("one\ntwo\nthree\nfour\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, source, "commit", "-q", "-am", "four")
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("zero\none\ntwo\nthree\nfour\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "new.txt"), []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "data.bin"), []byte{0, 1, 2, 255}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patch, err := runScript(t, workspace, nil, "", diffScript, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+zero", "+four", "new file mode", "b/new.txt", "GIT binary patch"} {
+		if !strings.Contains(patch, want) {
+			t.Fatalf("expected the diff to contain %q:\n%s", want, patch)
+		}
+	}
+	if status := git(t, source, "status", "--porcelain"); !strings.Contains(status, "?? new.txt") {
+		t.Fatalf("expected new files to stay unstaged, got status:\n%s", status)
+	}
+
+	if _, err := runScript(t, workspace, nil, patch, applyScript, "target"); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := runScript(t, workspace, nil, "", diffScript, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != patch {
+		t.Fatalf("expected the target to end up with the same changes:\n%s\nvs\n%s", patch, applied)
+	}
+
+	if _, err := runScript(t, workspace, nil, patch, applyScript, "target"); err == nil {
+		t.Fatal("expected a patch that no longer applies to fail")
+	}
+}
+
+func TestCloneScriptCredentials(t *testing.T) {
+	bare, commits := bareRepo(t)
+
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git-http-backend is not installed")
+	}
+
+	handler := &cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Dir(bare), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot" || pass != "s3cr3t-token" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/" + filepath.Base(bare)
+	env := []string{"GIT_TERMINAL_PROMPT=0", "TMPDIR=" + t.TempDir()}
+
+	workspace := t.TempDir()
+	out, err := runScript(t, workspace, env, "username=bot\npassword=s3cr3t-token\n", cloneScript, url, "main", "repo", "1", "", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out); got != commits[2] {
+		t.Fatalf("expected commit %s, got %q", commits[2], got)
+	}
+	config, err := os.ReadFile(filepath.Join(workspace, "repo", ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "s3cr3t-token") {
+		t.Fatal("credentials leaked into the repository config")
+	}
+	if left, _ := os.ReadDir(strings.TrimPrefix(env[1], "TMPDIR=")); len(left) != 0 {
+		t.Fatalf("expected the credentials file to be removed, found %d file(s)", len(left))
+	}
+
+	if _, err := runScript(t, t.TempDir(), []string{"GIT_TERMINAL_PROMPT=0"}, "", cloneScript, url, "main", "repo", "1", ""); err == nil {
+		t.Fatal("expected a clone without credentials to be refused")
+	}
+}
+
+func TestCloneOptions(t *testing.T) {
+	for name, opt := range map[string]CloneOption{
+		"zero depth":         WithCloneDepth(0),
+		"credentials no key": WithGitCredentials(GitCredentials{Secret: "git"}),
+	} {
+		var cfg cloneConfig
+		if err := opt.apply(&cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestGitPasswordAllowedSecrets(t *testing.T) {
+	secret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"},
+			Data:       map[string][]byte{"token": []byte(name + "-token")},
+		}
+	}
+	client := k8sclient.NewClientFromClientset(fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sandboxed-app", Namespace: "team-a"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "secret-0", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "github"},
+		}}}},
+	}, secret("github"), secret("deploy"), secret("database")), nil, "team-a")
+
+	sandbox, err := Reattach(SandboxInfo{ID: "sandboxed-app", Language: Python, Namespace: "team-a"}, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	impl := sandbox.(*sandboxedImpl)
+	allowed := map[string]bool{"deploy": true}
+	url := "https://example.com/repo.git"
+
+	for _, name := range []string{"github", "deploy"} {
+		password, err := impl.gitPassword(client, GitCredentials{Secret: name, Key: "token"}, url, allowed)
+		if err != nil || password != name+"-token" {
+			t.Errorf("expected %s to be usable, got %q, %v", name, password, err)
+		}
+	}
+	if _, err := impl.gitPassword(client, GitCredentials{Secret: "database", Key: "token"}, url, allowed); err == nil {
+		t.Error("expected a secret the sandbox does not reference to be refused")
+	}
+	if _, err := impl.gitPassword(client, GitCredentials{Secret: "database", Key: "token"}, url, nil); err != nil {
+		t.Errorf("expected any secret to be usable without an allowlist, got %v", err)
+	}
+	if _, err := impl.gitPassword(client, GitCredentials{Secret: "github", Key: "token"}, "http://example.com/repo.git", allowed); err == nil {
+		t.Error("expected credentials not to be sent over plain HTTP")
+	}
+}
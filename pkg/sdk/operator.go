@@ -0,0 +1,50 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/operator"
+)
+
+// createResource submits the sandbox as a Sandbox resource and waits for the
+// operator to build and provision its pod
+func (s *sandboxedImpl) createResource(client *k8sclient.Client) (Sandboxed, error) {
+	cfg := s.cfg
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := operator.SandboxSpec{
+		Language:         s.lc.language,
+		Image:            cfg.image,
+		Env:              cfg.env,
+		Secrets:          cfg.secrets,
+		RuntimeClassName: cfg.runtimeClass,
+	}
+	if cfg.template != nil {
+		spec.Template = cfg.template.Name
+	}
+	if cfg.resources != nil {
+		spec.Resources = *cfg.resources
+	}
+
+	sandbox := operator.New(s.lc.name, cfg.namespace, spec)
+	sandbox.Labels = cfg.labels
+
+	ctx := context.Background()
+	if err := operator.Create(ctx, dyn, sandbox); err != nil {
+		return nil, err
+	}
+
+	ready, err := operator.WaitReady(ctx, dyn, cfg.namespace, s.lc.name, cfg.timeout)
+	if err != nil {
+		_ = operator.Delete(ctx, dyn, cfg.namespace, s.lc.name)
+		return nil, fmt.Errorf("sandbox %s not ready: %w", s.lc.name, err)
+	}
+
+	s.id = ready.Status.PodName
+	return s, nil
+}
@@ -0,0 +1,53 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/operator"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCreateSandboxWithOperator(t *testing.T) {
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		operator.SandboxGVR: "SandboxList",
+	})
+	// Stand in for the operator by reporting every new sandbox ready
+	dyn.PrependReactor("create", "sandboxes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		u := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		_ = unstructured.SetNestedField(u.Object, operator.PhaseReady, "status", "phase")
+		_ = unstructured.SetNestedField(u.Object, operator.PodName(u.GetName()), "status", "podName")
+		return false, nil, nil
+	})
+
+	client := k8sclient.NewClientFromClientset(fake.NewSimpleClientset(), nil, "sandboxes")
+	client.SetDynamic(dyn)
+
+	s, err := CreateSandbox("analysis", Python,
+		WithClient(client),
+		WithNamespace("sandboxes"),
+		WithLabels(map[string]string{"team": "data"}),
+		WithOperator(),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sandbox: %v", err)
+	}
+	if id := s.Info().ID; id != "sandboxed-analysis" {
+		t.Fatalf("expected the operator's pod name as ID, got %s", id)
+	}
+
+	sandbox, err := operator.Get(context.Background(), dyn, "sandboxes", "analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sandbox.Spec.Language != "python" || sandbox.Labels["team"] != "data" {
+		t.Fatalf("unexpected sandbox resource: %+v", sandbox)
+	}
+
+}
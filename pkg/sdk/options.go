@@ -0,0 +1,357 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultNamespace is used when no namespace option is given
+const DefaultNamespace = "default"
+
+// DefaultReadyTimeout bounds how long CreateSandbox waits for the sandbox
+const DefaultReadyTimeout = 120 * time.Second
+
+// SandboxOption configures a sandbox. Use the With* constructors; the
+// Name/Value form is still accepted for compatibility and is checked just as
+// strictly, so a misspelled name or a value of the wrong type is an error.
+type SandboxOption struct {
+	Name  string
+	Value interface{}
+
+	apply func(*sandboxConfig) error
+}
+
+// sandboxConfig is the validated result of applying options
+type sandboxConfig struct {
+	namespace    string
+	labels       map[string]string
+	env          map[string]string
+	secrets      []k8sclient.SecretRef
+	volumes      []k8sclient.Volume
+	resources    *k8sclient.Resources
+	timeout      time.Duration
+	image        string
+	runtimeClass string
+	template     *templates.Template
+	client       *k8sclient.Client
+	operator     bool
+	snapshot     []byte
+
+	// clientOptions, set by WithClientOptions, builds client on first use
+	clientOptions *k8sclient.ClientOptions
+	clientMu      sync.Mutex
+}
+
+// WithNamespace places the sandbox in a Kubernetes namespace
+func WithNamespace(namespace string) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, "; "))
+		}
+		c.namespace = namespace
+		return nil
+	}}
+}
+
+// WithLabels adds labels to the sandbox pod. Keys under sandboxed.io/ are
+// reserved for the sandbox's own metadata.
+func WithLabels(labels map[string]string) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		for k, v := range labels {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, "; "))
+			}
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				return fmt.Errorf("invalid value for label %q: %s", k, strings.Join(errs, "; "))
+			}
+			if strings.HasPrefix(k, "sandboxed.io/") {
+				return fmt.Errorf("label %q is reserved", k)
+			}
+		}
+		if c.labels == nil {
+			c.labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			c.labels[k] = v
+		}
+		return nil
+	}}
+}
+
+// WithEnv sets environment variables for the sandbox container
+func WithEnv(env map[string]string) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if err := k8sclient.ValidateEnv(env); err != nil {
+			return err
+		}
+		if c.env == nil {
+			c.env = make(map[string]string, len(env))
+		}
+		for k, v := range env {
+			c.env[k] = v
+		}
+		return nil
+	}}
+}
+
+// WithSecrets exposes Kubernetes Secrets to the sandbox container
+func WithSecrets(secrets ...k8sclient.SecretRef) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		for _, ref := range secrets {
+			if err := ref.Validate(); err != nil {
+				return err
+			}
+		}
+		c.secrets = append(c.secrets, secrets...)
+		return nil
+	}}
+}
+
+// WithVolumes mounts volumes, such as package caches, into the sandbox
+func WithVolumes(volumes ...k8sclient.Volume) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		for _, v := range volumes {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+		c.volumes = append(c.volumes, volumes...)
+		return nil
+	}}
+}
+
+// WithResources sets the sandbox container's resource requests and limits
+func WithResources(resources k8sclient.Resources) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if err := resources.Validate(); err != nil {
+			return err
+		}
+		c.resources = &resources
+		return nil
+	}}
+}
+
+// WithTimeout bounds how long CreateSandbox waits for the sandbox to become
+// ready, DefaultReadyTimeout by default
+func WithTimeout(timeout time.Duration) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive, got %s", timeout)
+		}
+		c.timeout = timeout
+		return nil
+	}}
+}
+
+// WithImage replaces the language's default image
+func WithImage(image string) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if strings.TrimSpace(image) == "" {
+			return errors.New("image must not be empty")
+		}
+		c.image = image
+		return nil
+	}}
+}
+
+// WithRuntimeClass runs the sandbox under a RuntimeClass, such as gVisor or
+// Kata Containers, for stronger isolation
+func WithRuntimeClass(name string) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return fmt.Errorf("invalid runtime class %q: %s", name, strings.Join(errs, "; "))
+		}
+		c.runtimeClass = name
+		return nil
+	}}
+}
+
+// WithTemplate creates the sandbox from a registered environment template
+func WithTemplate(name string) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		tpl, err := templates.TemplateLookup(name)
+		if err != nil {
+			return err
+		}
+		c.template = &tpl
+		return nil
+	}}
+}
+
+// WithTemplateSpec creates the sandbox from an unregistered template
+func WithTemplateSpec(tpl templates.Template) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if err := tpl.Validate(); err != nil {
+			return err
+		}
+		c.template = &tpl
+		return nil
+	}}
+}
+
+// WithClient uses client for every cluster call made for the sandbox instead
+// of the shared default client
+func WithClient(client *k8sclient.Client) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if client == nil {
+			return errors.New("client must not be nil")
+		}
+		c.client, c.clientOptions = client, nil
+		return nil
+	}}
+}
+
+// WithClientOptions connects to the cluster selected by opts, such as a
+// kubeconfig context, instead of using the shared default client. The client
+// is created on the first cluster call and kept by the sandbox handle.
+func WithClientOptions(opts k8sclient.ClientOptions) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		c.client, c.clientOptions = nil, &opts
+		return nil
+	}}
+}
+
+// WithOperator creates the sandbox as a Sandbox resource and leaves building
+// the pod and provisioning the template to 'sandboxed operator'. Volumes come
+// from the operator's config, and templates must be registered with it.
+func WithOperator() SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		c.operator = true
+		return nil
+	}}
+}
+
+// WithSnapshot seeds the new sandbox's workspace from a snapshot archive, as
+// returned by Snapshot
+func WithSnapshot(archive []byte) SandboxOption {
+	return SandboxOption{apply: func(c *sandboxConfig) error {
+		if len(archive) == 0 {
+			return errors.New("snapshot archive is empty")
+		}
+		c.snapshot = archive
+		return nil
+	}}
+}
+
+// typed converts a legacy Name/Value option to its typed equivalent
+func (o SandboxOption) typed() (SandboxOption, error) {
+	if o.apply != nil {
+		return o, nil
+	}
+
+	wrongType := fmt.Errorf("sandbox option %q has unsupported value type %T", o.Name, o.Value)
+	switch o.Name {
+	case "namespace":
+		if v, ok := o.Value.(string); ok {
+			return WithNamespace(v), nil
+		}
+	case "labels":
+		if v, ok := o.Value.(map[string]string); ok {
+			return WithLabels(v), nil
+		}
+	case "env":
+		if v, ok := o.Value.(map[string]string); ok {
+			return WithEnv(v), nil
+		}
+	case "secrets":
+		if v, ok := o.Value.([]k8sclient.SecretRef); ok {
+			return WithSecrets(v...), nil
+		}
+	case "volumes":
+		if v, ok := o.Value.([]k8sclient.Volume); ok {
+			return WithVolumes(v...), nil
+		}
+	case "resources":
+		if v, ok := o.Value.(k8sclient.Resources); ok {
+			return WithResources(v), nil
+		}
+	case "timeout":
+		if v, ok := o.Value.(time.Duration); ok {
+			return WithTimeout(v), nil
+		}
+	case "image":
+		if v, ok := o.Value.(string); ok {
+			return WithImage(v), nil
+		}
+	case "runtime_class":
+		if v, ok := o.Value.(string); ok {
+			return WithRuntimeClass(v), nil
+		}
+	case "template":
+		switch v := o.Value.(type) {
+		case string:
+			return WithTemplate(v), nil
+		case templates.Template:
+			return WithTemplateSpec(v), nil
+		}
+	case "client":
+		if v, ok := o.Value.(*k8sclient.Client); ok {
+			return WithClient(v), nil
+		}
+	case "operator":
+		if v, ok := o.Value.(bool); ok {
+			return SandboxOption{apply: func(c *sandboxConfig) error {
+				c.operator = v
+				return nil
+			}}, nil
+		}
+	default:
+		return SandboxOption{}, fmt.Errorf("unknown sandbox option %q", o.Name)
+	}
+	return SandboxOption{}, wrongType
+}
+
+// newSandboxConfig applies and validates options. Later options override
+// earlier ones, except labels, env, secrets and volumes, which accumulate.
+func newSandboxConfig(opts []SandboxOption) (*sandboxConfig, error) {
+	c := &sandboxConfig{
+		namespace: DefaultNamespace,
+		timeout:   DefaultReadyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt, err := opt.typed()
+		if err != nil {
+			return nil, err
+		}
+		if err := opt.apply(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, c.validate()
+}
+
+// validate rejects options that contradict each other
+func (c *sandboxConfig) validate() error {
+	if c.template != nil && c.template.Image != "" && c.image != "" {
+		return fmt.Errorf("image %s conflicts with template %s, which sets its own image", c.image, c.template.Name)
+	}
+
+	for _, ref := range c.secrets {
+		if _, ok := c.env[ref.Env]; ok && ref.Env != "" {
+			return fmt.Errorf("environment variable %s is set both directly and from secret %s", ref.Env, ref.Secret)
+		}
+	}
+
+	mounts := map[string]bool{}
+	for _, v := range c.volumes {
+		mounts[v.MountPath] = true
+	}
+	for _, ref := range c.secrets {
+		if ref.MountPath != "" && mounts[ref.MountPath] {
+			return fmt.Errorf("secret %s and a volume are both mounted at %s", ref.Secret, ref.MountPath)
+		}
+	}
+	return nil
+}
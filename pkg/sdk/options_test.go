@@ -0,0 +1,125 @@
+package sdk
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"k8s.io/client-go/rest"
+)
+
+func TestSandboxConfigDefaults(t *testing.T) {
+	cfg, err := newSandboxConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.namespace != DefaultNamespace || cfg.timeout != DefaultReadyTimeout {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestTypedOptions(t *testing.T) {
+	labels := map[string]string{"team": "ml"}
+	cfg, err := newSandboxConfig([]SandboxOption{
+		WithNamespace("sandboxes"),
+		WithLabels(labels),
+		WithLabels(map[string]string{"app.kubernetes.io/part-of": "eval"}),
+		WithEnv(map[string]string{"MODE": "test"}),
+		WithResources(k8sclient.Resources{Limits: map[string]string{"memory": "1Gi"}}),
+		WithTimeout(time.Minute),
+		WithImage("registry.example.com/python:3.12"),
+		WithRuntimeClass("gvisor"),
+	})
+	if err != nil {
+		t.Fatalf("failed to apply options: %v", err)
+	}
+
+	labels["team"] = "changed"
+	if cfg.labels["team"] != "ml" || cfg.labels["app.kubernetes.io/part-of"] != "eval" {
+		t.Fatalf("expected labels to accumulate as copies, got %v", cfg.labels)
+	}
+	if cfg.namespace != "sandboxes" || cfg.timeout != time.Minute || cfg.runtimeClass != "gvisor" || cfg.resources.Limits["memory"] != "1Gi" {
+		t.Fatalf("options not applied: %+v", cfg)
+	}
+}
+
+func TestLegacyOptions(t *testing.T) {
+	cfg, err := newSandboxConfig([]SandboxOption{
+		{Name: "namespace", Value: "development"},
+		{Name: "labels", Value: map[string]string{"project": "my-app"}},
+		{Name: "volumes", Value: []k8sclient.Volume{{MountPath: "/root/.npm", ClaimName: "npm-cache"}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply legacy options: %v", err)
+	}
+	if cfg.namespace != "development" || cfg.labels["project"] != "my-app" || len(cfg.volumes) != 1 {
+		t.Fatalf("legacy options not applied: %+v", cfg)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	cases := map[string][]SandboxOption{
+		"misspelled name":       {{Name: "namesapce", Value: "dev"}},
+		"wrong value type":      {{Name: "labels", Value: map[string]interface{}{"a": "b"}}},
+		"invalid namespace":     {WithNamespace("Not_A_Namespace")},
+		"invalid label":         {WithLabels(map[string]string{"bad key!": "x"})},
+		"reserved label":        {WithLabels(map[string]string{"sandboxed.io/name": "x"})},
+		"invalid env":           {WithEnv(map[string]string{"1X": "y"})},
+		"non-positive timeout":  {WithTimeout(0)},
+		"empty image":           {WithImage(" ")},
+		"invalid runtime class": {WithRuntimeClass("gVisor!")},
+		"unknown template":      {WithTemplate("no-such-template")},
+		"nil client":            {WithClient(nil)},
+		"conflicting cluster":   {WithClientOptions(k8sclient.ClientOptions{InCluster: true, Context: "prod"})},
+		"empty snapshot":        {WithSnapshot(nil)},
+		"env set twice": {
+			WithEnv(map[string]string{"TOKEN": "plain"}),
+			WithSecrets(k8sclient.SecretRef{Secret: "api", Key: "token", Env: "TOKEN"}),
+		},
+		"mount path clash": {
+			WithVolumes(k8sclient.Volume{MountPath: "/etc/certs", HostPath: "/certs"}),
+			WithSecrets(k8sclient.SecretRef{Secret: "tls", MountPath: "/etc/certs"}),
+		},
+		"image with template image": {
+			WithTemplateSpec(templates.Template{Name: "ml", Language: "python", Image: "registry.example.com/ml:1"}),
+			WithImage("python:3.12"),
+		},
+	}
+
+	for name, opts := range cases {
+		if _, err := newSandboxConfig(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestUnknownLegacyOptionIsNamed(t *testing.T) {
+	_, err := newSandboxConfig([]SandboxOption{{Name: "lables", Value: map[string]string{}}})
+	if err == nil || !strings.Contains(err.Error(), `"lables"`) {
+		t.Fatalf("expected the misspelled option to be named, got %v", err)
+	}
+}
+
+func TestClientOptionsBuildClientOnFirstUse(t *testing.T) {
+	cfg, err := newSandboxConfig([]SandboxOption{WithClientOptions(k8sclient.ClientOptions{Kubeconfig: "/nonexistent/kubeconfig"})})
+	if err != nil {
+		t.Fatalf("expected options to apply without connecting, got %v", err)
+	}
+	if _, err := cfg.kubeClient(); err == nil {
+		t.Fatal("expected the missing kubeconfig to fail on first use")
+	}
+
+	cfg, err = newSandboxConfig([]SandboxOption{WithClientOptions(k8sclient.ClientOptions{Config: &rest.Config{Host: "https://cluster.example.com"}})})
+	if err != nil {
+		t.Fatalf("failed to apply options: %v", err)
+	}
+	first, err := cfg.kubeClient()
+	if err != nil {
+		t.Fatalf("failed to build client: %v", err)
+	}
+	if second, _ := cfg.kubeClient(); second != first {
+		t.Fatal("expected the client to be built once")
+	}
+}
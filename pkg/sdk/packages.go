@@ -0,0 +1,176 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+)
+
+// Package records a dependency installed into a sandbox
+type Package struct {
+	Language Language `json:"language"`
+	Name     string   `json:"name"`
+	// Manifest is set when Name is a dependency manifest such as requirements.txt
+	Manifest    bool      `json:"manifest,omitempty"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// InstallResult reports the outcome of a package installation
+type InstallResult struct {
+	Language Language
+	Packages []string
+	Output   string
+	ExitCode int
+	Success  bool
+}
+
+// InstallPackages installs pkgs with the package manager of lang (the
+// sandbox's own language when empty) from the workspace and records them on
+// the sandbox. A failed installation is reported through the result; an
+// error means the installation could not be attempted.
+func (s *sandboxedImpl) InstallPackages(lang Language, pkgs []string) (*InstallResult, error) {
+	if lang == "" {
+		lang = Language(s.lc.language)
+	}
+
+	recipe, err := templates.RecipeLookup(string(lang))
+	if err != nil {
+		return nil, err
+	}
+	if recipe.Install == "" {
+		return nil, fmt.Errorf("no package manager configured for %s", lang)
+	}
+	if err := templates.ValidatePackages(pkgs); err != nil {
+		return nil, err
+	}
+
+	client, err := s.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	output, exitCode, err := s.runInWorkspace(client, recipe.Install, pkgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &InstallResult{
+		Language: lang,
+		Packages: pkgs,
+		Output:   output,
+		ExitCode: exitCode,
+		Success:  exitCode == 0,
+	}
+	if !result.Success {
+		return result, nil
+	}
+
+	installed := make([]Package, 0, len(pkgs))
+	for _, name := range pkgs {
+		installed = append(installed, Package{Language: lang, Name: name, InstalledAt: time.Now().UTC()})
+	}
+	if err := s.recordPackages(client, installed); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// installManifests installs dependencies from any of the recipe's manifests
+// present in files. It returns the output of a failing installation.
+func (s *sandboxedImpl) installManifests(ctx context.Context, client *k8sclient.Client, recipe templates.Recipe, files []k8sclient.File) (*Output, error) {
+	present := map[string]bool{}
+	for _, f := range files {
+		present[path.Clean(f.Path)] = true
+	}
+
+	for _, manifest := range recipe.Manifests {
+		if !present[manifest] {
+			continue
+		}
+		if output, err := s.installManifest(ctx, client, recipe, manifest); output != nil || err != nil {
+			return output, err
+		}
+	}
+
+	return nil, nil
+}
+
+// installManifest installs the dependencies declared by a manifest in the
+// workspace. It returns the output of a failing installation.
+func (s *sandboxedImpl) installManifest(ctx context.Context, client *k8sclient.Client, recipe templates.Recipe, manifest string) (*Output, error) {
+	output, exitCode, err := s.runInWorkspaceContext(ctx, client, recipe.ManifestInstall)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return &Output{
+			Result:   output,
+			Error:    fmt.Sprintf("installing dependencies from %s failed", manifest),
+			ExitCode: exitCode,
+		}, nil
+	}
+
+	pkg := Package{Language: Language(s.lc.language), Name: manifest, Manifest: true, InstalledAt: time.Now().UTC()}
+	if err := s.recordPackages(client, []Package{pkg}); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// runInWorkspace runs script with sh from the workspace, passing args as
+// positional parameters. A non-zero exit is reported through the exit code.
+func (s *sandboxedImpl) runInWorkspace(client *k8sclient.Client, script string, args ...string) (string, int, error) {
+	return s.runInWorkspaceContext(context.Background(), client, script, args...)
+}
+
+// runInWorkspaceContext is runInWorkspace with cancellation
+func (s *sandboxedImpl) runInWorkspaceContext(ctx context.Context, client *k8sclient.Client, script string, args ...string) (string, int, error) {
+	o, err := s.workspaceOutputContext(ctx, client, script, args...)
+	if o == nil {
+		return "", 0, err
+	}
+	return o.Result, o.ExitCode, err
+}
+
+// workspaceOutputContext is runInWorkspaceContext returning the output with
+// whether it was truncated
+func (s *sandboxedImpl) workspaceOutputContext(ctx context.Context, client *k8sclient.Client, script string, args ...string) (*Output, error) {
+	o, err := s.execOutputContext(ctx, client, workspaceCommand(WorkspaceDir, script, args...), nil)
+	if err != nil {
+		if exitCode, ok := k8sclient.ExitCode(err); ok {
+			o.ExitCode = exitCode
+			return o, nil
+		}
+		return o, err
+	}
+	return o, nil
+}
+
+// workspaceCommand runs script with sh from dir, creating it if needed
+func workspaceCommand(dir, script string, args ...string) []string {
+	return append([]string{"sh", "-c", `mkdir -p "$1" && cd "$1" && shift && ` + script, "sh", dir}, args...)
+}
+
+// recordPackages remembers installed packages on the handle and on the pod,
+// so that reattached handles and forks know what was installed
+func (s *sandboxedImpl) recordPackages(client *k8sclient.Client, pkgs []Package) error {
+	s.mu.Lock()
+	s.meta.Packages = append(s.meta.Packages, pkgs...)
+	data, err := json.Marshal(s.meta.Packages)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = client.PatchPodMetadata(s.id, s.namespace(), nil, map[string]string{k8sclient.AnnotationPackages: string(data)})
+	if err != nil {
+		return fmt.Errorf("packages installed but not recorded: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package sdk
+
+import (
+	"context"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+)
+
+// ExposePort forwards a local address to port inside the sandbox, such as a
+// web server started with Exec, and returns the address as host:port. The
+// forward lasts until the sandbox is destroyed; exposing the same port again
+// returns the same address while the forward is alive.
+func (s *sandboxedImpl) ExposePort(port int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fw, ok := s.forwards[port]; ok {
+		select {
+		case <-fw.Done():
+			delete(s.forwards, port)
+		default:
+			return fw.Addr, nil
+		}
+	}
+
+	client, err := s.newClient()
+	if err != nil {
+		return "", err
+	}
+	fw, err := client.PortForward(context.Background(), s.id, s.namespace(), port)
+	if err != nil {
+		return "", err
+	}
+
+	if s.forwards == nil {
+		s.forwards = make(map[int]*k8sclient.PortForward)
+	}
+	s.forwards[port] = fw
+	return fw.Addr, nil
+}
+
+// closeForwards stops every port exposed with ExposePort
+func (s *sandboxedImpl) closeForwards() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for port, fw := range s.forwards {
+		fw.Close()
+		delete(s.forwards, port)
+	}
+}
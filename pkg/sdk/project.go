@@ -0,0 +1,184 @@
+package sdk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+)
+
+// WorkspaceDir is where projects are laid out inside a sandbox
+const WorkspaceDir = "/workspace"
+
+// Project is a multi-file program to lay out in the sandbox workspace and run
+type Project struct {
+	// Files maps paths relative to the workspace to their contents
+	Files map[string][]byte
+	// Archive is a tar, tar.gz or zip archive unpacked into the workspace
+	// after Files, so its entries win on conflict
+	Archive []byte
+	// Entrypoint is passed to the language's build-and-run recipe: a file for
+	// interpreted languages, a package for Go and a main class for Java.
+	// The recipe's default is used when empty.
+	Entrypoint string
+}
+
+// RunProject lays out the project in the workspace and runs the language's
+// build-and-run recipe from the project root
+func (s *sandboxedImpl) RunProject(project Project) (*Output, error) {
+	return s.RunProjectContext(context.Background(), project)
+}
+
+// RunProjectContext is RunProject with cancellation. Cancelling stops
+// waiting for the project; processes it started keep running in the sandbox.
+func (s *sandboxedImpl) RunProjectContext(ctx context.Context, project Project) (*Output, error) {
+	recipe, err := templates.RecipeLookup(s.lc.language)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := projectFiles(project)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("project has no files")
+	}
+
+	client, err := s.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.CopyFilesToPodContext(ctx, s.id, s.namespace(), WorkspaceDir, files); err != nil {
+		return nil, err
+	}
+
+	// Install dependencies declared by manifests shipped with the project
+	if failed, err := s.installManifests(ctx, client, recipe, files); err != nil || failed != nil {
+		return failed, err
+	}
+
+	entrypoint := project.Entrypoint
+	if entrypoint == "" {
+		entrypoint = recipe.DefaultEntrypoint
+	}
+
+	output, err := s.workspaceOutputContext(ctx, client, recipe.Script, entrypoint)
+	if err != nil {
+		return nil, err
+	}
+	if output.ExitCode != 0 {
+		output.Error = fmt.Sprintf("command terminated with exit code %d", output.ExitCode)
+	}
+	return output, nil
+}
+
+// newClient returns the client for the sandbox's driver. The client is shared
+// rather than created per call, so its connections are reused.
+func (s *sandboxedImpl) newClient() (*k8sclient.Client, error) {
+	if s.driver != "kubernetes" {
+		return nil, errors.New("unsupported driver: " + s.driver)
+	}
+	return s.cfg.kubeClient()
+}
+
+// projectFiles flattens a project's file map and archive into files to copy
+func projectFiles(project Project) ([]k8sclient.File, error) {
+	paths := make([]string, 0, len(project.Files))
+	for p := range project.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	files := make([]k8sclient.File, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, k8sclient.File{Path: p, Content: project.Files[p]})
+	}
+
+	if len(project.Archive) > 0 {
+		archived, err := unpackArchive(project.Archive)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, archived...)
+	}
+
+	return files, nil
+}
+
+// unpackArchive reads the regular files of a zip, tar or tar.gz archive
+func unpackArchive(data []byte) ([]k8sclient.File, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return unpackZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		return unpackTar(gz)
+	default:
+		return unpackTar(bytes.NewReader(data))
+	}
+}
+
+func unpackTar(r io.Reader) ([]k8sclient.File, error) {
+	var files []k8sclient.File
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			// Directories are recreated from file paths; links are not followed
+			continue
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %v", hdr.Name, err)
+		}
+		files = append(files, k8sclient.File{Path: hdr.Name, Content: content, Mode: hdr.Mode & 0o777})
+	}
+	return files, nil
+}
+
+func unpackZip(data []byte) ([]k8sclient.File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+
+	var files []k8sclient.File
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %v", zf.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %v", zf.Name, err)
+		}
+		files = append(files, k8sclient.File{Path: zf.Name, Content: content, Mode: int64(zf.Mode().Perm())})
+	}
+	return files, nil
+}
@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestProjectFilesFromMapAndZip(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	w, _ := zw.Create("pkg/util.py")
+	w.Write([]byte("def double(x):\n    return 2 * x\n"))
+	w, _ = zw.Create("main.py")
+	w.Write([]byte("from pkg.util import double\nprint(double(21))\n"))
+	zw.Close()
+
+	files, err := projectFiles(Project{
+		Files:   map[string][]byte{"pkg/__init__.py": nil, "main.py": []byte("overridden")},
+		Archive: zipBuf.Bytes(),
+	})
+	if err != nil {
+		t.Fatalf("failed to read project: %v", err)
+	}
+
+	got := map[string]string{}
+	var order []string
+	for _, f := range files {
+		got[f.Path] = string(f.Content)
+		order = append(order, f.Path)
+	}
+
+	if len(files) != 4 {
+		t.Fatalf("expected 4 files, got %v", order)
+	}
+	// Archive entries are laid out after the map, so they win on conflict
+	if order[len(order)-1] != "main.py" || got["main.py"] == "overridden" {
+		t.Fatalf("expected archive main.py to be applied last, got %v", order)
+	}
+	if got["pkg/util.py"] == "" {
+		t.Fatal("missing pkg/util.py from archive")
+	}
+}
+
+func TestProjectFilesFromTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Name: "src/main.rs", Typeflag: tar.TypeReg, Mode: 0o644, Size: 12})
+	tw.Write([]byte("fn main(){}\n"))
+	tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	tw.Close()
+	gz.Close()
+
+	files, err := projectFiles(Project{Archive: buf.Bytes()})
+	if err != nil {
+		t.Fatalf("failed to read project: %v", err)
+	}
+
+	if len(files) != 1 || files[0].Path != "src/main.rs" || string(files[0].Content) != "fn main(){}\n" {
+		t.Fatalf("expected only the regular file to be kept, got %+v", files)
+	}
+}
@@ -3,13 +3,16 @@ package sdk
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
-	"strings"
+	"sync"
 	"time"
 
-	"github.com/sashabaranov/go-openai"
+	"github.com/system32-ai/sandboxed/pkg/detect"
 	"github.com/system32-ai/sandboxed/pkg/k8sclient"
 	"github.com/system32-ai/sandboxed/pkg/k8sclient/templates"
+	"github.com/system32-ai/sandboxed/pkg/operator"
+	"github.com/system32-ai/sandboxed/pkg/testrun"
 )
 
 type Language string
@@ -22,6 +25,7 @@ const (
 	Ruby   Language = "ruby"
 	PHP    Language = "php"
 	Rust   Language = "rust"
+	Bash   Language = "bash"
 )
 
 func (l Language) GetExecScript() string {
@@ -40,6 +44,32 @@ func (l Language) GetExecScript() string {
 		return "php /tmp/exec_script.php"
 	case Rust:
 		return "rustc /tmp/exec_script.rs -o /tmp/exec_script && /tmp/exec_script"
+	case Bash:
+		return "sh /tmp/exec_script.sh"
+	default:
+		return ""
+	}
+}
+
+// ScriptPath returns where Exec writes code so that GetExecScript can run it
+func (l Language) ScriptPath() string {
+	switch l {
+	case Python:
+		return "/tmp/exec_script.sh"
+	case Go:
+		return "/tmp/exec_script.go"
+	case Node:
+		return "/tmp/exec_script.js"
+	case Java:
+		return "/tmp/ExecScript.java"
+	case Ruby:
+		return "/tmp/exec_script.rb"
+	case PHP:
+		return "/tmp/exec_script.php"
+	case Rust:
+		return "/tmp/exec_script.rs"
+	case Bash:
+		return "/tmp/exec_script.sh"
 	default:
 		return ""
 	}
@@ -61,76 +91,110 @@ func ToLanguage(lang string) (Language, error) {
 	return Language(lang), nil
 }
 
-// DetectLanguage uses GPT to analyze the code string and determine the programming language
-func DetectLanguage(code string) (Language, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", errors.New("OPENAI_API_KEY environment variable is required for automatic language detection")
-	}
-
-	client := openai.NewClient(apiKey)
-
-	prompt := `Analyze the following code and determine the primary programming language it is written in. 
-Respond with only the language name in lowercase (one of: python, go, node, java, ruby, php, rust).
-
-Code:
-` + code
-
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT4oMini,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens:   10,
-			Temperature: 0,
-		},
-	)
+// MinDetectionConfidence is the confidence at which the default detector
+// stops asking further detectors
+var MinDetectionConfidence = 0.5
 
-	if err != nil {
-		return "", err
+// ErrLanguageNotDetected is returned when no supported language is recognised
+var ErrLanguageNotDetected = detect.ErrNotDetected
+
+var (
+	detectorMu sync.Mutex
+	// customDetector replaces the environment-configured default when set
+	customDetector detect.Detector
+	envDetector    detect.Detector
+	envDetectorCfg detect.OpenAIConfig
+)
+
+// SetDetector replaces the detector used by DetectLanguage and
+// CreateSandboxAuto. Passing nil restores the default.
+func SetDetector(d detect.Detector) {
+	detectorMu.Lock()
+	defer detectorMu.Unlock()
+	customDetector = d
+}
+
+// languageDetector returns the configured detector. The default runs the
+// local heuristics, then an OpenAI-compatible model when OPENAI_API_KEY or
+// OPENAI_BASE_URL is set, with OPENAI_MODEL choosing the model.
+func languageDetector() detect.Detector {
+	detectorMu.Lock()
+	defer detectorMu.Unlock()
+
+	if customDetector != nil {
+		return customDetector
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", errors.New("no response from GPT API")
-	}
-
-	detectedLang := strings.TrimSpace(strings.ToLower(resp.Choices[0].Message.Content))
-
-	// Map the response to our Language constants
-	switch detectedLang {
-	case "python":
-		return Python, nil
-	case "go":
-		return Go, nil
-	case "node", "javascript", "js":
-		return Node, nil
-	case "java":
-		return Java, nil
-	case "ruby":
-		return Ruby, nil
-	case "php":
-		return PHP, nil
-	case "rust":
-		return Rust, nil
-	default:
-		return "", errors.New("unable to detect supported programming language from code")
+	cfg := detect.OpenAIConfig{
+		APIKey:  os.Getenv("OPENAI_API_KEY"),
+		BaseURL: os.Getenv("OPENAI_BASE_URL"),
+		Model:   os.Getenv("OPENAI_MODEL"),
+	}
+	// Rebuilt only when the environment changes, so the cache is kept
+	if envDetector == nil || cfg != envDetectorCfg {
+		detectors := []detect.Detector{detect.Heuristic{}}
+		if cfg.APIKey != "" || cfg.BaseURL != "" {
+			detectors = append(detectors, detect.NewOpenAI(cfg))
+		}
+		envDetector = detect.NewChain(MinDetectionConfidence, detectors...)
+		envDetectorCfg = cfg
+	}
+	return envDetector
+}
+
+// DetectLanguage determines the programming language of the code string
+func DetectLanguage(code string) (Language, error) {
+	result, err := DetectLanguageWithConfidence(code)
+	if err != nil {
+		return "", err
 	}
+	return Language(result.Language), nil
 }
 
-type SandboxOption struct {
-	Name  string
-	Value interface{}
+// DetectLanguageWithConfidence is DetectLanguage reporting how the language
+// was detected and with what confidence
+func DetectLanguageWithConfidence(code string) (detect.Result, error) {
+	result, err := languageDetector().Detect(context.Background(), code)
+	if err != nil {
+		return detect.Result{}, err
+	}
+	if _, err := ToLanguage(result.Language); err != nil {
+		return detect.Result{}, ErrLanguageNotDetected
+	}
+	return result, nil
 }
 
 type Sandboxed interface {
 	Run(code string) (*Output, error)
 	Exec(commands string) (*Output, error)
+	RunWithEnv(code string, env map[string]string) (*Output, error)
+	ExecWithEnv(commands string, env map[string]string) (*Output, error)
+	RunProject(project Project) (*Output, error)
+	RunProjectContext(ctx context.Context, project Project) (*Output, error)
+	InstallPackages(lang Language, pkgs []string) (*InstallResult, error)
+	ExposePort(port int) (string, error)
+	Snapshot() ([]byte, error)
+	Restore(archive []byte) error
+	CloneRepo(url, ref, path string, opts ...CloneOption) (string, error)
+	ApplyPatch(path, patch string) error
+	Diff(path string) (string, error)
+	RunTests(opts TestOptions) (*testrun.Result, error)
 	Destroy() error
+	Info() SandboxInfo
+}
+
+// SandboxInfo identifies a sandbox and where it runs
+type SandboxInfo struct {
+	ID        string
+	Name      string
+	Language  Language
+	Namespace string
+	Owner     string
+	Labels    map[string]string
+	CreatedAt time.Time
+	Packages  []Package
+	// Template names the environment template the sandbox was created from
+	Template string
 }
 
 func NewSandboxed() Sandboxed {
@@ -149,23 +213,47 @@ type sandboxedImpl struct {
 	driver string
 	id     string
 	lc     *LanguageContainer
+	cfg    *sandboxConfig
+	// meta holds metadata read back from the cluster when reattaching,
+	// and the packages installed since
+	mu   sync.Mutex
+	meta SandboxInfo
+	// forwards holds the ports exposed with ExposePort
+	forwards map[int]*k8sclient.PortForward
+
+	// secrets caches the values redacted from output, read once per handle
+	secretsMu     sync.Mutex
+	secrets       []string
+	secretsLoaded bool
 }
 
 func CreateSandbox(name string, lang Language, opts ...SandboxOption) (Sandboxed, error) {
+	cfg, err := newSandboxConfig(opts)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &sandboxedImpl{
 		driver: "kubernetes",
+		cfg:    cfg,
 	}
 
-	var client *k8sclient.Client
-	var err error
+	tpl := cfg.template
+	if tpl != nil {
+		if lang == "" {
+			lang = Language(tpl.Language)
+		} else if string(lang) != tpl.Language {
+			return nil, fmt.Errorf("template %s is for %s, not %s", tpl.Name, tpl.Language, lang)
+		}
+		s.meta.Template = tpl.Name
+	}
 
 	image, err := templates.LanguageLookup(string(lang))
 	if err != nil {
 		return nil, err
 	}
 
-	lcVal := &LanguageContainer{
+	s.lc = &LanguageContainer{
 		name:     name,
 		language: string(lang),
 		image:    image,
@@ -173,61 +261,101 @@ func CreateSandbox(name string, lang Language, opts ...SandboxOption) (Sandboxed
 		opts:     opts,
 	}
 
-	s.lc = lcVal
-
-	var mapOptions = make(map[string]interface{})
-	for _, opt := range s.lc.opts {
-		mapOptions[opt.Name] = opt.Value
-	}
-
-	var namespace string
 	var podName = "sandboxed-" + s.lc.name
 
-	ns, ok := mapOptions["namespace"].(string)
-	if ok {
-		namespace = ns
-	} else {
-		namespace = "default"
+	client, err := s.newClient()
+	if err != nil {
+		return nil, err
 	}
 
-	if s.driver == "kubernetes" {
-		client, err = k8sclient.NewClient(namespace)
-		if err != nil {
+	if cfg.operator {
+		if _, err := s.createResource(client); err != nil {
 			return nil, err
 		}
-	} else {
-		return nil, errors.New("unsupported driver: " + s.driver)
+		return s.seedWorkspace()
 	}
 
-	var pod k8sclient.PodSpec
-
-	pod.Labels, ok = mapOptions["labels"].(map[string]string)
-	if !ok {
-		pod.Labels = make(map[string]string)
-	} else {
-		for k, v := range pod.Labels {
-			pod.Labels[k] = v
-		}
-		pod.Labels["created-by"] = "sandboxed-sdk"
+	// Copy the labels so the caller's map is never modified
+	pod := k8sclient.PodSpec{
+		Name:      podName,
+		Namespace: cfg.namespace,
+		Image:     s.lc.image,
+		Command:   []string{"sh", "-c", "tail -f /dev/null"},
+		Labels:    make(map[string]string, len(cfg.labels)+3),
+		Env:       cfg.env,
+		Secrets:   cfg.secrets,
+		Volumes:   cfg.volumes,
 	}
+	for k, v := range cfg.labels {
+		pod.Labels[k] = v
+	}
+	pod.Labels[k8sclient.LabelManaged] = "true"
+	pod.Labels[k8sclient.LabelName] = s.lc.name
+	pod.Labels[k8sclient.LabelLanguage] = s.lc.language
 
-	pod.Image = s.lc.image
-	pod.Name = podName
-	pod.Namespace = namespace
-	pod.Command = []string{"sh", "-c", "tail -f /dev/null"}
+	// Explicit options take precedence over the template
+	if tpl != nil {
+		tpl.Apply(&pod)
+	}
+	if cfg.image != "" {
+		pod.Image = cfg.image
+	}
+	if cfg.resources != nil {
+		pod.Resources = *cfg.resources
+	}
+	pod.RuntimeClassName = cfg.runtimeClass
 
 	_, err = client.CreatePod(pod)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := client.WaitForPodReady(podName, pod.Namespace, 120*time.Second); err != nil {
+	if err := client.WaitForPodReady(podName, pod.Namespace, cfg.timeout); err != nil {
 		return nil, err
 	}
 
 	s.id = podName
 
-	return s, nil
+	if tpl != nil {
+		if err := ApplyTemplate(s, *tpl); err != nil {
+			_ = s.Destroy()
+			return nil, err
+		}
+	}
+
+	return s.seedWorkspace()
+}
+
+// CreateSandboxFromTemplate creates a sandbox from a registered environment
+// template, in the template's language
+func CreateSandboxFromTemplate(name, template string, opts ...SandboxOption) (Sandboxed, error) {
+	opts = append(opts, WithTemplate(template))
+	return CreateSandbox(name, "", opts...)
+}
+
+// ApplyTemplate installs a template's packages and runs its setup commands in
+// a sandbox created from it
+func ApplyTemplate(s Sandboxed, tpl templates.Template) error {
+	if len(tpl.Packages) > 0 {
+		result, err := s.InstallPackages(Language(tpl.Language), tpl.Packages)
+		if err != nil {
+			return fmt.Errorf("template %s: %v", tpl.Name, err)
+		}
+		if !result.Success {
+			return fmt.Errorf("template %s: installing packages failed with exit code %d: %s", tpl.Name, result.ExitCode, result.Output)
+		}
+	}
+
+	for _, command := range tpl.Setup {
+		output, err := s.Run(command)
+		if err != nil {
+			return fmt.Errorf("template %s: setup command %q failed: %v", tpl.Name, command, err)
+		}
+		if output.ExitCode != 0 {
+			return fmt.Errorf("template %s: setup command %q failed with exit code %d: %s", tpl.Name, command, output.ExitCode, output.Result)
+		}
+	}
+	return nil
 }
 
 // CreateSandboxAuto creates a sandbox with automatic language detection from the provided code
@@ -240,108 +368,125 @@ func CreateSandboxAuto(name string, code string, opts ...SandboxOption) (Sandbox
 	return CreateSandbox(name, lang, opts...)
 }
 
+// NewInstance reattaches to the existing sandbox pod id, reading its name,
+// language and metadata back from the pod's labels and annotations. The
+// namespace is taken from WithNamespace and defaults to DefaultNamespace.
 func NewInstance(id string, opts ...SandboxOption) (Sandboxed, error) {
-
-	s := &sandboxedImpl{
-		driver: "kubernetes",
+	if id == "" {
+		return nil, errors.New("sandbox ID is required")
 	}
 
-	lcVal := &LanguageContainer{
-		// name:    id,
-		// language: lang,
-		// image:    image,
-		impl: s,
-		opts: opts,
+	cfg, err := newSandboxConfig(opts)
+	if err != nil {
+		return nil, err
 	}
+	namespace := cfg.namespace
 
-	s.lc = lcVal
-	s.id = id
-
-	return s, nil
-}
-
-func (s *sandboxedImpl) Run(code string) (*Output, error) {
-
-	var client *k8sclient.Client
-	var err error
-
-	var mapOptions = make(map[string]interface{})
-	for _, opt := range s.lc.opts {
-		mapOptions[opt.Name] = opt.Value
+	client, err := cfg.kubeClient()
+	if err != nil {
+		return nil, err
 	}
 
-	var namespace string
-	var podName = s.id
+	pod, err := client.GetPod(id, namespace)
+	if err != nil {
+		return nil, err
+	}
 
-	ns, ok := mapOptions["namespace"].(string)
-	if ok {
-		namespace = ns
-	} else {
-		namespace = "default"
+	info, err := infoFromPod(pod)
+	if err != nil {
+		return nil, err
 	}
 
-	if s.driver == "kubernetes" {
-		client, err = k8sclient.NewClient(namespace)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		return nil, errors.New("unsupported driver: " + s.driver)
+	return reattach(info, cfg, opts)
+}
+
+// Reattach returns a handle to an existing sandbox described by info, such as
+// one restored from a registry after a restart. No cluster call is made.
+func Reattach(info SandboxInfo, opts ...SandboxOption) (Sandboxed, error) {
+	if info.ID == "" {
+		return nil, errors.New("sandbox ID is required to reattach")
 	}
 
-	o, err := client.ExecCommand(podName, namespace, []string{"sh", "-c", code})
+	cfg, err := newSandboxConfig(opts)
 	if err != nil {
 		return nil, err
 	}
-
-	return &Output{
-		Result:   o,
-		Error:    "",
-		ExitCode: 0,
-	}, nil
+	return reattach(info, cfg, opts)
 }
 
-func (s *sandboxedImpl) Exec(commands string) (*Output, error) {
-
-	var client *k8sclient.Client
-	var err error
+// reattach is Reattach with the options already applied, so that a client
+// built from them is shared rather than built again
+func reattach(info SandboxInfo, cfg *sandboxConfig, opts []SandboxOption) (Sandboxed, error) {
+	image, err := templates.LanguageLookup(string(info.Language))
+	if err != nil {
+		return nil, err
+	}
 
-	var mapOptions = make(map[string]interface{})
-	for _, opt := range s.lc.opts {
-		mapOptions[opt.Name] = opt.Value
+	if info.Namespace != "" {
+		cfg.namespace = info.Namespace
 	}
 
-	var namespace string
-	var podName = s.id
-	ns, ok := mapOptions["namespace"].(string)
-	if ok {
-		namespace = ns
-	} else {
-		namespace = "default"
+	s := &sandboxedImpl{
+		driver: "kubernetes",
+		id:     info.ID,
+		cfg:    cfg,
+		meta:   info,
+	}
+	s.lc = &LanguageContainer{
+		name:     info.Name,
+		language: string(info.Language),
+		image:    image,
+		impl:     s,
+		opts:     opts,
 	}
 
-	if s.driver == "kubernetes" {
-		client, err = k8sclient.NewClient(namespace)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		return nil, errors.New("unsupported driver: " + s.driver)
+	return s, nil
+}
+
+func (s *sandboxedImpl) Info() SandboxInfo {
+	s.mu.Lock()
+	info := s.meta
+	info.Packages = append([]Package(nil), s.meta.Packages...)
+	s.mu.Unlock()
+
+	info.ID = s.id
+	info.Name = s.lc.name
+	info.Language = Language(s.lc.language)
+	info.Namespace = s.namespace()
+	return info
+}
+
+// namespace returns the sandbox's namespace, defaulting to DefaultNamespace
+func (s *sandboxedImpl) namespace() string {
+	if s.cfg == nil {
+		return DefaultNamespace
 	}
+	return s.cfg.namespace
+}
 
-	// Write commands to a temporary file and execute it
-	filename := "/tmp/exec_script.sh"
-	writeCmd := []string{"sh", "-c", "cat > " + filename + " << 'EOF'\n" + commands + "\nEOF"}
+func (s *sandboxedImpl) Run(code string) (*Output, error) {
+	return s.RunWithEnv(code, nil)
+}
 
-	// First, write the commands to a file
-	_, err = client.ExecCommand(podName, namespace, writeCmd)
+// RunWithEnv runs a shell command with additional environment variables. A
+// non-zero exit is reported through the output's ExitCode, not as an error.
+func (s *sandboxedImpl) RunWithEnv(code string, env map[string]string) (*Output, error) {
+	client, err := s.newClient()
 	if err != nil {
 		return nil, err
 	}
 
-	// Make the file executable
-	chmodCmd := []string{"sh", "-c", "chmod +x " + filename}
-	_, err = client.ExecCommand(podName, namespace, chmodCmd)
+	return exitOutput(s.execOutputContext(context.Background(), client, []string{"sh", "-c", code}, env))
+}
+
+func (s *sandboxedImpl) Exec(commands string) (*Output, error) {
+	return s.ExecWithEnv(commands, nil)
+}
+
+// ExecWithEnv runs code with additional environment variables. A non-zero
+// exit is reported through the output's ExitCode, not as an error.
+func (s *sandboxedImpl) ExecWithEnv(commands string, env map[string]string) (*Output, error) {
+	client, err := s.newClient()
 	if err != nil {
 		return nil, err
 	}
@@ -351,48 +496,90 @@ func (s *sandboxedImpl) Exec(commands string) (*Output, error) {
 		return nil, err
 	}
 
-	// Execute the file
-	o, err := client.ExecCommand(podName, namespace, []string{"sh", "-c", lt.GetExecScript()})
+	// Write the code to a file over stdin; it is never interpolated into a shell command
+	err = client.WriteFile(s.id, s.namespace(), lt.ScriptPath(), []byte(commands), 0o755)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Output{
-		Result:   o,
-		Error:    "",
-		ExitCode: 0,
-	}, nil
+	// Execute the file
+	return exitOutput(s.execOutputContext(context.Background(), client, []string{"sh", "-c", lt.GetExecScript()}, env))
 }
 
-func (s *sandboxedImpl) Destroy() error {
+// exitOutput turns a non-zero exit into the output's ExitCode and Error,
+// keeping the output. Other errors are returned as they are.
+func exitOutput(o *Output, err error) (*Output, error) {
+	if err == nil {
+		return o, nil
+	}
+	if exitCode, ok := k8sclient.ExitCode(err); ok && o != nil {
+		o.ExitCode = exitCode
+		o.Error = fmt.Sprintf("command terminated with exit code %d", exitCode)
+		return o, nil
+	}
+	return nil, err
+}
+
+// execCommand runs command in the sandbox with env added to its environment.
+// Values of the secrets the sandbox references are redacted from the output.
+func (s *sandboxedImpl) execCommand(client *k8sclient.Client, command []string, env map[string]string) (string, error) {
+	return s.execCommandContext(context.Background(), client, command, env)
+}
 
-	var mapOptions = make(map[string]interface{})
-	for _, opt := range s.lc.opts {
-		mapOptions[opt.Name] = opt.Value
+// execCommandContext is execCommand with cancellation
+func (s *sandboxedImpl) execCommandContext(ctx context.Context, client *k8sclient.Client, command []string, env map[string]string) (string, error) {
+	o, err := s.execOutputContext(ctx, client, command, env)
+	if o == nil {
+		return "", err
 	}
+	return o.Result, err
+}
 
-	var namespace string
+// execOutputContext is execCommandContext returning the output with whether
+// it was truncated. A non-zero exit is an error, with the output returned
+// alongside.
+func (s *sandboxedImpl) execOutputContext(ctx context.Context, client *k8sclient.Client, command []string, env map[string]string) (*Output, error) {
+	if err := k8sclient.ValidateEnv(env); err != nil {
+		return nil, err
+	}
 
-	ns, ok := mapOptions["namespace"].(string)
-	if ok {
-		namespace = ns
-	} else {
-		namespace = "default"
+	// The command does not run when the secrets cannot be read, rather than
+	// risk leaking them
+	secrets, err := s.secretValues(ctx, client)
+	if err != nil {
+		return nil, err
 	}
+	o, execErr := client.ExecCommandOutputSecretsContext(ctx, s.id, s.namespace(), k8sclient.WithEnv(env, command), secrets)
+	return &Output{
+		Result:     o.Text,
+		Truncated:  o.Truncated,
+		OutputFile: o.SpillFile,
+	}, execErr
+}
 
-	var client *k8sclient.Client
-	var err error
+// secretValues returns the values of the secrets the sandbox references,
+// reading them on first use. A pod's secret references cannot change.
+func (s *sandboxedImpl) secretValues(ctx context.Context, client *k8sclient.Client) ([]string, error) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
 
-	if s.driver == "kubernetes" {
-		client, err = k8sclient.NewClient(namespace)
+	if !s.secretsLoaded {
+		values, err := client.PodSecretValues(ctx, s.id, s.namespace())
 		if err != nil {
-			return err
+			return nil, err
 		}
-	} else {
-		return errors.New("unsupported driver: " + s.driver)
+		s.secrets, s.secretsLoaded = values, true
 	}
+	return s.secrets, nil
+}
 
-	podName := "sandboxed-" + s.lc.name
+func (s *sandboxedImpl) Destroy() error {
+	client, err := s.newClient()
+	if err != nil {
+		return err
+	}
+	s.closeForwards()
 
-	return client.ForceDeletePod(podName, namespace)
+	// A pod owned by a Sandbox resource is destroyed through the resource
+	return operator.DestroyPod(context.Background(), client, s.id, s.namespace(), true)
 }
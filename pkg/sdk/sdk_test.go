@@ -1,9 +1,12 @@
 package sdk_test
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 
+	"github.com/system32-ai/sandboxed/pkg/detect"
 	"github.com/system32-ai/sandboxed/pkg/sdk"
 )
 
@@ -44,20 +47,10 @@ func TestCreateSandboxAuto_NoAPIKey(t *testing.T) {
 		}
 	}()
 
-	pythonCode := `
-import sys
-print("Hello from Python!")
-print(f"Python version: {sys.version}")
-`
-
-	_, err := sdk.CreateSandboxAuto("test-auto", pythonCode)
-	if err == nil {
-		t.Fatal("expected error when no OPENAI_API_KEY is set")
-	}
-
-	expectedError := "OPENAI_API_KEY environment variable is required"
-	if err.Error() != expectedError {
-		t.Fatalf("expected error '%s', got '%s'", expectedError, err.Error())
+	// Nothing recognisable, so detection fails before any cluster call
+	_, err := sdk.CreateSandboxAuto("test-auto", "hello world")
+	if !errors.Is(err, sdk.ErrLanguageNotDetected) {
+		t.Fatalf("expected ErrLanguageNotDetected, got %v", err)
 	}
 }
 
@@ -71,15 +64,44 @@ func TestDetectLanguage_NoAPIKey(t *testing.T) {
 		}
 	}()
 
-	pythonCode := `print("Hello, World!")`
+	pythonCode := `
+import sys
+print("Hello from Python!")
+print(f"Python version: {sys.version}")
+`
+
+	lang, err := sdk.DetectLanguage(pythonCode)
+	if err != nil {
+		t.Fatalf("expected offline detection to succeed: %v", err)
+	}
+	if lang != sdk.Python {
+		t.Fatalf("expected python, got %s", lang)
+	}
+
+	result, err := sdk.DetectLanguageWithConfidence(pythonCode)
+	if err != nil || result.Reason != "signatures" || result.Confidence < sdk.MinDetectionConfidence {
+		t.Fatalf("expected a confident local result, got %+v, %v", result, err)
+	}
+}
+
+type fixedDetector struct{ lang string }
+
+func (d fixedDetector) Detect(context.Context, string) (detect.Result, error) {
+	return detect.Result{Language: d.lang, Confidence: 1, Reason: "fixed"}, nil
+}
+
+func TestSetDetector(t *testing.T) {
+	sdk.SetDetector(fixedDetector{lang: "rust"})
+	defer sdk.SetDetector(nil)
 
-	_, err := sdk.DetectLanguage(pythonCode)
-	if err == nil {
-		t.Fatal("expected error when no OPENAI_API_KEY is set")
+	lang, err := sdk.DetectLanguage(`print("hi")`)
+	if err != nil || lang != sdk.Rust {
+		t.Fatalf("expected the custom detector's answer, got %s, %v", lang, err)
 	}
 
-	expectedError := "OPENAI_API_KEY environment variable is required"
-	if err.Error() != expectedError {
-		t.Fatalf("expected error '%s', got '%s'", expectedError, err.Error())
+	// Answers outside the supported languages are rejected
+	sdk.SetDetector(fixedDetector{lang: "cobol"})
+	if _, err := sdk.DetectLanguage("x"); !errors.Is(err, sdk.ErrLanguageNotDetected) {
+		t.Fatalf("expected ErrLanguageNotDetected, got %v", err)
 	}
 }
@@ -0,0 +1,86 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/snapshot"
+)
+
+// Snapshot captures the sandbox's workspace as a gzipped tar archive. Only
+// the workspace is captured; installed packages are reinstalled by templates.
+// Workspaces whose archive is larger than snapshot.MaxSize fail with
+// snapshot.ErrTooLarge.
+func (s *sandboxedImpl) Snapshot() ([]byte, error) {
+	client, err := s.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// The capture is stopped as soon as the archive is too large
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buf := snapshot.NewBuffer(cancel)
+	err = client.ArchiveDirFromPod(ctx, s.id, s.namespace(), WorkspaceDir, buf)
+	if tooLarge := buf.Err(); tooLarge != nil {
+		return nil, tooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore unpacks a snapshot archive into the workspace. Files in the
+// archive replace existing ones; other files are left in place.
+func (s *sandboxedImpl) Restore(archive []byte) error {
+	client, err := s.newClient()
+	if err != nil {
+		return err
+	}
+	return client.ExtractArchiveToPod(context.Background(), s.id, s.namespace(), WorkspaceDir, bytes.NewReader(archive))
+}
+
+// seedWorkspace restores the WithSnapshot archive into a new sandbox,
+// destroying the sandbox if that fails
+func (s *sandboxedImpl) seedWorkspace() (Sandboxed, error) {
+	if s.cfg.snapshot == nil {
+		return s, nil
+	}
+	if err := s.Restore(s.cfg.snapshot); err != nil {
+		_ = s.Destroy()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveSnapshot captures a sandbox's workspace into store and returns the
+// stored snapshot's description
+func SaveSnapshot(store snapshot.Store, s Sandboxed) (snapshot.Info, error) {
+	archive, err := s.Snapshot()
+	if err != nil {
+		return snapshot.Info{}, err
+	}
+
+	info := s.Info()
+	name := info.Name
+	if name == "" {
+		name = info.ID
+	}
+	return snapshot.Save(context.Background(), store, snapshot.Info{
+		ID:       snapshot.NewID(name, time.Now()),
+		Sandbox:  name,
+		Language: string(info.Language),
+	}, archive)
+}
+
+// CreateSandboxFromSnapshot creates a sandbox whose workspace is seeded from
+// a stored snapshot. The sandbox has the snapshot's language.
+func CreateSandboxFromSnapshot(name string, store snapshot.Store, id string, opts ...SandboxOption) (Sandboxed, error) {
+	info, archive, err := snapshot.Load(context.Background(), store, id)
+	if err != nil {
+		return nil, err
+	}
+	return CreateSandbox(name, Language(info.Language), append(opts, WithSnapshot(archive))...)
+}
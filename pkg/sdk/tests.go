@@ -0,0 +1,182 @@
+package sdk
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/system32-ai/sandboxed/pkg/k8sclient"
+	"github.com/system32-ai/sandboxed/pkg/testrun"
+)
+
+// testResultsTemplate names the directory each test run writes its reports
+// to in the sandbox, so concurrent runs do not share one
+const testResultsTemplate = "/tmp/sandboxed-tests.XXXXXX"
+
+// TestOptions configures RunTests
+type TestOptions struct {
+	// Framework is detected from the project's files when empty, falling
+	// back to the sandbox's language
+	Framework testrun.Framework
+	// Path is the project directory relative to the workspace
+	Path string
+	// Args are passed to the test runner, such as test names or filters
+	Args []string
+}
+
+// RunTests runs a project's tests with a machine-readable reporter and
+// returns the result of each test. Failing tests are not an error; the
+// result's Success reports them. The framework must be installed in the
+// sandbox image.
+func (s *sandboxedImpl) RunTests(opts TestOptions) (*testrun.Result, error) {
+	client, err := s.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := repoDir(opts.Path)
+	framework := opts.Framework
+	if framework == "" {
+		output, _, err := s.runInWorkspace(client, `cd "$1" && `+testrun.MarkerScript(), dir)
+		if err != nil {
+			return nil, err
+		}
+		var present []string
+		for _, line := range strings.Split(output, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				present = append(present, line)
+			}
+		}
+		if framework, err = testrun.Detect(present, s.lc.language); err != nil {
+			return nil, err
+		}
+	}
+
+	script, err := testrun.Script(framework)
+	if err != nil {
+		return nil, err
+	}
+	results, exitCode, err := s.runInWorkspace(client, `mktemp -d "$1"`, testResultsTemplate)
+	if err != nil {
+		return nil, err
+	}
+	results = strings.TrimSpace(results)
+	if exitCode != 0 || !strings.HasPrefix(results, strings.TrimSuffix(testResultsTemplate, "XXXXXX")) {
+		return nil, fmt.Errorf("failed to create the test results directory: %s", results)
+	}
+	defer client.RemoveFromPod(context.Background(), s.id, s.namespace(), results)
+
+	args := append([]string{dir, results}, opts.Args...)
+	output, exitCode, err := s.runInWorkspace(client, `cd "$1" && shift && `+script, args...)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("test run failed with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+
+	// Cargo's tests are read from its output, so it is only capped once parsed
+	limit := k8sclient.CurrentOutputLimits().Limit()
+	if framework == testrun.Cargo {
+		limit = 0
+	}
+	files, truncated, err := s.testResults(client, results, limit)
+	if err != nil {
+		return nil, err
+	}
+	result, err := testrun.Parse(framework, files)
+	if err != nil {
+		return nil, err
+	}
+	capped := k8sclient.NewCappedBuffer(k8sclient.CurrentOutputLimits().Limit())
+	capped.Write([]byte(result.Output))
+	result.Output, result.Truncated = capped.String(), truncated || capped.Truncated()
+	return s.redactResult(client, result)
+}
+
+// testResults reads the files the test runner wrote to dir, keyed by name.
+// With limit set, the runner's output is capped at limit bytes and the
+// second result reports whether it was truncated.
+func (s *sandboxedImpl) testResults(client *k8sclient.Client, dir string, limit int) (map[string][]byte, bool, error) {
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := client.ArchiveDirFromPod(context.Background(), s.id, s.namespace(), dir, w)
+		w.CloseWithError(err)
+		done <- err
+	}()
+
+	files, truncated, err := readTestResults(r, limit)
+	if err == nil {
+		// The archive ends with padding the tar reader leaves unread
+		_, err = io.Copy(io.Discard, r)
+	}
+	// Stop the archive early when reading failed
+	r.Close()
+	if archiveErr := <-done; archiveErr != nil && err == nil {
+		err = archiveErr
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read test results: %w", err)
+	}
+	return files, truncated, nil
+}
+
+// readTestResults reads a gzipped tar archive of test results, keyed by
+// file name. With limit set, testrun.OutputFile is capped at limit bytes.
+func readTestResults(r io.Reader, limit int) (map[string][]byte, bool, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid gzip archive: %v", err)
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	truncated := false
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, truncated, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid tar archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Base(hdr.Name)
+		if name == testrun.OutputFile && limit > 0 {
+			output := k8sclient.NewCappedBuffer(limit)
+			if _, err := io.Copy(output, tr); err != nil {
+				return nil, false, fmt.Errorf("failed to read %s from archive: %v", hdr.Name, err)
+			}
+			files[name], truncated = []byte(output.String()), output.Truncated()
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s from archive: %v", hdr.Name, err)
+		}
+		files[name] = content
+	}
+}
+
+// redactResult removes the values of the sandbox's secrets from what the
+// tests printed
+func (s *sandboxedImpl) redactResult(client *k8sclient.Client, result *testrun.Result) (*testrun.Result, error) {
+	secrets, err := s.secretValues(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	result.Output = k8sclient.Redact(result.Output, secrets)
+	for i := range result.Tests {
+		result.Tests[i].Message = k8sclient.Redact(result.Tests[i].Message, secrets)
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package sdk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/system32-ai/sandboxed/pkg/testrun"
+)
+
+func TestReadTestResults(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"./" + testrun.OutputFile:   strings.Repeat("x", 100),
+		"./" + testrun.ExitCodeFile: "1\n",
+		"./report.json":             `{"tests": []}`,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+
+	files, truncated, err := readTestResults(bytes.NewReader(buf.Bytes()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated || len(files[testrun.OutputFile]) >= 100 {
+		t.Fatalf("expected the output to be capped, got %q", files[testrun.OutputFile])
+	}
+	if string(files[testrun.ExitCodeFile]) != "1\n" || string(files["report.json"]) != `{"tests": []}` {
+		t.Fatalf("expected reports to be read whole, got %q", files)
+	}
+
+	files, truncated, err = readTestResults(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil || truncated || len(files[testrun.OutputFile]) != 100 {
+		t.Fatalf("expected the output to be read whole without a limit, got %d bytes, %v", len(files[testrun.OutputFile]), err)
+	}
+}
@@ -0,0 +1,221 @@
+// Package snapshot stores sandbox workspace snapshots: gzipped tar archives
+// of a sandbox's workspace, kept with a small JSON record describing them
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound is returned for snapshots a store does not hold
+var ErrNotFound = errors.New("snapshot not found")
+
+// ErrTooLarge is returned for archives larger than MaxSize
+var ErrTooLarge = errors.New("snapshot archive is too large")
+
+// DefaultMaxSize is the largest archive handled when no maximum is set.
+// Archives are held in memory while they are captured, stored and loaded.
+const DefaultMaxSize = 256 << 20
+
+var maxSize atomic.Int64
+
+// SetMaxSize caps the archives captured, stored and loaded; zero restores
+// DefaultMaxSize
+func SetMaxSize(n int64) error {
+	if n < 0 {
+		return fmt.Errorf("invalid maximum snapshot size %d", n)
+	}
+	maxSize.Store(n)
+	return nil
+}
+
+// MaxSize returns the cap set by SetMaxSize
+func MaxSize() int64 {
+	if n := maxSize.Load(); n > 0 {
+		return n
+	}
+	return DefaultMaxSize
+}
+
+func tooLarge(size int64) error {
+	return fmt.Errorf("%w: %d bytes, the maximum is %d", ErrTooLarge, size, MaxSize())
+}
+
+// Buffer collects an archive in memory, up to MaxSize. Past that, writes are
+// discarded and Err reports ErrTooLarge; the onExceed function given to
+// NewBuffer is called once so the capture can be stopped.
+type Buffer struct {
+	buf      bytes.Buffer
+	max      int64
+	size     int64
+	onExceed func()
+	once     sync.Once
+}
+
+// NewBuffer returns an empty Buffer. onExceed may be nil.
+func NewBuffer(onExceed func()) *Buffer {
+	return &Buffer{max: MaxSize(), onExceed: onExceed}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	if b.size > b.max {
+		b.buf.Reset()
+		if b.onExceed != nil {
+			b.once.Do(b.onExceed)
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the archive, or nil once it grew past MaxSize
+func (b *Buffer) Bytes() []byte {
+	if b.size > b.max {
+		return nil
+	}
+	return b.buf.Bytes()
+}
+
+// Err returns ErrTooLarge, wrapped, once the archive grew past MaxSize
+func (b *Buffer) Err() error {
+	if b.size > b.max {
+		return tooLarge(b.size)
+	}
+	return nil
+}
+
+// Info describes a stored snapshot
+type Info struct {
+	ID string `json:"id"`
+	// Sandbox and Language identify the sandbox the snapshot was taken from;
+	// a sandbox restored from it defaults to the same language
+	Sandbox   string    `json:"sandbox"`
+	Language  string    `json:"language"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps blobs by key. Implementations are safe for concurrent use.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns ErrNotFound, possibly wrapped, for missing keys
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// NewID returns an ID for a new snapshot of sandbox
+func NewID(sandbox string, now time.Time) string {
+	return fmt.Sprintf("%s-%d", sandbox, now.UnixNano())
+}
+
+// ValidateID rejects IDs that could address keys outside the snapshots, such
+// as ones containing path separators
+func ValidateID(id string) error {
+	if len(id) > 253 || !idPattern.MatchString(id) {
+		return fmt.Errorf("invalid snapshot id %q", id)
+	}
+	return nil
+}
+
+func archiveKey(id string) string { return id + ".tar.gz" }
+func infoKey(id string) string    { return id + ".json" }
+
+// Save stores archive and its record. Size and CreatedAt are filled in when
+// unset.
+func Save(ctx context.Context, store Store, info Info, archive []byte) (Info, error) {
+	if err := ValidateID(info.ID); err != nil {
+		return info, err
+	}
+	if int64(len(archive)) > MaxSize() {
+		return info, tooLarge(int64(len(archive)))
+	}
+	info.Size = int64(len(archive))
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = time.Now().UTC()
+	}
+
+	record, err := json.Marshal(info)
+	if err != nil {
+		return info, err
+	}
+	// The record is written last so a snapshot is never listed half-stored
+	if err := store.Put(ctx, archiveKey(info.ID), archive); err != nil {
+		return info, fmt.Errorf("failed to store snapshot %s: %w", info.ID, err)
+	}
+	if err := store.Put(ctx, infoKey(info.ID), record); err != nil {
+		return info, fmt.Errorf("failed to store snapshot %s: %w", info.ID, err)
+	}
+	return info, nil
+}
+
+// Stat reads a snapshot's record
+func Stat(ctx context.Context, store Store, id string) (Info, error) {
+	if err := ValidateID(id); err != nil {
+		return Info{}, err
+	}
+
+	r, err := store.Get(ctx, infoKey(id))
+	if err != nil {
+		return Info{}, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	defer r.Close()
+
+	var info Info
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return Info{}, fmt.Errorf("invalid record for snapshot %s: %v", id, err)
+	}
+	return info, nil
+}
+
+// Load reads a snapshot's record and archive. Archives larger than MaxSize
+// are not read.
+func Load(ctx context.Context, store Store, id string) (Info, []byte, error) {
+	info, err := Stat(ctx, store, id)
+	if err != nil {
+		return Info{}, nil, err
+	}
+	if info.Size > MaxSize() {
+		return Info{}, nil, fmt.Errorf("snapshot %s: %w", id, tooLarge(info.Size))
+	}
+
+	r, err := store.Get(ctx, archiveKey(id))
+	if err != nil {
+		return Info{}, nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	defer r.Close()
+
+	// The record's size is not trusted to bound the read
+	buf := NewBuffer(nil)
+	if _, err := io.Copy(buf, io.LimitReader(r, MaxSize()+1)); err != nil {
+		return Info{}, nil, fmt.Errorf("failed to read snapshot %s: %v", id, err)
+	}
+	if err := buf.Err(); err != nil {
+		return Info{}, nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return info, buf.Bytes(), nil
+}
+
+// Delete removes a snapshot's record and archive
+func Delete(ctx context.Context, store Store, id string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, infoKey(id)); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %w", id, err)
+	}
+	if err := store.Delete(ctx, archiveKey(id)); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package testrun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// junitSuite is a <testsuites> or <testsuite> element; suites nest
+type junitSuite struct {
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (m *junitMessage) String() string {
+	text := strings.TrimSpace(m.Text)
+	if m.Message == "" || m.Message == text {
+		return text
+	}
+	if text == "" {
+		return m.Message
+	}
+	return m.Message + "\n" + text
+}
+
+// parseJUnitXML reads a JUnit XML report, as written by pytest, Maven
+// Surefire and Gradle
+func parseJUnitXML(data []byte) ([]TestCase, error) {
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	var tests []TestCase
+	var walk func(s junitSuite)
+	walk = func(s junitSuite) {
+		for _, c := range s.Cases {
+			t := TestCase{Name: c.Name, Suite: c.Classname, Status: StatusPassed}
+			t.Duration, _ = strconv.ParseFloat(c.Time, 64)
+			switch {
+			case c.Failure != nil:
+				t.Status, t.Message = StatusFailed, c.Failure.String()
+			case c.Error != nil:
+				t.Status, t.Message = StatusFailed, c.Error.String()
+			case c.Skipped != nil:
+				t.Status, t.Message = StatusSkipped, c.Skipped.String()
+			}
+			tests = append(tests, t)
+		}
+		for _, child := range s.Suites {
+			walk(child)
+		}
+	}
+	walk(root)
+	return tests, nil
+}
+
+// goEvent is a line of go test -json output
+type goEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+	// ImportPath identifies the package of build output, as "pkg" or
+	// "pkg [pkg.test]"
+	ImportPath string
+}
+
+// parseGoTest reads go test -json output. It returns the tests and the
+// output they printed. A package that fails without a failing test, such as
+// one that does not build, is reported as a failed test named after it.
+func parseGoTest(data []byte) ([]TestCase, string, error) {
+	type key struct{ pkg, test string }
+	outputs := map[key]*strings.Builder{}
+	failedTests := map[string]bool{}
+
+	var tests []TestCase
+	var all strings.Builder
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e goEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			// go test prints some errors, such as for bad flags, as plain text
+			all.Write(line)
+			all.WriteByte('\n')
+			continue
+		}
+
+		k := key{e.Package, e.Test}
+		if e.Action == "build-output" {
+			pkg, _, _ := strings.Cut(e.ImportPath, " ")
+			k = key{pkg, ""}
+		}
+		switch e.Action {
+		case "output", "build-output":
+			all.WriteString(e.Output)
+			if outputs[k] == nil {
+				outputs[k] = &strings.Builder{}
+			}
+			outputs[k].WriteString(e.Output)
+		case "pass", "fail", "skip":
+			if e.Test == "" {
+				if e.Action == "fail" && !failedTests[e.Package] {
+					tests = append(tests, TestCase{
+						Name:     e.Package,
+						Suite:    e.Package,
+						Status:   StatusFailed,
+						Duration: e.Elapsed,
+						Message:  strings.TrimSpace(outputOf(outputs[k])),
+					})
+				}
+				continue
+			}
+
+			t := TestCase{Name: e.Test, Suite: e.Package, Status: StatusPassed, Duration: e.Elapsed}
+			switch e.Action {
+			case "fail":
+				t.Status = StatusFailed
+				t.Message = strings.TrimSpace(outputOf(outputs[k]))
+				failedTests[e.Package] = true
+			case "skip":
+				t.Status = StatusSkipped
+				t.Message = strings.TrimSpace(outputOf(outputs[k]))
+			}
+			tests = append(tests, t)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	return tests, all.String(), nil
+}
+
+func outputOf(b *strings.Builder) string {
+	if b == nil {
+		return ""
+	}
+	return b.String()
+}
+
+// jestReport is the part of jest --json output that is read
+type jestReport struct {
+	TestResults []struct {
+		Name             string `json:"name"`
+		Status           string `json:"status"`
+		Message          string `json:"message"`
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Status          string   `json:"status"`
+			Duration        *float64 `json:"duration"`
+			FailureMessages []string `json:"failureMessages"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+// parseJest reads a jest --json report. A test file that fails without
+// running its tests, such as one that does not compile, is reported as a
+// failed test named after the file.
+func parseJest(data []byte) ([]TestCase, error) {
+	var report jestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var tests []TestCase
+	for _, file := range report.TestResults {
+		if len(file.AssertionResults) == 0 && file.Status == "failed" {
+			tests = append(tests, TestCase{
+				Name:    file.Name,
+				Suite:   file.Name,
+				Status:  StatusFailed,
+				Message: strings.TrimSpace(file.Message),
+			})
+			continue
+		}
+
+		for _, a := range file.AssertionResults {
+			t := TestCase{Name: a.FullName, Suite: file.Name}
+			if a.Duration != nil {
+				t.Duration = *a.Duration / 1000
+			}
+			switch a.Status {
+			case "passed":
+				t.Status = StatusPassed
+			case "failed":
+				t.Status = StatusFailed
+				t.Message = strings.TrimSpace(strings.Join(a.FailureMessages, "\n"))
+			default:
+				// pending, todo, skipped and disabled
+				t.Status = StatusSkipped
+			}
+			tests = append(tests, t)
+		}
+	}
+	return tests, nil
+}
+
+// rspecReport is the part of rspec --format json output that is read
+type rspecReport struct {
+	Messages []string `json:"messages"`
+	Examples []struct {
+		FullDescription string  `json:"full_description"`
+		Status          string  `json:"status"`
+		FilePath        string  `json:"file_path"`
+		RunTime         float64 `json:"run_time"`
+		PendingMessage  string  `json:"pending_message"`
+		Exception       *struct {
+			Class   string `json:"class"`
+			Message string `json:"message"`
+		} `json:"exception"`
+	} `json:"examples"`
+	Summary struct {
+		ErrorsOutsideOfExamples int `json:"errors_outside_of_examples_count"`
+	} `json:"summary"`
+}
+
+// parseRSpec reads an rspec --format json report. Errors outside of
+// examples, such as a spec file that does not load, are reported as one
+// failed test.
+func parseRSpec(data []byte) ([]TestCase, error) {
+	var report rspecReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var tests []TestCase
+	for _, e := range report.Examples {
+		t := TestCase{Name: e.FullDescription, Suite: e.FilePath, Duration: e.RunTime}
+		switch e.Status {
+		case "passed":
+			t.Status = StatusPassed
+		case "failed":
+			t.Status = StatusFailed
+			if e.Exception != nil {
+				t.Message = strings.TrimSpace(fmt.Sprintf("%s: %s", e.Exception.Class, e.Exception.Message))
+			}
+		default:
+			t.Status = StatusSkipped
+			t.Message = e.PendingMessage
+		}
+		tests = append(tests, t)
+	}
+
+	if report.Summary.ErrorsOutsideOfExamples > 0 {
+		tests = append(tests, TestCase{
+			Name:    "errors outside of examples",
+			Status:  StatusFailed,
+			Message: strings.TrimSpace(strings.Join(report.Messages, "\n")),
+		})
+	}
+	return tests, nil
+}
+
+var (
+	cargoSuite   = regexp.MustCompile(`^\s*(?:Running (?:unittests )?(\S+)|Doc-tests (\S+))`)
+	cargoTest    = regexp.MustCompile(`^test (.+?) \.\.\. (ok|FAILED|ignored)(?:, (.*))?$`)
+	cargoFailure = regexp.MustCompile(`^---- (.+?) stdout ----$`)
+)
+
+// parseCargo reads the output of cargo test. libtest does not report
+// durations, so they are left at zero.
+func parseCargo(output string) []TestCase {
+	type key struct{ suite, name string }
+	var tests []TestCase
+	messages := map[key]*strings.Builder{}
+
+	suite := ""
+	var capture *strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if m := cargoSuite.FindStringSubmatch(line); m != nil {
+			suite = m[1] + m[2]
+			capture = nil
+			continue
+		}
+		if m := cargoTest.FindStringSubmatch(line); m != nil {
+			t := TestCase{Name: m[1], Suite: suite, Status: StatusPassed}
+			switch m[2] {
+			case "FAILED":
+				t.Status = StatusFailed
+			case "ignored":
+				t.Status, t.Message = StatusSkipped, m[3]
+			}
+			tests = append(tests, t)
+			continue
+		}
+		if m := cargoFailure.FindStringSubmatch(line); m != nil {
+			capture = &strings.Builder{}
+			messages[key{suite, m[1]}] = capture
+			continue
+		}
+		if line == "failures:" || strings.HasPrefix(line, "test result:") {
+			capture = nil
+			continue
+		}
+		if capture != nil {
+			capture.WriteString(line + "\n")
+		}
+	}
+
+	for i, t := range tests {
+		if b := messages[key{t.Suite, t.Name}]; b != nil && t.Status == StatusFailed {
+			tests[i].Message = strings.TrimSpace(b.String())
+		}
+	}
+	return tests
+}
+
+// sortTests orders tests by suite and name, for reports read in no
+// particular order
+func sortTests(tests []TestCase) {
+	sort.SliceStable(tests, func(i, j int) bool {
+		if tests[i].Suite != tests[j].Suite {
+			return tests[i].Suite < tests[j].Suite
+		}
+		return tests[i].Name < tests[j].Name
+	})
+}
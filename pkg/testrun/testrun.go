@@ -0,0 +1,253 @@
+// Package testrun runs test suites with machine-readable reporters and reads
+// their results into a structure shared by every framework.
+package testrun
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Framework identifies a test runner
+type Framework string
+
+// Supported frameworks. JUnit runs through Maven or Gradle.
+const (
+	Pytest Framework = "pytest"
+	GoTest Framework = "go"
+	Jest   Framework = "jest"
+	RSpec  Framework = "rspec"
+	Cargo  Framework = "cargo"
+	JUnit  Framework = "junit"
+)
+
+// Frameworks lists the supported frameworks
+var Frameworks = []Framework{Pytest, GoTest, Jest, RSpec, Cargo, JUnit}
+
+// Status is the outcome of a single test
+type Status string
+
+// Test statuses. Errors in a test count as failures.
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// TestCase is the result of a single test
+type TestCase struct {
+	Name string `json:"name"`
+	// Suite groups the test: a Go package, a Python or Java class, or a file
+	Suite  string `json:"suite,omitempty"`
+	Status Status `json:"status"`
+	// Duration is in seconds, when the framework reports it
+	Duration float64 `json:"duration"`
+	// Message explains a failure or skip
+	Message string `json:"message,omitempty"`
+}
+
+// Result is the outcome of a test run
+type Result struct {
+	Framework Framework `json:"framework"`
+	// Success is set when the runner exited cleanly and no test failed
+	Success  bool       `json:"success"`
+	ExitCode int        `json:"exit_code"`
+	Passed   int        `json:"passed"`
+	Failed   int        `json:"failed"`
+	Skipped  int        `json:"skipped"`
+	Tests    []TestCase `json:"tests"`
+	// Output is what the runner printed
+	Output string `json:"output,omitempty"`
+	// Truncated is set when the middle of Output was dropped to keep it
+	// within the output limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Files written to the results directory by Script
+const (
+	OutputFile   = "output.log"
+	ExitCodeFile = "exit-code"
+	reportJSON   = "report.json"
+	reportXML    = "report.xml"
+)
+
+// ParseFramework validates a framework name
+func ParseFramework(name string) (Framework, error) {
+	for _, f := range Frameworks {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported test framework %q", name)
+}
+
+// Markers are the files whose presence Detect looks for, in order of
+// precedence
+var Markers = []struct {
+	File      string
+	Framework Framework
+}{
+	{"go.mod", GoTest},
+	{"Cargo.toml", Cargo},
+	{"pom.xml", JUnit},
+	{"build.gradle", JUnit},
+	{"build.gradle.kts", JUnit},
+	{"package.json", Jest},
+	{".rspec", RSpec},
+	{"Gemfile", RSpec},
+	{"spec", RSpec},
+	{"pytest.ini", Pytest},
+	{"conftest.py", Pytest},
+	{"pyproject.toml", Pytest},
+	{"setup.py", Pytest},
+	{"setup.cfg", Pytest},
+	{"tox.ini", Pytest},
+	{"requirements.txt", Pytest},
+}
+
+// languageFrameworks is the framework for a sandbox language when no
+// marker is present
+var languageFrameworks = map[string]Framework{
+	"python": Pytest,
+	"go":     GoTest,
+	"node":   Jest,
+	"ruby":   RSpec,
+	"rust":   Cargo,
+	"java":   JUnit,
+}
+
+// Detect picks the framework from the marker files present in a project,
+// falling back to the framework of the sandbox's language
+func Detect(present []string, language string) (Framework, error) {
+	found := make(map[string]bool, len(present))
+	for _, p := range present {
+		found[path.Clean(p)] = true
+	}
+	for _, m := range Markers {
+		if found[m.File] {
+			return m.Framework, nil
+		}
+	}
+	if f, ok := languageFrameworks[language]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("no test framework detected for %s", language)
+}
+
+// MarkerScript prints which of the Markers exist in the current directory
+func MarkerScript() string {
+	var files []string
+	for _, m := range Markers {
+		files = append(files, m.File)
+	}
+	return `for f in ` + strings.Join(files, " ") + `; do if [ -e "$f" ]; then echo "$f"; fi; done`
+}
+
+// commands run each framework from the project directory with its
+// arguments in "$@", writing reports into "$results"
+var commands = map[Framework]string{
+	Pytest: `python -m pytest --junitxml="$results/` + reportXML + `" "$@" >"$results/` + OutputFile + `" 2>&1`,
+	// Only the event stream goes to stdout; build errors go to stderr
+	GoTest: `if [ $# -eq 0 ]; then set -- ./...; fi
+go test -json "$@" >"$results/` + reportJSON + `" 2>"$results/` + OutputFile + `"`,
+	Jest: `npx jest --ci --json --outputFile="$results/` + reportJSON + `" "$@" >"$results/` + OutputFile + `" 2>&1`,
+	RSpec: `if [ -f Gemfile ]; then set -- bundle exec rspec "$@"; else set -- rspec "$@"; fi
+"$@" --format progress --format json --out "$results/` + reportJSON + `" >"$results/` + OutputFile + `" 2>&1`,
+	// libtest has no stable machine-readable format, so its output is parsed
+	Cargo: `cargo test "$@" >"$results/` + OutputFile + `" 2>&1`,
+	JUnit: `if [ -f pom.xml ]; then set -- mvn -B test "$@"; elif [ -x ./gradlew ]; then set -- ./gradlew test "$@"; else set -- gradle test "$@"; fi
+"$@" >"$results/` + OutputFile + `" 2>&1`,
+}
+
+// collect copies reports the runner writes elsewhere into "$results"
+var collect = map[Framework]string{
+	JUnit: `for f in target/surefire-reports/TEST-*.xml build/test-results/test/TEST-*.xml; do if [ -f "$f" ]; then cp "$f" "$results/"; fi; done`,
+}
+
+// Script returns a shell script that runs f from the current directory. It
+// takes the results directory as $1, which should be empty and not shared
+// with other runs, and passes the remaining arguments to the runner. The
+// script exits 0 once the runner has run; the runner's exit code is written
+// to ExitCodeFile.
+func Script(f Framework) (string, error) {
+	command, ok := commands[f]
+	if !ok {
+		return "", fmt.Errorf("unsupported test framework %q", f)
+	}
+
+	script := `results=$1; shift
+mkdir -p "$results" || exit
+` + command + `
+echo $? >"$results/` + ExitCodeFile + `"
+`
+	if c := collect[f]; c != "" {
+		script += c + "\n"
+	}
+	return script + "exit 0\n", nil
+}
+
+// Parse reads the files Script wrote, keyed by name, into a Result. A
+// missing report, such as when the runner is not installed, leaves the
+// result without tests; a malformed one is an error.
+func Parse(f Framework, files map[string][]byte) (*Result, error) {
+	result := &Result{Framework: f, Output: string(files[OutputFile])}
+
+	code := strings.TrimSpace(string(files[ExitCodeFile]))
+	exitCode, err := strconv.Atoi(code)
+	if err != nil {
+		return nil, fmt.Errorf("test run did not record an exit code: %q", code)
+	}
+	result.ExitCode = exitCode
+
+	switch f {
+	case Pytest:
+		if report, ok := files[reportXML]; ok {
+			result.Tests, err = parseJUnitXML(report)
+		}
+	case GoTest:
+		var output string
+		result.Tests, output, err = parseGoTest(files[reportJSON])
+		result.Output = output + result.Output
+	case Jest:
+		if report, ok := files[reportJSON]; ok {
+			result.Tests, err = parseJest(report)
+		}
+	case RSpec:
+		if report, ok := files[reportJSON]; ok {
+			result.Tests, err = parseRSpec(report)
+		}
+	case Cargo:
+		result.Tests = parseCargo(result.Output)
+	case JUnit:
+		for name, report := range files {
+			if !strings.HasSuffix(name, ".xml") {
+				continue
+			}
+			tests, perr := parseJUnitXML(report)
+			if perr != nil {
+				return nil, fmt.Errorf("%s: %w", name, perr)
+			}
+			result.Tests = append(result.Tests, tests...)
+		}
+		sortTests(result.Tests)
+	default:
+		return nil, fmt.Errorf("unsupported test framework %q", f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s results: %w", f, err)
+	}
+
+	for _, t := range result.Tests {
+		switch t.Status {
+		case StatusPassed:
+			result.Passed++
+		case StatusFailed:
+			result.Failed++
+		case StatusSkipped:
+			result.Skipped++
+		}
+	}
+	result.Success = result.ExitCode == 0 && result.Failed == 0
+	return result, nil
+}
@@ -0,0 +1,353 @@
+package testrun
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		present  []string
+		language string
+		want     Framework
+	}{
+		{[]string{"go.mod", "package.json"}, "node", GoTest},
+		{[]string{"Cargo.toml"}, "", Cargo},
+		{[]string{"pom.xml"}, "", JUnit},
+		{[]string{"build.gradle.kts"}, "", JUnit},
+		{[]string{"package.json"}, "", Jest},
+		{[]string{"Gemfile", "spec"}, "", RSpec},
+		{[]string{"./pyproject.toml"}, "", Pytest},
+		{nil, "python", Pytest},
+		{nil, "ruby", RSpec},
+	} {
+		got, err := Detect(tc.present, tc.language)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.present, err)
+		}
+		if got != tc.want {
+			t.Errorf("%v in a %s sandbox: expected %s, got %s", tc.present, tc.language, tc.want, got)
+		}
+	}
+
+	if _, err := Detect(nil, "php"); err == nil {
+		t.Fatal("expected no framework for php without markers")
+	}
+}
+
+func TestParseFramework(t *testing.T) {
+	for _, f := range Frameworks {
+		if _, err := ParseFramework(string(f)); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+		if _, err := Script(f); err != nil {
+			t.Errorf("%s has no script: %v", f, err)
+		}
+	}
+	if _, err := ParseFramework("mocha"); err == nil {
+		t.Fatal("expected an unsupported framework to be rejected")
+	}
+}
+
+func TestParseJUnitXML(t *testing.T) {
+	report := `<?xml version="1.0" encoding="utf-8"?>
+<testsuites>
+  <testsuite name="pytest" tests="4" failures="1" errors="1" skipped="1">
+    <testcase classname="tests.test_math" name="test_add" time="0.002"/>
+    <testcase classname="tests.test_math" name="test_sub" time="0.010">
+      <failure message="assert 1 == 2">def test_sub():
+&gt;       assert 1 == 2
+E       assert 1 == 2</failure>
+    </testcase>
+    <testcase classname="tests.test_math" name="test_setup" time="0">
+      <error message="fixture 'db' not found"/>
+    </testcase>
+    <testcase classname="tests.test_math" name="test_slow" time="0">
+      <skipped type="pytest.skip" message="too slow">tests/test_math.py:12: too slow</skipped>
+    </testcase>
+  </testsuite>
+</testsuites>`
+
+	result, err := Parse(Pytest, map[string][]byte{
+		ExitCodeFile: []byte("1\n"),
+		OutputFile:   []byte("1 failed, 1 passed, 1 skipped, 1 error"),
+		reportXML:    []byte(report),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.ExitCode != 1 || result.Passed != 1 || result.Failed != 2 || result.Skipped != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	sub := result.Tests[1]
+	if sub.Name != "test_sub" || sub.Suite != "tests.test_math" || sub.Duration != 0.010 {
+		t.Fatalf("unexpected test: %+v", sub)
+	}
+	if !strings.HasPrefix(sub.Message, "assert 1 == 2\ndef test_sub():") {
+		t.Fatalf("expected the message and traceback, got %q", sub.Message)
+	}
+	if msg := result.Tests[2].Message; msg != "fixture 'db' not found" {
+		t.Fatalf("unexpected error message %q", msg)
+	}
+}
+
+func TestParseJUnitReports(t *testing.T) {
+	result, err := Parse(JUnit, map[string][]byte{
+		ExitCodeFile: []byte("0"),
+		"TEST-com.example.BTest.xml": []byte(`<testsuite name="com.example.BTest">
+  <testcase name="works" classname="com.example.BTest" time="0.1"/>
+</testsuite>`),
+		"TEST-com.example.ATest.xml": []byte(`<testsuite name="com.example.ATest">
+  <testcase name="skipped" classname="com.example.ATest" time="0"><skipped/></testcase>
+</testsuite>`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || len(result.Tests) != 2 || result.Tests[0].Suite != "com.example.ATest" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	if _, err := Parse(JUnit, map[string][]byte{ExitCodeFile: []byte("1"), "TEST-x.xml": []byte("<testsuite")}); err == nil {
+		t.Fatal("expected a malformed report to be an error")
+	}
+}
+
+func TestParseJest(t *testing.T) {
+	report := `{
+  "numFailedTests": 1,
+  "testResults": [
+    {
+      "name": "/workspace/sum.test.js",
+      "status": "failed",
+      "message": "",
+      "assertionResults": [
+        {"fullName": "sum adds", "status": "passed", "duration": 3, "failureMessages": []},
+        {"fullName": "sum subtracts", "status": "failed", "duration": 12, "failureMessages": ["Error: expect(received).toBe(expected)\n\nExpected: 1\nReceived: 2"]},
+        {"fullName": "sum later", "status": "todo", "duration": null, "failureMessages": []}
+      ]
+    },
+    {
+      "name": "/workspace/broken.test.js",
+      "status": "failed",
+      "message": "  ● Test suite failed to run\n\n    SyntaxError: Unexpected token",
+      "assertionResults": []
+    }
+  ]
+}`
+
+	result, err := Parse(Jest, map[string][]byte{ExitCodeFile: []byte("1"), reportJSON: []byte(report)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Passed != 1 || result.Failed != 2 || result.Skipped != 1 {
+		t.Fatalf("unexpected counts: %+v", result)
+	}
+	if got := result.Tests[1]; got.Duration != 0.012 || !strings.Contains(got.Message, "Expected: 1") {
+		t.Fatalf("unexpected failed test: %+v", got)
+	}
+	if got := result.Tests[3]; got.Name != "/workspace/broken.test.js" || !strings.Contains(got.Message, "SyntaxError") {
+		t.Fatalf("expected the suite failure as a test, got %+v", got)
+	}
+}
+
+func TestParseRSpec(t *testing.T) {
+	report := `{
+  "messages": ["An error occurred while loading ./spec/broken_spec.rb."],
+  "examples": [
+    {"full_description": "Calculator adds", "status": "passed", "file_path": "./spec/calc_spec.rb", "run_time": 0.0004},
+    {"full_description": "Calculator divides", "status": "failed", "file_path": "./spec/calc_spec.rb", "run_time": 0.01,
+     "exception": {"class": "ZeroDivisionError", "message": "divided by 0", "backtrace": []}},
+    {"full_description": "Calculator roots", "status": "pending", "file_path": "./spec/calc_spec.rb", "run_time": 0, "pending_message": "Not yet implemented"}
+  ],
+  "summary": {"errors_outside_of_examples_count": 1}
+}`
+
+	result, err := Parse(RSpec, map[string][]byte{ExitCodeFile: []byte("1"), reportJSON: []byte(report)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Passed != 1 || result.Failed != 2 || result.Skipped != 1 {
+		t.Fatalf("unexpected counts: %+v", result)
+	}
+	if msg := result.Tests[1].Message; msg != "ZeroDivisionError: divided by 0" {
+		t.Fatalf("unexpected message %q", msg)
+	}
+	if msg := result.Tests[2].Message; msg != "Not yet implemented" {
+		t.Fatalf("unexpected pending message %q", msg)
+	}
+	if got := result.Tests[3]; !strings.Contains(got.Message, "broken_spec.rb") {
+		t.Fatalf("expected the load error as a test, got %+v", got)
+	}
+}
+
+func TestParseCargo(t *testing.T) {
+	output := `   Compiling demo v0.1.0 (/workspace)
+    Finished ` + "`test`" + ` profile [unoptimized + debuginfo] target(s) in 4.39s
+     Running unittests src/lib.rs (target/debug/deps/demo-ed92602a0e8eaf5e)
+
+running 3 tests
+test tests::adds ... ok
+test tests::fails ... FAILED
+test tests::slow ... ignored, slow
+
+failures:
+
+---- tests::fails stdout ----
+
+thread 'tests::fails' panicked at src/lib.rs:14:18:
+assertion ` + "`left == right`" + ` failed: math is broken
+  left: 3
+ right: 4
+note: run with ` + "`RUST_BACKTRACE=1`" + ` environment variable to display a backtrace
+
+
+failures:
+    tests::fails
+
+test result: FAILED. 1 passed; 1 failed; 1 ignored; 0 measured; 0 filtered out; finished in 0.02s
+
+   Doc-tests demo
+
+running 1 test
+test src/lib.rs - doc (line 3) ... ok
+
+test result: ok. 1 passed; 0 failed; 0 ignored; 0 measured; 0 filtered out; finished in 0.00s
+`
+
+	result, err := Parse(Cargo, map[string][]byte{ExitCodeFile: []byte("101"), OutputFile: []byte(output)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Passed != 2 || result.Failed != 1 || result.Skipped != 1 {
+		t.Fatalf("unexpected counts: %+v", result)
+	}
+
+	failed := result.Tests[1]
+	if failed.Suite != "src/lib.rs" || !strings.HasPrefix(failed.Message, "thread 'tests::fails' panicked") || !strings.Contains(failed.Message, "right: 4") {
+		t.Fatalf("unexpected failed test: %+v", failed)
+	}
+	if got := result.Tests[2]; got.Message != "slow" {
+		t.Fatalf("expected the ignore reason, got %+v", got)
+	}
+	if got := result.Tests[3]; got.Suite != "demo" || got.Name != "src/lib.rs - doc (line 3)" {
+		t.Fatalf("unexpected doc test: %+v", got)
+	}
+}
+
+func TestParseWithoutReport(t *testing.T) {
+	result, err := Parse(Pytest, map[string][]byte{
+		ExitCodeFile: []byte("127"),
+		OutputFile:   []byte("python: not found"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || len(result.Tests) != 0 || result.Output != "python: not found" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	if _, err := Parse(Pytest, map[string][]byte{}); err == nil {
+		t.Fatal("expected a run without an exit code to be an error")
+	}
+}
+
+// TestGoTestScript runs the go test script on a real module
+func TestGoTestScript(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+
+	project := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod": "module example.com/demo\n\ngo 1.21\n",
+		"calc/calc_test.go": `package calc
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	t.Run("small", func(t *testing.T) {})
+}
+
+func TestSub(t *testing.T) {
+	t.Errorf("expected 1, got 2")
+}
+
+func TestSlow(t *testing.T) {
+	t.Skip("too slow")
+}
+`,
+		"broken/broken.go": "package broken\n\nfunc Broken() int { return \"x\" }\n",
+	} {
+		path := filepath.Join(project, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script, err := Script(GoTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := filepath.Join(t.TempDir(), "results")
+	cmd := exec.Command("sh", "-c", script, "sh", results)
+	cmd.Dir = project
+	cmd.Env = append(os.Environ(), "PATH="+filepath.Dir(goBin)+":"+os.Getenv("PATH"), "GOFLAGS=", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v: %s", err, out)
+	}
+
+	files := map[string][]byte{}
+	entries, err := os.ReadDir(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(results, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = data
+	}
+
+	result, err := Parse(GoTest, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.ExitCode == 0 {
+		t.Fatalf("expected the run to fail: %+v", result)
+	}
+
+	byName := map[string]TestCase{}
+	for _, tc := range result.Tests {
+		byName[tc.Name] = tc
+	}
+	for name, want := range map[string]Status{
+		"TestAdd":                 StatusPassed,
+		"TestAdd/small":           StatusPassed,
+		"TestSub":                 StatusFailed,
+		"TestSlow":                StatusSkipped,
+		"example.com/demo/broken": StatusFailed,
+	} {
+		if got := byName[name]; got.Status != want {
+			t.Errorf("%s: expected %s, got %+v", name, want, got)
+		}
+	}
+	if msg := byName["TestSub"].Message; !strings.Contains(msg, "expected 1, got 2") {
+		t.Errorf("expected the failure output, got %q", msg)
+	}
+	if msg := byName["example.com/demo/broken"].Message; !strings.Contains(msg, "cannot use") {
+		t.Errorf("expected the build error, got %q", msg)
+	}
+	if byName["TestSub"].Suite != "example.com/demo/calc" {
+		t.Errorf("expected the package as suite, got %+v", byName["TestSub"])
+	}
+}
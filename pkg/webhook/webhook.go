@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of "<timestamp>.<body>", formatted as "sha256=<hex>"
+	SignatureHeader = "X-Sandboxed-Signature"
+	// TimestampHeader carries the Unix time, in seconds, at which the delivery was signed
+	TimestampHeader = "X-Sandboxed-Timestamp"
+	// AttemptHeader carries the 1-based delivery attempt number
+	AttemptHeader = "X-Sandboxed-Delivery-Attempt"
+)
+
+// Attempt records the outcome of a single delivery attempt
+type Attempt struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// DefaultMaxAge is how old a signed delivery may be before Verify rejects it
+const DefaultMaxAge = 5 * time.Minute
+
+// Notifier POSTs signed JSON payloads to callback URLs, retrying with exponential backoff
+type Notifier struct {
+	Secret         []byte
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Client         *http.Client
+	// AllowPrivate lets callbacks reach loopback, link-local and private
+	// addresses, which are refused by default
+	AllowPrivate bool
+}
+
+// NewNotifier creates a notifier that signs payloads with secret. Its client
+// refuses to connect to non-public addresses unless AllowPrivate is set.
+func NewNotifier(secret string) *Notifier {
+	n := &Notifier{
+		Secret:         []byte(secret),
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: n.checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	n.Client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return n
+}
+
+// checkDial runs after name resolution, so it sees the address actually
+// dialled, including after redirects and DNS changes
+func (n *Notifier) checkDial(network, address string, _ syscall.RawConn) error {
+	if n.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublic(ip) {
+		return fmt.Errorf("callback address %s is not public", host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublic reports whether ip is a globally routable unicast address
+func IsPublic(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// Sign returns the signature header value for body sent at timestamp, a
+// Unix time in seconds as carried in TimestampHeader
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body sent at
+// timestamp, and that timestamp is no more than maxAge from now. A maxAge of
+// zero uses DefaultMaxAge.
+func Verify(secret, body []byte, timestamp, signature string, maxAge time.Duration) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	age := time.Since(time.Unix(sec, 0))
+	if age > maxAge || age < -maxAge {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// ErrNoSecret is returned for callbacks when no signing secret is
+// configured, as receivers could not tell them from forgeries
+var ErrNoSecret = errors.New("callbacks are disabled: no webhook secret is configured")
+
+// Validate checks that the notifier can sign callbacks and that
+// callbackURL is a valid callback URL. Hosts that are literal non-public
+// addresses are rejected here; names are checked when they are dialled.
+func (n *Notifier) Validate(callbackURL string) error {
+	if n == nil || len(n.Secret) == 0 {
+		return ErrNoSecret
+	}
+	if err := ValidateURL(callbackURL); err != nil {
+		return err
+	}
+	if n.AllowPrivate {
+		return nil
+	}
+	u, _ := url.Parse(callbackURL)
+	host := u.Hostname()
+	if ip := net.ParseIP(host); (ip != nil && !IsPublic(ip)) || host == "localhost" {
+		return fmt.Errorf("invalid callback_url: %s is not a public address", host)
+	}
+	return nil
+}
+
+// ValidateURL checks that a callback URL is an absolute http(s) URL
+func ValidateURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback_url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid callback_url: must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// Deliver POSTs payload to callbackURL until it is accepted, the attempts are
+// exhausted or ctx is done. record, if set, is called after every attempt.
+func (n *Notifier) Deliver(ctx context.Context, callbackURL string, payload interface{}, record func(Attempt)) error {
+	if len(n.Secret) == 0 {
+		return ErrNoSecret
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %v", err)
+	}
+
+	maxAttempts := n.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := n.InitialBackoff
+
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		statusCode, retry, err := n.post(ctx, callbackURL, body, attempt)
+
+		a := Attempt{Attempt: attempt, StatusCode: statusCode, Time: time.Now()}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		if record != nil {
+			record(a)
+		}
+
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if n.MaxBackoff > 0 && backoff > n.MaxBackoff {
+			backoff = n.MaxBackoff
+		}
+	}
+
+	return fmt.Errorf("webhook delivery to %s failed: %w", callbackURL, lastErr)
+}
+
+// post performs one delivery attempt and reports whether a failure is worth retrying
+func (n *Notifier) post(ctx context.Context, callbackURL string, body []byte, attempt int) (int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sandboxed-webhook")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(n.Secret, timestamp, body))
+	req.Header.Set(AttemptHeader, strconv.Itoa(attempt))
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+
+	// Client errors other than rate limiting will not succeed on retry
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return resp.StatusCode, retry, fmt.Errorf("callback returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,145 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/system32-ai/sandboxed/pkg/webhook"
+)
+
+func TestDeliverRetriesAndSigns(t *testing.T) {
+	secret := []byte("s3cret")
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify(secret, body, r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader), 0) {
+			t.Errorf("invalid signature %q", r.Header.Get(webhook.SignatureHeader))
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := webhook.NewNotifier(string(secret))
+	n.InitialBackoff = time.Millisecond
+	n.AllowPrivate = true
+
+	var attempts []webhook.Attempt
+	err := n.Deliver(context.Background(), srv.URL, map[string]string{"status": "succeeded"}, func(a webhook.Attempt) {
+		attempts = append(attempts, a)
+	})
+	if err != nil {
+		t.Fatalf("expected delivery to succeed, got %v", err)
+	}
+
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(attempts))
+	}
+	if attempts[0].StatusCode != http.StatusBadGateway || attempts[0].Error == "" {
+		t.Fatalf("unexpected first attempt: %+v", attempts[0])
+	}
+	if attempts[2].StatusCode != http.StatusNoContent || attempts[2].Error != "" {
+		t.Fatalf("unexpected last attempt: %+v", attempts[2])
+	}
+}
+
+func TestDeliverStopsOnClientError(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	n := webhook.NewNotifier("s3cret")
+	n.InitialBackoff = time.Millisecond
+	n.AllowPrivate = true
+
+	if err := n.Deliver(context.Background(), srv.URL, struct{}{}, nil); err == nil {
+		t.Fatal("expected delivery to fail")
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single attempt for a 4xx response, got %d", calls)
+	}
+}
+
+func TestPrivateAddressesRejected(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	n := webhook.NewNotifier("s3cret")
+	n.MaxAttempts = 1
+	if err := n.Deliver(context.Background(), srv.URL, struct{}{}, nil); err == nil {
+		t.Fatal("expected delivery to a loopback address to fail")
+	}
+	if calls != 0 {
+		t.Fatalf("expected no request to reach the server, got %d", calls)
+	}
+
+	for _, u := range []string{"http://127.0.0.1/cb", "http://localhost:9000/cb", "http://169.254.169.254/latest", "http://10.0.0.5/cb", "http://[::1]/cb"} {
+		if err := n.Validate(u); err == nil {
+			t.Errorf("expected %q to be rejected", u)
+		}
+	}
+	n.AllowPrivate = true
+	if err := n.Validate("http://10.0.0.5/cb"); err != nil {
+		t.Errorf("expected private address to be allowed, got %v", err)
+	}
+}
+
+func TestVerifyRejectsStaleTimestamp(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"status":"succeeded"}`)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if !webhook.Verify(secret, body, now, webhook.Sign(secret, now, body), 0) {
+		t.Fatal("expected a fresh signature to verify")
+	}
+	if webhook.Verify(secret, body, now, webhook.Sign(secret, "0", body), 0) {
+		t.Fatal("expected a signature over another timestamp to be rejected")
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if webhook.Verify(secret, body, old, webhook.Sign(secret, old, body), 0) {
+		t.Fatal("expected a stale signature to be rejected")
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, u := range []string{"https://ci.example.com/hook", "http://localhost:9000/cb"} {
+		if err := webhook.ValidateURL(u); err != nil {
+			t.Errorf("expected %q to be valid: %v", u, err)
+		}
+	}
+	for _, u := range []string{"", "ftp://example.com", "/relative", "http://"} {
+		if err := webhook.ValidateURL(u); err == nil {
+			t.Errorf("expected %q to be rejected", u)
+		}
+	}
+}
+
+func TestNoSecretRejectsCallbacks(t *testing.T) {
+	n := webhook.NewNotifier("")
+	if err := n.Validate("https://ci.example.com/hook"); !errors.Is(err, webhook.ErrNoSecret) {
+		t.Fatalf("expected callbacks to be rejected without a secret, got %v", err)
+	}
+	if err := n.Deliver(context.Background(), "https://ci.example.com/hook", struct{}{}, nil); !errors.Is(err, webhook.ErrNoSecret) {
+		t.Fatalf("expected no delivery without a secret, got %v", err)
+	}
+	if err := webhook.NewNotifier("s3cret").Validate("https://ci.example.com/hook"); err != nil {
+		t.Fatalf("expected a valid callback, got %v", err)
+	}
+}